@@ -0,0 +1,176 @@
+package adoption
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/operatorconfig"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Roles of the Environment users by ClusterRole: the dev users of the non-production Environments are bound to
+// the admin ClusterRole too, they are imported as admins
+const (
+	roleAdmin  = "admin"
+	roleViewer = "viewer"
+)
+
+// Environment builds the Environment adopting an existing Namespace from the objects found in it: the ResourceQuota
+// gives the resources and the storage, the LimitRange the container defaults, and the User subjects of the
+// RoleBindings of the operator ClusterRoles the users. It also returns the notes about what wasn't imported.
+// The Namespace, which must be labelled adoptable, is left as it is, the Environment takes its ownership once
+// created.
+func Environment(ctx context.Context, c client.Reader, namespace string) (*onboardingv1alpha1.Environment, []string, error) {
+	cfg := operatorconfig.Get()
+	var notes []string
+
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return nil, nil, err
+	}
+	if owner := metav1.GetControllerOf(ns); owner != nil {
+		return nil, nil, fmt.Errorf("namespace %s is already owned by %s %s", namespace, owner.Kind, owner.Name)
+	}
+	if ns.Labels[onboardingv1alpha1.AdoptableLabel] != "true" {
+		return nil, nil, fmt.Errorf("namespace %s isn't labelled %s=true, it can't be adopted", namespace, onboardingv1alpha1.AdoptableLabel)
+	}
+	env := &onboardingv1alpha1.Environment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: onboardingv1alpha1.SchemeGroupVersion.String(), Kind: "Environment"},
+		ObjectMeta: metav1.ObjectMeta{Name: namespace},
+		Spec:       onboardingv1alpha1.EnvironmentSpec{Name: namespace, Adopt: true},
+	}
+
+	quotas := &corev1.ResourceQuotaList{}
+	if err := c.List(ctx, quotas, client.InNamespace(namespace)); err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	for _, quota := range quotas.Items {
+		names = append(names, quota.Name)
+	}
+	quota := pick(names, cfg.ObjectNames.ResourceQuota)
+	if quota < 0 {
+		return nil, nil, fmt.Errorf("namespace %s needs a single ResourceQuota, or one named %s, found %v", namespace, cfg.ObjectNames.ResourceQuota, names)
+	}
+	if missing := importQuota(&env.Spec, quotas.Items[quota].Spec.Hard); len(missing) > 0 {
+		return nil, nil, fmt.Errorf("ResourceQuota %s of namespace %s misses %s", names[quota], namespace, strings.Join(missing, ", "))
+	}
+	notes = append(notes, replaced("ResourceQuota", names, quota, cfg.ObjectNames.ResourceQuota)...)
+
+	limitRanges := &corev1.LimitRangeList{}
+	if err := c.List(ctx, limitRanges, client.InNamespace(namespace)); err != nil {
+		return nil, nil, err
+	}
+	names = nil
+	for _, limitRange := range limitRanges.Items {
+		names = append(names, limitRange.Name)
+	}
+	if limitRange := pick(names, cfg.ObjectNames.LimitRange); limitRange >= 0 {
+		for _, item := range limitRanges.Items[limitRange].Spec.Limits {
+			if item.Type == corev1.LimitTypeContainer {
+				env.Spec.LimitRange = &onboardingv1alpha1.LimitRangeDefaults{Default: item.Default, DefaultRequest: item.DefaultRequest}
+			}
+		}
+		notes = append(notes, replaced("LimitRange", names, limitRange, cfg.ObjectNames.LimitRange)...)
+	} else if len(names) > 0 {
+		notes = append(notes, fmt.Sprintf("LimitRanges %v are left as they are, the Environment gets the container defaults of the operator", names))
+	}
+
+	roleBindings := &rbacv1.RoleBindingList{}
+	if err := c.List(ctx, roleBindings, client.InNamespace(namespace)); err != nil {
+		return nil, nil, err
+	}
+	roles := map[string]string{}
+	for _, roleBinding := range roleBindings.Items {
+		var role string
+		switch {
+		case roleBinding.RoleRef.Kind != "ClusterRole":
+			continue
+		case roleBinding.RoleRef.Name == cfg.ClusterRoles.Admin:
+			role = roleAdmin
+		case roleBinding.RoleRef.Name == cfg.ClusterRoles.Viewer:
+			role = roleViewer
+		default:
+			continue
+		}
+		for _, subject := range roleBinding.Subjects {
+			if subject.Kind != rbacv1.UserKind {
+				notes = append(notes, fmt.Sprintf("%s %s of RoleBinding %s isn't imported, only users are", subject.Kind, subject.Name, roleBinding.Name))
+				continue
+			}
+			previous, found := roles[subject.Name]
+			if !found {
+				env.Spec.Users = append(env.Spec.Users, onboardingv1alpha1.User{Username: subject.Name})
+			}
+			// A user bound to both ClusterRoles gets the highest role
+			if previous != roleAdmin {
+				roles[subject.Name] = role
+			}
+		}
+		if roleBinding.Name != cfg.ObjectNames.AdminRoleBinding && roleBinding.Name != cfg.ObjectNames.ViewerRoleBinding {
+			notes = append(notes, fmt.Sprintf("RoleBinding %s is superseded by the Environment RoleBindings, delete it once the Environment is ready", roleBinding.Name))
+		}
+	}
+	for i := range env.Spec.Users {
+		env.Spec.Users[i].Role = roles[env.Spec.Users[i].Username]
+	}
+	return env, notes, nil
+}
+
+// importQuota sets the resources and the storage of the spec from the hard limits of a ResourceQuota, and returns
+// the keys missing. The cpu and memory keys are the requests ones.
+func importQuota(spec *onboardingv1alpha1.EnvironmentSpec, hard corev1.ResourceList) []string {
+	var missing []string
+	set := func(field *string, keys ...corev1.ResourceName) {
+		for _, key := range keys {
+			if quantity, found := hard[key]; found {
+				*field = quantity.String()
+				return
+			}
+		}
+		missing = append(missing, string(keys[0]))
+	}
+	set(&spec.Resources.ResourceRequests.CPU, corev1.ResourceRequestsCPU, corev1.ResourceCPU)
+	set(&spec.Resources.ResourceRequests.Memory, corev1.ResourceRequestsMemory, corev1.ResourceMemory)
+	set(&spec.Resources.ResourceRequests.EphemeralStorage, corev1.ResourceRequestsEphemeralStorage, corev1.ResourceEphemeralStorage)
+	set(&spec.Resources.ResourceLimits.CPU, corev1.ResourceLimitsCPU)
+	set(&spec.Resources.ResourceLimits.Memory, corev1.ResourceLimitsMemory)
+	set(&spec.Resources.ResourceLimits.EphemeralStorage, corev1.ResourceLimitsEphemeralStorage)
+	set(&spec.Storage, corev1.ResourceRequestsStorage)
+	return missing
+}
+
+// pick returns the index of the name the operator gives to the object, or of the only name, or -1
+func pick(names []string, name string) int {
+	for i := range names {
+		if names[i] == name {
+			return i
+		}
+	}
+	if len(names) == 1 {
+		return 0
+	}
+	return -1
+}
+
+// replaced returns the notes about the objects of the names that the Environment object of the operator name
+// replaces instead of adopting them: the picked object is imported, the others are left as they are
+func replaced(kind string, names []string, picked int, name string) []string {
+	var notes []string
+	for i := range names {
+		switch {
+		case names[i] == name:
+		case i == picked:
+			notes = append(notes, fmt.Sprintf("%s %s is imported into the Environment %s %s, delete it once the Environment is ready", kind, names[i], kind, name))
+		default:
+			notes = append(notes, fmt.Sprintf("%s %s isn't imported and is left as it is", kind, names[i]))
+		}
+	}
+	return notes
+}
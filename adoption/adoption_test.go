@@ -0,0 +1,105 @@
+package adoption
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEnvironment(t *testing.T) {
+	quantity := resource.MustParse
+	cl := fake.NewFakeClient(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "legacy", Labels: map[string]string{onboardingv1alpha1.AdoptableLabel: "true"}}},
+		&corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "legacy"},
+			Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
+				"cpu": quantity("2"), "requests.memory": quantity("4Gi"), "requests.ephemeral-storage": quantity("10Gi"),
+				"limits.cpu": quantity("4"), "limits.memory": quantity("8Gi"), "limits.ephemeral-storage": quantity("20Gi"),
+				"requests.storage": quantity("100Gi"),
+			}},
+		},
+		&corev1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: "cno-limit-range", Namespace: "legacy"},
+			Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+				Type:    corev1.LimitTypeContainer,
+				Default: corev1.ResourceList{corev1.ResourceCPU: quantity("1")},
+			}}},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "cno-admin-role-binding", Namespace: "legacy"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}, {Kind: rbacv1.GroupKind, Name: "ops"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "cno-admin-cluster-role"},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "readers", Namespace: "legacy"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "bob"}, {Kind: rbacv1.UserKind, Name: "alice"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "cno-viewer-cluster-role"},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "legacy"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "carol"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "edit"},
+		},
+	)
+
+	env, notes, err := Environment(context.TODO(), cl, "legacy")
+	if err != nil {
+		t.Fatalf("import: (%v)", err)
+	}
+	if env.Name != "legacy" || env.Spec.Name != "legacy" || !env.Spec.Adopt {
+		t.Errorf("Environment should adopt the namespace, got %v", env.ObjectMeta.Name)
+	}
+	resources := onboardingv1alpha1.Resources{
+		ResourceRequests: onboardingv1alpha1.ResourceDescription{CPU: "2", Memory: "4Gi", EphemeralStorage: "10Gi"},
+		ResourceLimits:   onboardingv1alpha1.ResourceDescription{CPU: "4", Memory: "8Gi", EphemeralStorage: "20Gi"},
+	}
+	if env.Spec.Resources != resources || env.Spec.Storage != "100Gi" {
+		t.Errorf("expected resources %v and storage 100Gi, got %v and %s", resources, env.Spec.Resources, env.Spec.Storage)
+	}
+	if env.Spec.LimitRange == nil || env.Spec.LimitRange.Default.Cpu().String() != "1" {
+		t.Errorf("expected the container defaults of the LimitRange, got %v", env.Spec.LimitRange)
+	}
+	users := []onboardingv1alpha1.User{{Username: "alice", Role: "admin"}, {Username: "bob", Role: "viewer"}}
+	if !reflect.DeepEqual(env.Spec.Users, users) {
+		t.Errorf("expected users %v, got %v", users, env.Spec.Users)
+	}
+	expected := []string{"Group ops", "ResourceQuota quota", "RoleBinding readers"}
+	for _, note := range expected {
+		found := false
+		for i := range notes {
+			found = found || strings.Contains(notes[i], note)
+		}
+		if !found {
+			t.Errorf("expected a note about %s, got %v", note, notes)
+		}
+	}
+}
+
+func TestEnvironmentWithIncompleteQuota(t *testing.T) {
+	cl := fake.NewFakeClient(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "legacy", Labels: map[string]string{onboardingv1alpha1.AdoptableLabel: "true"}}},
+		&corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "legacy"},
+			Spec:       corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{"pods": resource.MustParse("10")}},
+		},
+	)
+	if _, _, err := Environment(context.TODO(), cl, "legacy"); err == nil || !strings.Contains(err.Error(), "requests.cpu") {
+		t.Errorf("import should fail on the missing quota keys, got (%v)", err)
+	}
+}
+
+func TestEnvironmentOfNamespaceNotAdoptable(t *testing.T) {
+	cl := fake.NewFakeClient(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "legacy"}})
+	if _, _, err := Environment(context.TODO(), cl, "legacy"); err == nil || !strings.Contains(err.Error(), onboardingv1alpha1.AdoptableLabel) {
+		t.Errorf("import should fail on a namespace that isn't adoptable, got (%v)", err)
+	}
+}
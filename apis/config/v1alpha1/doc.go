@@ -0,0 +1,4 @@
+// Package v1alpha1 contains the v1alpha1 version of the operator configuration file. The configuration is not
+// served by the API server, it is read from a file, usually a mounted ConfigMap.
+// +groupName=config.onboarding.beopenit.com
+package v1alpha1
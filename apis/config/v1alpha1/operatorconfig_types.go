@@ -0,0 +1,239 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SchemeGroupVersion is the group version of the configuration file
+var SchemeGroupVersion = schema.GroupVersion{Group: "config.onboarding.beopenit.com", Version: "v1alpha1"}
+
+// Kind is the kind of the configuration file
+const Kind = "OperatorConfig"
+
+// OperatorConfig is the configuration of the operator. Empty fields take the default values.
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Server holds the addresses the operator serves on. Changes require a restart.
+	Server Server `json:"server,omitempty"`
+	// ClusterRoles bound to the Environment users. Changes require a restart, the role of a RoleBinding can't
+	// be changed.
+	ClusterRoles ClusterRoles `json:"clusterRoles,omitempty"`
+	// ObjectNames of the child objects of the Environments. Changes require a restart, the objects created
+	// with the previous names would be orphaned.
+	ObjectNames ObjectNames `json:"objectNames,omitempty"`
+	// LimitRange holds the container defaults of the Environment namespaces. Changes are applied on reload.
+	LimitRange LimitRange `json:"limitRange,omitempty"`
+	// Tracing configures the export of the reconcile traces. Changes require a restart.
+	Tracing Tracing `json:"tracing,omitempty"`
+	// LeaderElection configures the election of the replica running the controllers. Changes require a restart.
+	LeaderElection LeaderElection `json:"leaderElection,omitempty"`
+	// Bootstrap configures the library of the Environment bootstrap templates. Changes are applied on reload.
+	Bootstrap Bootstrap `json:"bootstrap,omitempty"`
+	// Capacity configures the cluster capacity guard of the Environment quotas. Changes are applied on reload.
+	Capacity Capacity `json:"capacity,omitempty"`
+}
+
+// Server holds the addresses the operator serves its endpoints on
+type Server struct {
+	MetricsHost         string `json:"metricsHost,omitempty"`
+	MetricsPort         int32  `json:"metricsPort,omitempty"`
+	OperatorMetricsPort int32  `json:"operatorMetricsPort,omitempty"`
+	HealthProbePort     int32  `json:"healthProbePort,omitempty"`
+	WebhookPort         int32  `json:"webhookPort,omitempty"`
+}
+
+// ClusterRoles are the ClusterRoles granted to the Environment users by role
+type ClusterRoles struct {
+	Admin  string `json:"admin,omitempty"`
+	Viewer string `json:"viewer,omitempty"`
+}
+
+// ObjectNames are the names of the objects created in the Environment namespaces
+type ObjectNames struct {
+	ResourceQuota     string `json:"resourceQuota,omitempty"`
+	LimitRange        string `json:"limitRange,omitempty"`
+	AdminRoleBinding  string `json:"adminRoleBinding,omitempty"`
+	ViewerRoleBinding string `json:"viewerRoleBinding,omitempty"`
+	// AccessRoleBindingPrefix prefixes the name of the AccessRequest RoleBindings
+	AccessRoleBindingPrefix string `json:"accessRoleBindingPrefix,omitempty"`
+}
+
+// LimitRange holds the default limits and requests of the containers
+type LimitRange struct {
+	Default        corev1.ResourceList `json:"default,omitempty"`
+	DefaultRequest corev1.ResourceList `json:"defaultRequest,omitempty"`
+}
+
+// Tracing configures the OTLP export of the traces
+type Tracing struct {
+	// Endpoint is the host:port of the OTLP gRPC collector, tracing is off when empty
+	Endpoint string `json:"endpoint,omitempty"`
+	// Insecure disables TLS on the connection to the collector
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// LeaderElection configures the lease-based election of the replica running the controllers, the other replicas
+// take over once the lease expires
+type LeaderElection struct {
+	// Enabled runs the controllers in the elected replica only, it defaults to true
+	Enabled *bool `json:"enabled,omitempty"`
+	// Namespace of the lock, the namespace of the operator when running in a cluster
+	Namespace string `json:"namespace,omitempty"`
+	// ID is the name of the lock
+	ID string `json:"id,omitempty"`
+	// LeaseDuration is how long the other replicas wait before taking over a lease that isn't renewed
+	LeaseDuration metav1.Duration `json:"leaseDuration,omitempty"`
+	// RenewDeadline is how long the leader retries renewing its lease before giving up the leadership
+	RenewDeadline metav1.Duration `json:"renewDeadline,omitempty"`
+	// RetryPeriod is the interval between the attempts to acquire or renew the lease
+	RetryPeriod metav1.Duration `json:"retryPeriod,omitempty"`
+}
+
+// Bootstrap configures the library of the templates the Environments are bootstrapped with
+type Bootstrap struct {
+	// Namespace of the template ConfigMaps, the namespace of the operator when running in a cluster
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Capacity configures the comparison of the Environment requests with the allocatable resources of the nodes
+type Capacity struct {
+	// OvercommitRatio multiplies the allocatable resources of the nodes by resource name (cpu, memory,
+	// ephemeral-storage), 1 for the resources that aren't listed
+	OvercommitRatio corev1.ResourceList `json:"overcommitRatio,omitempty"`
+	// Enforce rejects the new and enlarged Environments above the capacity in the Environment webhook, the
+	// capacity is only reported otherwise
+	Enforce bool `json:"enforce,omitempty"`
+	// Namespace of the capacity report ConfigMap, the namespace of the operator when running in a cluster
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// NewOperatorConfig returns the default configuration
+func NewOperatorConfig() *OperatorConfig {
+	cfg := &OperatorConfig{}
+	cfg.Default()
+	return cfg
+}
+
+// Default sets the empty fields to their default value
+func (c *OperatorConfig) Default() {
+	defaultString(&c.APIVersion, SchemeGroupVersion.String())
+	defaultString(&c.Kind, Kind)
+	defaultString(&c.Server.MetricsHost, "0.0.0.0")
+	defaultPort(&c.Server.MetricsPort, 8383)
+	defaultPort(&c.Server.OperatorMetricsPort, 8686)
+	defaultPort(&c.Server.HealthProbePort, 8081)
+	defaultPort(&c.Server.WebhookPort, 9443)
+	defaultString(&c.ClusterRoles.Admin, "cno-admin-cluster-role")
+	defaultString(&c.ClusterRoles.Viewer, "cno-viewer-cluster-role")
+	defaultString(&c.ObjectNames.ResourceQuota, "cno-resource-quota")
+	defaultString(&c.ObjectNames.LimitRange, "cno-limit-range")
+	defaultString(&c.ObjectNames.AdminRoleBinding, "cno-admin-role-binding")
+	defaultString(&c.ObjectNames.ViewerRoleBinding, "cno-viewer-role-binding")
+	defaultString(&c.ObjectNames.AccessRoleBindingPrefix, "cno-access-")
+	if c.LeaderElection.Enabled == nil {
+		enabled := true
+		c.LeaderElection.Enabled = &enabled
+	}
+	defaultString(&c.LeaderElection.ID, "onboarding-operator-kubernetes-lock")
+	defaultDuration(&c.LeaderElection.LeaseDuration, 15*time.Second)
+	defaultDuration(&c.LeaderElection.RenewDeadline, 10*time.Second)
+	defaultDuration(&c.LeaderElection.RetryPeriod, 2*time.Second)
+	if c.LimitRange.Default == nil {
+		c.LimitRange.Default = corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("500m"),
+			corev1.ResourceMemory: resource.MustParse("512Mi"),
+		}
+	}
+	if c.LimitRange.DefaultRequest == nil {
+		c.LimitRange.DefaultRequest = corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		}
+	}
+}
+
+// Validate returns an error when the configuration version is unknown or a field is invalid
+func (c *OperatorConfig) Validate() error {
+	if c.APIVersion != SchemeGroupVersion.String() || c.Kind != Kind {
+		return fmt.Errorf("unsupported configuration %s %s, expected %s %s", c.APIVersion, c.Kind, SchemeGroupVersion, Kind)
+	}
+	for name, port := range map[string]int32{
+		"metricsPort":         c.Server.MetricsPort,
+		"operatorMetricsPort": c.Server.OperatorMetricsPort,
+		"healthProbePort":     c.Server.HealthProbePort,
+		"webhookPort":         c.Server.WebhookPort,
+	} {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("server.%s %d is not a valid port", name, port)
+		}
+	}
+	election := c.LeaderElection
+	if election.LeaseDuration.Duration <= election.RenewDeadline.Duration {
+		return fmt.Errorf("leaderElection.leaseDuration %s must be longer than the renewDeadline %s", election.LeaseDuration.Duration, election.RenewDeadline.Duration)
+	}
+	if election.RetryPeriod.Duration < 0 {
+		return fmt.Errorf("leaderElection.retryPeriod %s is negative", election.RetryPeriod.Duration)
+	}
+	// The retries are jittered up to 20% longer
+	if election.RenewDeadline.Duration*5 <= election.RetryPeriod.Duration*6 {
+		return fmt.Errorf("leaderElection.renewDeadline %s must be longer than 1.2 times the retryPeriod %s", election.RenewDeadline.Duration, election.RetryPeriod.Duration)
+	}
+	for name, ratio := range c.Capacity.OvercommitRatio {
+		if ratio.Sign() <= 0 {
+			return fmt.Errorf("capacity.overcommitRatio.%s %s must be positive", name, ratio.String())
+		}
+	}
+	for name, value := range c.LimitRange.DefaultRequest {
+		if limit, ok := c.LimitRange.Default[name]; ok && value.Cmp(limit) > 0 {
+			return fmt.Errorf("limitRange.defaultRequest.%s %s is above the default limit %s", name, value.String(), limit.String())
+		}
+	}
+	return nil
+}
+
+// RestartRequired lists the fields changed from c to other whose change is only applied after a restart
+func (c *OperatorConfig) RestartRequired(other *OperatorConfig) []string {
+	var fields []string
+	if c.Server != other.Server {
+		fields = append(fields, "server")
+	}
+	if c.ClusterRoles != other.ClusterRoles {
+		fields = append(fields, "clusterRoles")
+	}
+	if c.ObjectNames != other.ObjectNames {
+		fields = append(fields, "objectNames")
+	}
+	if c.Tracing != other.Tracing {
+		fields = append(fields, "tracing")
+	}
+	if !reflect.DeepEqual(c.LeaderElection, other.LeaderElection) {
+		fields = append(fields, "leaderElection")
+	}
+	return fields
+}
+
+func defaultString(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+func defaultPort(field *int32, value int32) {
+	if *field == 0 {
+		*field = value
+	}
+}
+
+func defaultDuration(field *metav1.Duration, value time.Duration) {
+	if field.Duration == 0 {
+		field.Duration = value
+	}
+}
@@ -0,0 +1,76 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AccessRequest phases
+const (
+	AccessRequestPending  = "Pending"
+	AccessRequestActive   = "Active"
+	AccessRequestExpired  = "Expired"
+	AccessRequestRejected = "Rejected"
+	AccessRequestRevoked  = "Revoked"
+)
+
+// AccessRequestSpec defines a temporary role requested by a user on an Environment
+type AccessRequestSpec struct {
+	// Environment is the name of the Environment the access is requested on
+	Environment string `json:"environment" validate:"required"`
+	Username    string `json:"username" validate:"required"`
+	// Role is one of the Environment user roles (admin, dev, viewer)
+	Role string `json:"role" validate:"required"`
+	// Duration is how long the access is granted once approved (e.g. 2h)
+	Duration      metav1.Duration `json:"duration" validate:"required"`
+	Justification string          `json:"justification" validate:"required"`
+	// Approved grants the request. ApprovedBy must be one of the Environment approvers, the AccessRequest webhook
+	// checks that it is the approving user.
+	Approved   bool   `json:"approved,omitempty"`
+	ApprovedBy string `json:"approvedBy,omitempty"`
+}
+
+// AccessRequestAuditRecord is an entry of the audit trail of an AccessRequest
+type AccessRequestAuditRecord struct {
+	Time    metav1.Time `json:"time"`
+	Action  string      `json:"action"`
+	Actor   string      `json:"actor,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// AccessRequestStatus defines the observed state of AccessRequest (Pending, Active, Expired, Rejected, Revoked)
+type AccessRequestStatus struct {
+	Phase       string                     `json:"phase,omitempty"`
+	Message     string                     `json:"message,omitempty"`
+	Namespace   string                     `json:"namespace,omitempty"`
+	RoleBinding string                     `json:"roleBinding,omitempty"`
+	GrantedAt   *metav1.Time               `json:"grantedAt,omitempty"`
+	ExpiresAt   *metav1.Time               `json:"expiresAt,omitempty"`
+	AuditLog    []AccessRequestAuditRecord `json:"auditLog,omitempty"`
+}
+
+// AccessRequest is the Schema for the accessrequests API
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=accessrequests,scope=Cluster
+// +kubebuilder:printcolumn:name="Environment",type=string,JSONPath=`.spec.environment`
+// +kubebuilder:printcolumn:name="User",type=string,JSONPath=`.spec.username`
+// +kubebuilder:printcolumn:name="Role",type=string,JSONPath=`.spec.role`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Expires",type=string,JSONPath=`.status.expiresAt`
+type AccessRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AccessRequestSpec   `json:"spec,omitempty"`
+	Status AccessRequestStatus `json:"status,omitempty"`
+}
+
+// AccessRequestList contains a list of AccessRequest
+type AccessRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AccessRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AccessRequest{}, &AccessRequestList{})
+}
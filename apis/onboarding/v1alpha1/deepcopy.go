@@ -25,3 +25,83 @@ func (in *EnvironmentList) DeepCopyObject() runtime.Object {
 
 	return &out
 }
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *AccessRequest) DeepCopyObject() runtime.Object {
+	out := AccessRequest{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *AccessRequestList) DeepCopyObject() runtime.Object {
+	out := AccessRequestList{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *EnvironmentPolicy) DeepCopyObject() runtime.Object {
+	out := EnvironmentPolicy{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *EnvironmentPolicyList) DeepCopyObject() runtime.Object {
+	out := EnvironmentPolicyList{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *EnvironmentPromotion) DeepCopyObject() runtime.Object {
+	out := EnvironmentPromotion{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *EnvironmentPromotionList) DeepCopyObject() runtime.Object {
+	out := EnvironmentPromotionList{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *EnvironmentRequest) DeepCopyObject() runtime.Object {
+	out := EnvironmentRequest{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *EnvironmentRequestList) DeepCopyObject() runtime.Object {
+	out := EnvironmentRequestList{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *QuotaRequest) DeepCopyObject() runtime.Object {
+	out := QuotaRequest{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *QuotaRequestList) DeepCopyObject() runtime.Object {
+	out := QuotaRequestList{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
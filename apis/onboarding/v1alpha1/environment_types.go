@@ -1,6 +1,8 @@
 package v1alpha1
 
 import (
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -17,21 +19,355 @@ type User struct {
 type EnvironmentSpec struct {
 	Name      string `json:"name" validate:"required"`
 	IsProd	  bool   `json:"isprod"`
+	// Tier classifies the Environment for policies and defaults (e.g. dev, staging). Production
+	// Environments are always in the prod tier.
+	Tier      string `json:"tier,omitempty"`
 	Resources `json:"resources" validate:"required"`
 	// +kubebuilder:validation:Pattern=`^(\d+(e\d+)?|\d+(\.\d+)?(e\d+)?[EPTGMK]i?)$`
-	Storage    string   `json:"storage" validate:"required"`
-	Users      []User   `json:"users"`
+	Storage    string   `json:"storage,omitempty" validate:"required"`
+	Users      []User   `json:"users,omitempty"`
+	// Approvers lists the users allowed to approve elevated access requests and production changes on this Environment
+	Approvers []string `json:"approvers,omitempty"`
+	// AllowedRegistries restricts the registries, or registry paths, the images of the namespace workloads
+	// are pulled from, on top of the registries allowed by the EnvironmentPolicies for the tier
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+	// QuotaThresholds overrides the quota usage thresholds of the tier
+	QuotaThresholds *QuotaThresholds `json:"quotaThresholds,omitempty"`
+	// TTL is how long a non-production Environment lives after its last activity, the tier default when empty
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// ExpiresAt is the expiry time of a non-production Environment, it takes precedence over the TTL
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// ExpiryAction is applied to the Environment at expiry, the tier default or Delete when empty
+	// +kubebuilder:validation:Enum=Delete;Hibernate
+	ExpiryAction string `json:"expiryAction,omitempty"`
+	// Hibernation scales the workloads of the Environment to zero, on demand or on a schedule
+	Hibernation *Hibernation `json:"hibernation,omitempty"`
+	// CloneFrom copies the spec defaults and some Namespace objects of another Environment at creation
+	CloneFrom *CloneFrom `json:"cloneFrom,omitempty"`
+	// LimitRange overrides the container defaults of the operator configuration in the Environment LimitRange
+	LimitRange *LimitRangeDefaults `json:"limitRange,omitempty"`
+	// Adopt takes the ownership of an existing Namespace of the name labelled adoptable, its child objects are
+	// updated in place. An adopted Environment hibernates at expiry instead of being deleted.
+	Adopt bool `json:"adopt,omitempty"`
+	// Bootstrap applies the manifests rendered from the templates of the bootstrap library into the Namespace
+	Bootstrap *Bootstrap `json:"bootstrap,omitempty"`
 }
 
-// EnvironmentStatus defines the observed state of Environment (success, failed)
+// Policies of a Bootstrap
+const (
+	BootstrapOnce       = "Once"
+	BootstrapContinuous = "Continuous"
+)
+
+// Bootstrap names the ConfigMaps of the bootstrap library, in the bootstrap namespace of the operator
+// configuration, holding the Go templates of the manifests applied into the Namespace of the Environment. Each key
+// of a ConfigMap is a template of one or more YAML documents, rendered with the name, namespace, tier, users and
+// labels of the Environment.
+type Bootstrap struct {
+	// Templates are the names of the ConfigMaps, rendered in this order
+	Templates []string `json:"templates"`
+	// Policy is Once to create the objects once and leave them to the Environment users, or Continuous to keep
+	// them as rendered and delete the ones no longer rendered. It defaults to Once.
+	// +kubebuilder:validation:Enum=Once;Continuous
+	Policy string `json:"policy,omitempty"`
+}
+
+// LimitRangeDefaults are the default limits and requests of the containers of an Environment Namespace. The
+// empty ones are taken from the operator configuration.
+type LimitRangeDefaults struct {
+	Default        corev1.ResourceList `json:"default,omitempty"`
+	DefaultRequest corev1.ResourceList `json:"defaultRequest,omitempty"`
+}
+
+// CloneFrom names the Environment a new Environment is cloned from. Its resources, storage, tier, allowed
+// registries, quota thresholds and hibernation are copied into the empty fields of the new spec at creation.
+type CloneFrom struct {
+	// Environment is the name of the source Environment
+	Environment string `json:"environment"`
+	// Users copies the users of the source Environment when the new Environment has none
+	Users bool `json:"users,omitempty"`
+	// Selector of the labels of the ConfigMaps, Secrets and ServiceAccounts copied from the source Namespace,
+	// none is copied without selector
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// Actions applied to an expired Environment
+const (
+	ExpiryDelete    = "Delete"
+	ExpiryHibernate = "Hibernate"
+)
+
+// Hibernation scales the Deployments and StatefulSets of the Environment Namespace to zero and suspends its
+// CronJobs. The schedules are cron expressions in UTC, or in the time zone of a CRON_TZ= prefix.
+type Hibernation struct {
+	// Hibernate hibernates the Environment until it is unset, whatever the schedules
+	Hibernate bool `json:"hibernate,omitempty"`
+	// Schedule the Environment hibernates on, e.g. "0 20 * * 1-5"
+	Schedule string `json:"schedule,omitempty"`
+	// WakeUpSchedule the Environment wakes up on, e.g. "0 7 * * 1-5"
+	WakeUpSchedule string `json:"wakeUpSchedule,omitempty"`
+}
+
+// QuotaThresholds are the usage percentages of a ResourceQuota key raising the QuotaPressure condition.
+// A zero threshold is taken from the tier defaults.
+type QuotaThresholds struct {
+	Warning  int32 `json:"warning,omitempty"`
+	Critical int32 `json:"critical,omitempty"`
+}
+
+// Default tiers of the Environments
+const (
+	TierProd = "prod"
+	TierDev  = "dev"
+)
+
+// Environment phases reported in EnvironmentStatus
+const (
+	EnvironmentPending = "Pending"
+	EnvironmentReady   = "Ready"
+)
+
+// Phases of a CloneStatus
+const (
+	CloneCompleted = "Completed"
+	CloneFailed    = "Failed"
+)
+
+// CloneStatus reports the copy of the objects of the source Environment Namespace
+type CloneStatus struct {
+	// Phase is Completed once every object is copied, or Failed, the failed objects being copied again on the
+	// next reconciliations
+	Phase   string `json:"phase"`
+	Message string `json:"message,omitempty"`
+	// Copied lists the objects copied as Kind/name
+	Copied []string `json:"copied,omitempty"`
+	// Skipped lists the objects already found in the Namespace, which are left as they are
+	Skipped []string `json:"skipped,omitempty"`
+	// Failed lists the objects that couldn't be copied, with the error
+	Failed []string `json:"failed,omitempty"`
+	// CompletionTime is the time the clone completed
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// States of a BootstrapObjectStatus
+const (
+	BootstrapApplied = "Applied"
+	BootstrapSkipped = "Skipped"
+	BootstrapFailed  = "Failed"
+)
+
+// BootstrapObjectStatus reports an object rendered from a bootstrap template. A template that couldn't be read or
+// rendered is reported without object.
+type BootstrapObjectStatus struct {
+	// Template is the ConfigMap and key the object is rendered from, as configmap/key
+	Template   string `json:"template"`
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Name       string `json:"name,omitempty"`
+	// State is Applied once the object is created or up to date, Skipped when an object of the name not owned by
+	// the Environment exists, and Failed otherwise, the failed objects being applied again on the next
+	// reconciliations
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+	// AppliedAt is the time the object was last created or updated
+	AppliedAt *metav1.Time `json:"appliedAt,omitempty"`
+}
+
+// BootstrapHashAnnotation holds the hash of the rendered manifest of a bootstrap object, the object is updated
+// when it changes
+const BootstrapHashAnnotation = "onboarding.beopenit.com/bootstrap-hash"
+
+// Hibernation states reported in EnvironmentStatus
+const (
+	HibernationAwake      = "Awake"
+	HibernationHibernated = "Hibernated"
+)
+
+// Annotations recording the approval of a production Environment generation
+const (
+	ApprovedGenerationAnnotation = "onboarding.beopenit.com/approved-generation"
+	ApprovedByAnnotation         = "onboarding.beopenit.com/approved-by"
+)
+
+// Annotations pausing the reconciliation of an Environment: while paused is "true" the operator doesn't change
+// the child objects and only reports their drift from the spec. The pause ends at the optional paused-until
+// RFC 3339 time.
+const (
+	PausedAnnotation      = "onboarding.beopenit.com/paused"
+	PausedUntilAnnotation = "onboarding.beopenit.com/paused-until"
+)
+
+// ExtendUntilAnnotation postpones the expiry of an Environment to the RFC 3339 time it holds
+const ExtendUntilAnnotation = "onboarding.beopenit.com/extend-until"
+
+// Annotations keeping the state of the workloads of a hibernated Environment: the replicas of its Deployments and
+// StatefulSets, and whether its CronJobs were suspended
+const (
+	HibernatedReplicasAnnotation = "onboarding.beopenit.com/hibernated-replicas"
+	HibernatedSuspendAnnotation  = "onboarding.beopenit.com/hibernated-suspend"
+)
+
+// DryRunAnnotation set to "true" makes the operator plan the changes to the child objects of the Environment
+// without applying them
+const DryRunAnnotation = "onboarding.beopenit.com/dry-run"
+
+// EnvironmentLabel is set on the namespace of an Environment to the Environment name
+const EnvironmentLabel = "onboarding.beopenit.com/environment"
+
+// AdoptableLabel opts an existing namespace in for the adoption by an Environment, when set to "true"
+const AdoptableLabel = "onboarding.beopenit.com/adoptable"
+
+// EnvironmentStatus defines the observed state of Environment (Pending, Ready)
 type EnvironmentStatus struct {
 	EnvironmentStatus string `json:"environmentStatus"`
+	// ApprovedGeneration is the last generation of the Environment applied by the operator
+	ApprovedGeneration int64 `json:"approvedGeneration,omitempty"`
+	// ApprovedSpec is the spec of the approved generation, applied while newer changes wait for approval
+	ApprovedSpec *EnvironmentSpec `json:"approvedSpec,omitempty"`
+	// PendingChanges lists the changes waiting for approval
+	PendingChanges []string `json:"pendingChanges,omitempty"`
+	// AuditHistory holds the latest changes made to the Environment ResourceQuota and RoleBinding subjects
+	AuditHistory []AuditRecord `json:"auditHistory,omitempty"`
+	// Usage holds the consumption of each key of the Environment ResourceQuota
+	Usage []QuotaUsage `json:"usage,omitempty"`
+	// MaxUsagePercent is the highest percentage of the Usage keys
+	MaxUsagePercent int32 `json:"maxUsagePercent,omitempty"`
+	// Conditions of the Environment, e.g. QuotaPressure
+	Conditions status.Conditions `json:"conditions,omitempty"`
+	// Drift lists the differences between the child objects and the spec found while the Environment is paused
+	Drift []string `json:"drift,omitempty"`
+	// Plan lists the operations the operator would apply to the child objects, reported in dry-run mode
+	Plan []PlannedOperation `json:"plan,omitempty"`
+	// Shard describes the shard of the operator instance reconciling the Environment, empty without sharding
+	Shard string `json:"shard,omitempty"`
+	// LastActivity is the latest activity seen on the Environment: its creation, a spec change or a Pod start
+	LastActivity *metav1.Time `json:"lastActivity,omitempty"`
+	// ExpiresAt is the time the expiry action is applied to a non-production Environment
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// ReadyAt is the time the Environment first became Ready, recorded by the operator
+	ReadyAt *metav1.Time `json:"readyAt,omitempty"`
+	// Hibernation is Hibernated while the workloads are scaled to zero and Awake otherwise, empty without hibernation
+	Hibernation string `json:"hibernation,omitempty"`
+	// NextHibernationChange is the next time the Environment hibernates or wakes up on its schedules
+	NextHibernationChange *metav1.Time `json:"nextHibernationChange,omitempty"`
+	// Clone reports the copy of the objects of the Environment cloned from, with spec.cloneFrom
+	Clone *CloneStatus `json:"clone,omitempty"`
+	// Bootstrap reports the objects rendered from the bootstrap templates, with spec.bootstrap
+	Bootstrap []BootstrapObjectStatus `json:"bootstrap,omitempty"`
+}
+
+// Operations of a PlannedOperation
+const (
+	OperationCreate = "Create"
+	OperationUpdate = "Update"
+	OperationDelete = "Delete"
+)
+
+// PlannedOperation is a change the operator would apply to a child object of the Environment
+type PlannedOperation struct {
+	// Operation is Create, Update, or Delete for the bootstrapped objects no longer rendered
+	Operation string `json:"operation"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Changes lists the updated fields as "field old -> new"
+	Changes []string `json:"changes,omitempty"`
+}
+
+// Condition types of the Environment
+const (
+	// QuotaPressureCondition is true while the ResourceQuota usage is above the warning or critical threshold
+	QuotaPressureCondition status.ConditionType = "QuotaPressure"
+	// PausedCondition is true while the reconciliation of the Environment is paused by its annotations
+	PausedCondition status.ConditionType = "Paused"
+	// DryRunCondition is true while the changes to the Environment are planned instead of applied
+	DryRunCondition status.ConditionType = "DryRun"
+	// ExpiringCondition is true once a non-production Environment is within the warning period of its expiry
+	ExpiringCondition status.ConditionType = "Expiring"
+	// HibernatedCondition is true while the workloads of the Environment are scaled to zero
+	HibernatedCondition status.ConditionType = "Hibernated"
+	// ApprovalUncheckedCondition is true while the approvals of a production Environment are ignored because the
+	// webhook checking them isn't served
+	ApprovalUncheckedCondition status.ConditionType = "ApprovalUnchecked"
+)
+
+// Reasons of the QuotaPressure condition
+const (
+	QuotaPressureWarning  status.ConditionReason = "WarningThreshold"
+	QuotaPressureCritical status.ConditionReason = "CriticalThreshold"
+	QuotaPressureNone     status.ConditionReason = "BelowThresholds"
+)
+
+// Reasons of the Paused condition
+const (
+	PausedByAnnotation status.ConditionReason = "PausedByAnnotation"
+	PauseExpired       status.ConditionReason = "PauseExpired"
+	PauseRemoved       status.ConditionReason = "PauseRemoved"
+)
+
+// Reasons of the DryRun condition
+const (
+	DryRunByAnnotation status.ConditionReason = "DryRunAnnotation"
+	DryRunByFlag       status.ConditionReason = "DryRunFlag"
+	DryRunDisabled     status.ConditionReason = "DryRunDisabled"
+)
+
+// Reasons of the Expiring condition
+const (
+	ExpiryScheduled status.ConditionReason = "ExpiryScheduled"
+	ExpiryWarning   status.ConditionReason = "ExpiryWarning"
+	ExpiryReached   status.ConditionReason = "ExpiryReached"
+)
+
+// Reasons of the Hibernated condition
+const (
+	HibernatedManually   status.ConditionReason = "HibernatedManually"
+	HibernatedOnSchedule status.ConditionReason = "HibernatedOnSchedule"
+	HibernatedAtExpiry   status.ConditionReason = "HibernatedAtExpiry"
+	HibernationWokeUp    status.ConditionReason = "WokeUp"
+	HibernationInvalid   status.ConditionReason = "InvalidSchedule"
+)
+
+// Reasons of the ApprovalUnchecked condition
+const (
+	ApprovalWebhookDisabled status.ConditionReason = "WebhookDisabled"
+)
+
+// QuotaUsage is the consumption of a ResourceQuota key, from the ResourceQuota status
+type QuotaUsage struct {
+	// Resource is the ResourceQuota key, e.g. requests.cpu
+	Resource string `json:"resource"`
+	Hard     string `json:"hard"`
+	Used     string `json:"used"`
+	// Percent is the used share of the hard limit
+	Percent int32 `json:"percent"`
+}
+
+// AuditRecord describes a change applied by the operator to a child object of the Environment
+type AuditRecord struct {
+	Time metav1.Time `json:"time"`
+	// Kind and Name of the changed object
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Field is the changed ResourceQuota key, or subjects for a RoleBinding
+	Field    string `json:"field"`
+	OldValue string `json:"oldValue,omitempty"`
+	NewValue string `json:"newValue,omitempty"`
+	// Generation of the Environment the change was applied for
+	Generation int64 `json:"generation"`
+	// Modifier is the manager of the last Environment spec update, taken from the managedFields
+	Modifier string `json:"modifier,omitempty"`
 }
 
 // Environment is the Schema for the environments API
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=environments,scope=Cluster
 // +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.environmentStatus`
+// +kubebuilder:printcolumn:name="Usage",type=integer,JSONPath=`.status.maxUsagePercent`,description="Highest percentage of the quota keys used"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:printcolumn:name="Shard",type=string,JSONPath=`.status.shard`,priority=1
+// +kubebuilder:printcolumn:name="Hibernation",type=string,JSONPath=`.status.hibernation`,priority=1
 type Environment struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -40,6 +376,30 @@ type Environment struct {
 	Status EnvironmentStatus `json:"status,omitempty"`
 }
 
+// Tier returns the tier of the Environment: prod for production Environments, the spec tier or dev otherwise
+func (in *Environment) Tier() string {
+	if in.Spec.IsProd {
+		return TierProd
+	}
+	if in.Spec.Tier == "" {
+		return TierDev
+	}
+	return in.Spec.Tier
+}
+
+// Quota returns the quantities of the Environment ResourceQuota by ResourceQuota key
+func (in *EnvironmentSpec) Quota() map[corev1.ResourceName]string {
+	return map[corev1.ResourceName]string{
+		"requests.cpu":               in.Resources.ResourceRequests.CPU,
+		"requests.memory":            in.Resources.ResourceRequests.Memory,
+		"requests.ephemeral-storage": in.Resources.ResourceRequests.EphemeralStorage,
+		"limits.cpu":                 in.Resources.ResourceLimits.CPU,
+		"limits.memory":              in.Resources.ResourceLimits.Memory,
+		"limits.ephemeral-storage":   in.Resources.ResourceLimits.EphemeralStorage,
+		"requests.storage":           in.Storage,
+	}
+}
+
 // EnvironmentList contains a list of Environment
 type EnvironmentList struct {
 	metav1.TypeMeta `json:",inline"`
@@ -0,0 +1,71 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EnvironmentPolicyRule restricts who may create or modify the Environments of a tier. Subjects are usernames,
+// or groups prefixed with "group:". An empty subject list doesn't restrict anything.
+type EnvironmentPolicyRule struct {
+	// Tier the rule applies to, all tiers when empty
+	Tier string `json:"tier,omitempty"`
+	// Creators may create Environments of the tier or move an Environment into it
+	Creators []string `json:"creators,omitempty"`
+	// QuotaThreshold is the quota, by ResourceQuota key (e.g. requests.cpu), above which only QuotaManagers
+	// may raise an Environment quota
+	QuotaThreshold corev1.ResourceList `json:"quotaThreshold,omitempty"`
+	QuotaManagers  []string            `json:"quotaManagers,omitempty"`
+	// QuotaAutoApproval is the quota, by ResourceQuota key, up to which a QuotaRequest is approved without
+	// approver. Raising a key that isn't listed requires an approval.
+	QuotaAutoApproval corev1.ResourceList `json:"quotaAutoApproval,omitempty"`
+	// AdminGranters may give the admin role to Environment users
+	AdminGranters []string `json:"adminGranters,omitempty"`
+	// RequestApprovers approve the EnvironmentRequests of the tier. The requests of a tier without request
+	// approvers are materialised without approval.
+	RequestApprovers []string `json:"requestApprovers,omitempty"`
+	// AllowedRegistries restricts the registries, or registry paths, the workloads of the tier Environments
+	// may pull their images from
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+	// QuotaThresholds are the default quota usage thresholds of the tier Environments
+	QuotaThresholds *QuotaThresholds `json:"quotaThresholds,omitempty"`
+	// Expiry holds the expiry defaults of the non-production Environments of the tier
+	Expiry *ExpiryPolicy `json:"expiry,omitempty"`
+}
+
+// ExpiryPolicy holds the expiry defaults of the Environments of a tier
+type ExpiryPolicy struct {
+	// TTL is how long an Environment lives after its last activity, Environments don't expire when empty
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// WarningPeriod is how long before the expiry the owners are warned, 3 days when empty
+	WarningPeriod *metav1.Duration `json:"warningPeriod,omitempty"`
+	// Action applied to the Environment at expiry, Delete when empty
+	// +kubebuilder:validation:Enum=Delete;Hibernate
+	Action string `json:"action,omitempty"`
+}
+
+// EnvironmentPolicySpec defines the rules enforced by the admission webhooks
+type EnvironmentPolicySpec struct {
+	Rules []EnvironmentPolicyRule `json:"rules"`
+}
+
+// EnvironmentPolicy is the Schema for the environmentpolicies API. The rules of every EnvironmentPolicy
+// must allow a change for it to be admitted.
+// +kubebuilder:resource:path=environmentpolicies,scope=Cluster
+type EnvironmentPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EnvironmentPolicySpec `json:"spec,omitempty"`
+}
+
+// EnvironmentPolicyList contains a list of EnvironmentPolicy
+type EnvironmentPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EnvironmentPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EnvironmentPolicy{}, &EnvironmentPolicyList{})
+}
@@ -0,0 +1,91 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EnvironmentPromotion phases
+const (
+	PromotionPending  = "Pending"
+	PromotionPromoted = "Promoted"
+	PromotionFailed   = "Failed"
+	PromotionRejected = "Rejected"
+)
+
+// EnvironmentPromotion object results
+const (
+	PromotionCreated   = "Created"
+	PromotionUpdated   = "Updated"
+	PromotionUnchanged = "Unchanged"
+	PromotionError     = "Failed"
+)
+
+// PromotedByAnnotation is set on the promoted objects to the name of the EnvironmentPromotion that last wrote them
+const PromotedByAnnotation = "onboarding.beopenit.com/promoted-by"
+
+// PromotionOverrides defines the changes made to the promoted objects for the target Environment
+type PromotionOverrides struct {
+	// Images maps an image repository (e.g. registry.example.com/shop/web) to the tag promoted
+	Images map[string]string `json:"images,omitempty"`
+	// Replicas maps a Deployment name to its replicas in the target Environment
+	Replicas map[string]int32 `json:"replicas,omitempty"`
+}
+
+// EnvironmentPromotionSpec defines the objects promoted from an Environment Namespace into another one
+type EnvironmentPromotionSpec struct {
+	// Source is the name of the Environment the objects are promoted from
+	Source string `json:"source" validate:"required"`
+	// Target is the name of the Environment the objects are promoted into
+	Target string `json:"target" validate:"required"`
+	// Selector selects the objects promoted in the Namespace of the source Environment
+	Selector metav1.LabelSelector `json:"selector"`
+	// Kinds lists the kinds of the objects promoted, among ConfigMap, Secret and Deployment. Defaults to ConfigMap and Deployment.
+	Kinds     []string           `json:"kinds,omitempty"`
+	Overrides PromotionOverrides `json:"overrides,omitempty"`
+	// Approved allows the promotion into a production Environment. ApprovedBy must be one of the target
+	// Environment approvers, the EnvironmentPromotion webhook checks that it is the approving user.
+	Approved   bool   `json:"approved,omitempty"`
+	ApprovedBy string `json:"approvedBy,omitempty"`
+}
+
+// PromotionResult is the outcome of the promotion of an object (Created, Updated, Unchanged, Failed)
+type PromotionResult struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Result  string `json:"result"`
+	Message string `json:"message,omitempty"`
+}
+
+// EnvironmentPromotionStatus defines the observed state of EnvironmentPromotion (Pending, Promoted, Failed, Rejected)
+type EnvironmentPromotionStatus struct {
+	Phase      string            `json:"phase,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	Results    []PromotionResult `json:"results,omitempty"`
+	PromotedAt *metav1.Time      `json:"promotedAt,omitempty"`
+}
+
+// EnvironmentPromotion is the Schema for the environmentpromotions API
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=environmentpromotions,scope=Cluster
+// +kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.spec.source`
+// +kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.spec.target`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Promoted",type=string,JSONPath=`.status.promotedAt`
+type EnvironmentPromotion struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EnvironmentPromotionSpec   `json:"spec,omitempty"`
+	Status EnvironmentPromotionStatus `json:"status,omitempty"`
+}
+
+// EnvironmentPromotionList contains a list of EnvironmentPromotion
+type EnvironmentPromotionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EnvironmentPromotion `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EnvironmentPromotion{}, &EnvironmentPromotionList{})
+}
@@ -0,0 +1,97 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EnvironmentRequest phases
+const (
+	EnvironmentRequestPending      = "Pending"
+	EnvironmentRequestProvisioning = "Provisioning"
+	EnvironmentRequestReady        = "Ready"
+	EnvironmentRequestRejected     = "Rejected"
+	EnvironmentRequestDeleted      = "Deleted"
+)
+
+// EnvironmentRequestAnnotation is set on the Environments materialised from an EnvironmentRequest to the
+// namespace/name of the request
+const EnvironmentRequestAnnotation = "onboarding.beopenit.com/environment-request"
+
+// EnvironmentRequestSpec defines the Environment requested by a team without cluster-scope rights
+type EnvironmentRequestSpec struct {
+	// EnvironmentName is the name of the requested Environment, <namespace>-<name> of the request when empty
+	EnvironmentName string `json:"environmentName,omitempty"`
+	// Environment is the spec of the requested Environment. Adopt, Approvers and Bootstrap can't be requested, the
+	// Users are derived from the requester, and CloneFrom is limited to an Environment the requester administers.
+	Environment EnvironmentSpec `json:"environment"`
+	// RequestedBy is the user creating the request, checked with the EnvironmentPolicies by the
+	// EnvironmentRequest webhook
+	RequestedBy string `json:"requestedBy" validate:"required"`
+	// Approved grants a request of a tier whose EnvironmentPolicy rules list request approvers. The
+	// EnvironmentRequest webhook checks that ApprovedBy is the approving user, one of the request approvers.
+	Approved   bool   `json:"approved,omitempty"`
+	ApprovedBy string `json:"approvedBy,omitempty"`
+}
+
+// EnvironmentRequestStatus defines the observed state of EnvironmentRequest (Pending, Provisioning, Ready,
+// Rejected, Deleted), mirrored from the materialised Environment
+type EnvironmentRequestStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Environment is the name of the materialised Environment
+	Environment string `json:"environment,omitempty"`
+	// Namespace is the namespace assigned to the Environment
+	Namespace string `json:"namespace,omitempty"`
+	// EnvironmentStatus is the status of the Environment, Pending or Ready
+	EnvironmentStatus string `json:"environmentStatus,omitempty"`
+	// PendingChanges lists the changes of a production Environment waiting for approval
+	PendingChanges []string     `json:"pendingChanges,omitempty"`
+	CreatedAt      *metav1.Time `json:"createdAt,omitempty"`
+}
+
+// EnvironmentRequest is the Schema for the environmentrequests API
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=environmentrequests,scope=Namespaced
+// +kubebuilder:printcolumn:name="Environment",type=string,JSONPath=`.status.environment`
+// +kubebuilder:printcolumn:name="Namespace",type=string,JSONPath=`.status.namespace`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+type EnvironmentRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EnvironmentRequestSpec   `json:"spec,omitempty"`
+	Status EnvironmentRequestStatus `json:"status,omitempty"`
+}
+
+// EnvironmentName returns the name of the Environment materialised from the request
+func (in *EnvironmentRequest) EnvironmentName() string {
+	if in.Spec.EnvironmentName != "" {
+		return in.Spec.EnvironmentName
+	}
+	return in.Namespace + "-" + in.Name
+}
+
+// RequestedEnvironment returns the Environment materialised from the request, annotated with the request, the
+// requester being its only user, as admin
+func (in *EnvironmentRequest) RequestedEnvironment() *Environment {
+	env := &Environment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        in.EnvironmentName(),
+			Annotations: map[string]string{EnvironmentRequestAnnotation: in.Namespace + "/" + in.Name},
+		},
+		Spec: *in.Spec.Environment.DeepCopy(),
+	}
+	env.Spec.Users = []User{{Username: in.Spec.RequestedBy, Role: "admin"}}
+	return env
+}
+
+// EnvironmentRequestList contains a list of EnvironmentRequest
+type EnvironmentRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EnvironmentRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EnvironmentRequest{}, &EnvironmentRequestList{})
+}
@@ -0,0 +1,74 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuotaRequest phases
+const (
+	QuotaRequestPending  = "Pending"
+	QuotaRequestApplying = "Applying"
+	QuotaRequestApplied  = "Applied"
+	QuotaRequestExpired  = "Expired"
+	QuotaRequestRejected = "Rejected"
+)
+
+// QuotaRequestSpec defines the resources and storage requested for the Environment of the QuotaRequest namespace
+type QuotaRequestSpec struct {
+	// Resources requested for the Environment, they replace its resources once approved
+	Resources `json:"resources" validate:"required"`
+	// +kubebuilder:validation:Pattern=`^(\d+(e\d+)?|\d+(\.\d+)?(e\d+)?[EPTGMK]i?)$`
+	Storage string `json:"storage" validate:"required"`
+	// Duration makes the request temporary: the previous resources and storage are restored once it elapsed
+	Duration      *metav1.Duration `json:"duration,omitempty"`
+	Justification string           `json:"justification" validate:"required"`
+	// RequestedBy is the user creating the request, checked by the QuotaRequest webhook
+	RequestedBy string `json:"requestedBy" validate:"required"`
+	// Approved grants a request above the auto-approval thresholds of the EnvironmentPolicies. The QuotaRequest
+	// webhook checks that ApprovedBy is the approving user, an approver of the Environment or a quota manager.
+	Approved   bool   `json:"approved,omitempty"`
+	ApprovedBy string `json:"approvedBy,omitempty"`
+}
+
+// QuotaRequestStatus defines the observed state of QuotaRequest (Pending, Applying, Applied, Expired, Rejected)
+type QuotaRequestStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Environment is the Environment of the namespace
+	Environment string `json:"environment,omitempty"`
+	// AutoApproved tells whether the request was below the auto-approval thresholds
+	AutoApproved bool `json:"autoApproved,omitempty"`
+	// Changes lists the changes applied to the Environment as "field old -> new"
+	Changes []string `json:"changes,omitempty"`
+	// PreviousResources and PreviousStorage are the Environment values before the request, restored at the expiry
+	// of a temporary request
+	PreviousResources *Resources   `json:"previousResources,omitempty"`
+	PreviousStorage   string       `json:"previousStorage,omitempty"`
+	AppliedAt         *metav1.Time `json:"appliedAt,omitempty"`
+	ExpiresAt         *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// QuotaRequest is the Schema for the quotarequests API
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=quotarequests,scope=Namespaced
+// +kubebuilder:printcolumn:name="Requested By",type=string,JSONPath=`.spec.requestedBy`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Expires",type=string,JSONPath=`.status.expiresAt`
+type QuotaRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   QuotaRequestSpec   `json:"spec,omitempty"`
+	Status QuotaRequestStatus `json:"status,omitempty"`
+}
+
+// QuotaRequestList contains a list of QuotaRequest
+type QuotaRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuotaRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&QuotaRequest{}, &QuotaRequestList{})
+}
@@ -0,0 +1,157 @@
+package capacity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Resources are the resources compared, the ones of the Environment requests
+var Resources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage}
+
+// Report compares the requests of the Environments with the capacity of the cluster
+type Report struct {
+	Time metav1.Time `json:"time"`
+	// Nodes is the number of schedulable nodes
+	Nodes        int              `json:"nodes"`
+	Environments int              `json:"environments"`
+	Resources    []ResourceReport `json:"resources"`
+}
+
+// ResourceReport is the capacity of a resource: the allocatable resource of the schedulable nodes multiplied by the
+// overcommit ratio, and the sum of the Environment requests
+type ResourceReport struct {
+	Name            corev1.ResourceName `json:"name"`
+	Allocatable     resource.Quantity   `json:"allocatable"`
+	OvercommitRatio resource.Quantity   `json:"overcommitRatio"`
+	Capacity        resource.Quantity   `json:"capacity"`
+	Requested       resource.Quantity   `json:"requested"`
+	// Available is negative when the Environments request more than the capacity
+	Available    resource.Quantity `json:"available"`
+	UsagePercent int64             `json:"usagePercent"`
+}
+
+// Collect lists the nodes and the Environments and returns their capacity report
+func Collect(ctx context.Context, c client.Reader, ratios corev1.ResourceList) (*Report, error) {
+	nodes := &corev1.NodeList{}
+	if err := c.List(ctx, nodes); err != nil {
+		return nil, err
+	}
+	envs := &onboardingv1alpha1.EnvironmentList{}
+	if err := c.List(ctx, envs); err != nil {
+		return nil, err
+	}
+	return Compute(nodes.Items, envs.Items, ratios), nil
+}
+
+// Compute returns the capacity report of the nodes and the Environments. The cordoned nodes don't add capacity and
+// the Environments being deleted don't request any.
+func Compute(nodes []corev1.Node, envs []onboardingv1alpha1.Environment, ratios corev1.ResourceList) *Report {
+	report := &Report{Time: metav1.Now()}
+	allocatable := corev1.ResourceList{}
+	for _, node := range nodes {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		report.Nodes++
+		add(allocatable, node.Status.Allocatable)
+	}
+	requested := corev1.ResourceList{}
+	for i := range envs {
+		if envs[i].DeletionTimestamp != nil {
+			continue
+		}
+		report.Environments++
+		add(requested, Requests(&envs[i]))
+	}
+
+	for _, name := range Resources {
+		ratio, found := ratios[name]
+		if !found {
+			ratio = resource.MustParse("1")
+		}
+		r := ResourceReport{
+			Name:            name,
+			Allocatable:     allocatable[name],
+			OvercommitRatio: ratio,
+			Capacity:        multiply(allocatable[name], ratio),
+			Requested:       requested[name],
+		}
+		r.Available = r.Capacity.DeepCopy()
+		r.Available.Sub(r.Requested)
+		if capacity := r.Capacity.MilliValue(); capacity > 0 {
+			r.UsagePercent = int64(float64(r.Requested.MilliValue()) * 100 / float64(capacity))
+		}
+		report.Resources = append(report.Resources, r)
+	}
+	return report
+}
+
+// Check returns the reason why env doesn't fit in the capacity, or an empty string. old is the previous version of
+// env included in the report, nil on creation. Only the raised requests are checked: an Environment can still be
+// changed or shrunk when the cluster is already above its capacity.
+func (r *Report) Check(old, env *onboardingv1alpha1.Environment) string {
+	before := corev1.ResourceList{}
+	if old != nil && old.DeletionTimestamp == nil {
+		before = Requests(old)
+	}
+	after := Requests(env)
+	var exceeded []string
+	for _, res := range r.Resources {
+		raise := after[res.Name]
+		raise.Sub(before[res.Name])
+		if raise.Sign() <= 0 {
+			continue
+		}
+		total := res.Requested.DeepCopy()
+		total.Add(raise)
+		if total.Cmp(res.Capacity) > 0 {
+			exceeded = append(exceeded, fmt.Sprintf("requests.%s %s of the Environments above the cluster capacity %s (%s allocatable x %s)",
+				res.Name, total.String(), res.Capacity.String(), res.Allocatable.String(), res.OvercommitRatio.String()))
+		}
+	}
+	if len(exceeded) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Environment %s doesn't fit in the cluster: %s", env.Name, strings.Join(exceeded, ", "))
+}
+
+// Requests returns the requests of the Environment quota, the invalid quantities being ignored
+func Requests(env *onboardingv1alpha1.Environment) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for name, value := range map[corev1.ResourceName]string{
+		corev1.ResourceCPU:              env.Spec.ResourceRequests.CPU,
+		corev1.ResourceMemory:           env.Spec.ResourceRequests.Memory,
+		corev1.ResourceEphemeralStorage: env.Spec.ResourceRequests.EphemeralStorage,
+	} {
+		if quantity, err := resource.ParseQuantity(value); err == nil {
+			requests[name] = quantity
+		}
+	}
+	return requests
+}
+
+// add adds the quantities of list to total
+func add(total, list corev1.ResourceList) {
+	for name, quantity := range list {
+		sum := total[name]
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
+
+// multiply returns the quantity multiplied by the ratio, in the format of the quantity
+func multiply(quantity, ratio resource.Quantity) resource.Quantity {
+	format := quantity.Format
+	if format == "" {
+		format = resource.DecimalSI
+	}
+	milli := float64(quantity.MilliValue()) * float64(ratio.MilliValue()) / 1000
+	return *resource.NewMilliQuantity(int64(milli), format)
+}
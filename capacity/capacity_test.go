@@ -0,0 +1,115 @@
+package capacity
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	configv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/config/v1alpha1"
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/operatorconfig"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newNode(name, cpu, memory string, unschedulable bool) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.NodeSpec{Unschedulable: unschedulable},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			},
+		},
+	}
+}
+
+func newEnvironment(name, cpu, memory string) onboardingv1alpha1.Environment {
+	env := onboardingv1alpha1.Environment{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	env.Spec.ResourceRequests = onboardingv1alpha1.ResourceDescription{CPU: cpu, Memory: memory}
+	return env
+}
+
+func TestCheck(t *testing.T) {
+	nodes := []corev1.Node{
+		newNode("node1", "4", "8Gi", false),
+		newNode("node2", "4", "8Gi", false),
+		newNode("cordoned", "4", "8Gi", true),
+	}
+	envs := []onboardingv1alpha1.Environment{
+		newEnvironment("environment1", "8", "8Gi"),
+		newEnvironment("environment2", "4", "4Gi"),
+	}
+	ratios := corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1.5")}
+
+	report := Compute(nodes, envs, ratios)
+	if report.Nodes != 2 || report.Environments != 2 || len(report.Resources) != len(Resources) {
+		t.Fatalf("unexpected report: %v", report)
+	}
+	cpu := report.Resources[0]
+	if cpu.Capacity.Cmp(resource.MustParse("12")) != 0 || cpu.Requested.Cmp(resource.MustParse("12")) != 0 || cpu.UsagePercent != 100 {
+		t.Errorf("expected 12 cpu requested out of 12, got %v", cpu)
+	}
+	memory := report.Resources[1]
+	if memory.Available.Cmp(resource.MustParse("4Gi")) != 0 || memory.UsagePercent != 75 {
+		t.Errorf("expected 4Gi memory available, got %v", memory)
+	}
+
+	old := envs[1].DeepCopy()
+	tests := []struct {
+		name    string
+		old     *onboardingv1alpha1.Environment
+		env     onboardingv1alpha1.Environment
+		allowed bool
+	}{
+		{"new Environment above the cpu capacity", nil, newEnvironment("new", "1", "1Gi"), false},
+		{"new Environment without cpu", nil, newEnvironment("new", "", "4Gi"), true},
+		{"new Environment above the memory capacity", nil, newEnvironment("new", "", "5Gi"), false},
+		{"enlarged Environment", old, newEnvironment("environment2", "5", "4Gi"), false},
+		{"unchanged Environment", old, newEnvironment("environment2", "4", "4Gi"), true},
+		{"shrunk Environment", old, newEnvironment("environment2", "2", "8Gi"), true},
+	}
+	for _, test := range tests {
+		reason := report.Check(test.old, &test.env)
+		if allowed := reason == ""; allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", test.name, test.allowed, reason)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	cfg := configv1alpha1.NewOperatorConfig()
+	cfg.Capacity.Namespace = "onboarding"
+	operatorconfig.Set(cfg)
+	defer operatorconfig.Set(configv1alpha1.NewOperatorConfig())
+
+	node := newNode("node1", "4", "8Gi", false)
+	env := newEnvironment("environment1", "2", "2Gi")
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, &onboardingv1alpha1.Environment{}, &onboardingv1alpha1.EnvironmentList{})
+	r := &Reporter{Client: fake.NewFakeClientWithScheme(s, &node, &env)}
+
+	// The report is created, then updated
+	for i := 0; i < 2; i++ {
+		if err := r.Publish(context.TODO()); err != nil {
+			t.Fatalf("publish: (%v)", err)
+		}
+	}
+	cm := &corev1.ConfigMap{}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Name: ReportName, Namespace: "onboarding"}, cm); err != nil {
+		t.Fatalf("get configmap: (%v)", err)
+	}
+	report := &Report{}
+	if err := json.Unmarshal([]byte(cm.Data[ReportKey]), report); err != nil {
+		t.Fatalf("unmarshal report: (%v)", err)
+	}
+	if report.Nodes != 1 || len(report.Resources) != len(Resources) || report.Resources[0].UsagePercent != 50 {
+		t.Errorf("unexpected report: %v", report)
+	}
+}
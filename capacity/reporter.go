@@ -0,0 +1,105 @@
+package capacity
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/operatorconfig"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var log = logf.Log.WithName("capacity")
+
+// ReportName is the name of the capacity report ConfigMap
+const ReportName = "onboarding-capacity-report"
+
+// ReportKey is the key of the JSON report in the ConfigMap
+const ReportKey = "report.json"
+
+var (
+	capacityGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "onboarding_cluster_capacity",
+		Help: "Allocatable resources of the schedulable nodes multiplied by the overcommit ratio",
+	}, []string{"resource"})
+
+	requestedGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "onboarding_cluster_requested",
+		Help: "Sum of the Environment quota requests",
+	}, []string{"resource"})
+)
+
+func init() {
+	// Register the metrics in the controller-runtime registry served on the metrics port
+	metrics.Registry.MustRegister(capacityGauge, requestedGauge)
+}
+
+// Reporter publishes the capacity report every Interval as metrics and as the ReportName ConfigMap of the
+// capacity namespace of the operator configuration
+type Reporter struct {
+	Client   client.Client
+	Interval time.Duration
+}
+
+// Start publishes the report until stop is closed
+func (r *Reporter) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Publish(context.TODO()); err != nil {
+			log.Error(err, "Failed to publish the capacity report")
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection tells the Manager to only start the reporter in the elected replica
+func (r *Reporter) NeedLeaderElection() bool {
+	return true
+}
+
+// Publish computes the report and publishes it. Out of a cluster, without a namespace, only the metrics are set.
+func (r *Reporter) Publish(ctx context.Context) error {
+	cfg := operatorconfig.Get().Capacity
+	report, err := Collect(ctx, r.Client, cfg.OvercommitRatio)
+	if err != nil {
+		return err
+	}
+	for _, res := range report.Resources {
+		capacityGauge.WithLabelValues(string(res.Name)).Set(float64(res.Capacity.MilliValue()) / 1000)
+		requestedGauge.WithLabelValues(string(res.Name)).Set(float64(res.Requested.MilliValue()) / 1000)
+	}
+	if cfg.Namespace == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: ReportName, Namespace: cfg.Namespace}, cm)
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: ReportName, Namespace: cfg.Namespace},
+			Data:       map[string]string{ReportKey: string(data)},
+		}
+		return r.Client.Create(ctx, cm)
+	}
+	if err != nil {
+		return err
+	}
+	cm.Data = map[string]string{ReportKey: string(data)}
+	return r.Client.Update(ctx, cm)
+}
@@ -0,0 +1,373 @@
+package accessrequest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/operatorconfig"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/sharding"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_accessrequest")
+
+// environmentNotFoundRetry is the delay before checking again an AccessRequest targeting a missing Environment
+const environmentNotFoundRetry = time.Minute
+
+// Add creates a new AccessRequest Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileAccessRequest{
+		client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetEventRecorderFor("accessrequest-controller"),
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("accessrequest-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Only the requests on the Environments of the shard of the operator instance are reconciled
+	requested := sharding.Current.RelatedPredicate(mgr.GetClient(), requestedEnvironment)
+	owned := sharding.Current.RelatedPredicate(mgr.GetClient(), func(meta metav1.Object, _ runtime.Object) (string, error) {
+		owner := metav1.GetControllerOf(meta)
+		if owner == nil || owner.Kind != "AccessRequest" {
+			return "", nil
+		}
+		ar := &onboardingv1alpha1.AccessRequest{}
+		if err := mgr.GetClient().Get(context.TODO(), types.NamespacedName{Name: owner.Name}, ar); err != nil {
+			return "", client.IgnoreNotFound(err)
+		}
+		return ar.Spec.Environment, nil
+	})
+
+	// Watch for changes to primary resource AccessRequest
+	err = c.Watch(&source.Kind{Type: &onboardingv1alpha1.AccessRequest{}}, &handler.EnqueueRequestForObject{}, requested)
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to secondary resource RoleBinding and requeue the owner AccessRequest
+	err = c.Watch(&source.Kind{Type: &v1.RoleBinding{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &onboardingv1alpha1.AccessRequest{},
+	}, owned)
+	if err != nil {
+		return err
+	}
+
+	// An Environment relabelled into the shard brings its requests along, e.g. to remove an expired access
+	if sharding.Current.Enabled() {
+		err = c.Watch(&source.Kind{Type: &onboardingv1alpha1.Environment{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+				requests := &onboardingv1alpha1.AccessRequestList{}
+				if err := mgr.GetClient().List(context.TODO(), requests); err != nil {
+					log.Error(err, "Failed to list the AccessRequests of the Environment", "Environment", a.Meta.GetName())
+					return nil
+				}
+				var result []reconcile.Request
+				for _, ar := range requests.Items {
+					if ar.Spec.Environment == a.Meta.GetName() {
+						result = append(result, reconcile.Request{NamespacedName: types.NamespacedName{Name: ar.Name}})
+					}
+				}
+				return result
+			}),
+		}, sharding.Current.EnteringPredicate())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestedEnvironment returns the Environment of an AccessRequest, for the shard predicate
+func requestedEnvironment(_ metav1.Object, obj runtime.Object) (string, error) {
+	if ar, ok := obj.(*onboardingv1alpha1.AccessRequest); ok {
+		return ar.Spec.Environment, nil
+	}
+	return "", nil
+}
+
+// blank assignment to verify that ReconcileAccessRequest implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileAccessRequest{}
+
+// ReconcileAccessRequest reconciles an AccessRequest object
+type ReconcileAccessRequest struct {
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+// Reconcile grants the role of an approved AccessRequest through a temporary RoleBinding in the Environment
+// namespace and removes it once the request has expired. Every transition is kept in the request audit log.
+func (r *ReconcileAccessRequest) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := log.WithValues("AccessRequest Name", request.Name)
+	reqLogger.Info("Reconciling AccessRequest")
+
+	// Fetch the AccessRequest instance
+	instance := &onboardingv1alpha1.AccessRequest{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// The temporary RoleBinding is owned by the request and garbage collected with it
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// The request is handled by the operator instance of the shard of its Environment
+	owned, err := sharding.Current.OwnsEnvironment(context.TODO(), r.client, instance.Spec.Environment)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !owned {
+		reqLogger.Info("AccessRequest Environment belongs to another shard", "Environment", instance.Spec.Environment)
+		return reconcile.Result{}, nil
+	}
+
+	switch instance.Status.Phase {
+	case onboardingv1alpha1.AccessRequestExpired, onboardingv1alpha1.AccessRequestRejected, onboardingv1alpha1.AccessRequestRevoked:
+		// Terminal phases, a new request must be created to get access again
+		return reconcile.Result{}, nil
+	case "":
+		r.audit(instance, "Requested", instance.Spec.Username, instance.Spec.Justification)
+		instance.Status.Phase = onboardingv1alpha1.AccessRequestPending
+		return reconcile.Result{}, r.client.Status().Update(context.TODO(), instance)
+	}
+
+	if instance.Status.Phase == onboardingv1alpha1.AccessRequestActive {
+		return r.reconcileActive(instance)
+	}
+
+	// Pending: wait for the Environment and the approval
+	env := &onboardingv1alpha1.Environment{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Environment}, env)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			instance.Status.Message = fmt.Sprintf("Environment %s not found", instance.Spec.Environment)
+			if err := r.client.Status().Update(context.TODO(), instance); err != nil {
+				return reconcile.Result{}, err
+			}
+			return reconcile.Result{RequeueAfter: environmentNotFoundRetry}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	if reason := validate(instance); reason != "" {
+		return reconcile.Result{}, r.reject(instance, reason)
+	}
+	if !instance.Spec.Approved {
+		instance.Status.Message = "Waiting for approval"
+		return reconcile.Result{}, r.client.Status().Update(context.TODO(), instance)
+	}
+	if reason := checkApproval(instance, env); reason != "" {
+		return reconcile.Result{}, r.reject(instance, reason)
+	}
+
+	// Approved: grant the role
+	r.audit(instance, "Approved", instance.Spec.ApprovedBy, "")
+	rolebinding := newRoleBindingForRequest(instance, env)
+	if err := controllerutil.SetControllerReference(instance, rolebinding, r.scheme); err != nil {
+		return reconcile.Result{}, err
+	}
+	reqLogger.Info("Creating a temporary RoleBinding", "RoleBinding.Namespace", rolebinding.Namespace, "RoleBinding.Name", rolebinding.Name)
+	if err := r.client.Create(context.TODO(), rolebinding); err != nil && !errors.IsAlreadyExists(err) {
+		return reconcile.Result{}, err
+	}
+	now := metav1.Now()
+	expiresAt := metav1.NewTime(now.Add(instance.Spec.Duration.Duration))
+	instance.Status.Phase = onboardingv1alpha1.AccessRequestActive
+	instance.Status.Namespace = rolebinding.Namespace
+	instance.Status.RoleBinding = rolebinding.Name
+	instance.Status.GrantedAt = &now
+	instance.Status.ExpiresAt = &expiresAt
+	instance.Status.Message = fmt.Sprintf("Role %s granted to %s until %s", instance.Spec.Role, instance.Spec.Username, expiresAt.UTC().Format(time.RFC3339))
+	r.audit(instance, "Granted", instance.Spec.ApprovedBy, instance.Status.Message)
+	if err := r.client.Status().Update(context.TODO(), instance); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: instance.Spec.Duration.Duration}, nil
+}
+
+// reconcileActive keeps the temporary RoleBinding of an active request until it expires or its approval is
+// withdrawn, then revokes it
+func (r *ReconcileAccessRequest) reconcileActive(instance *onboardingv1alpha1.AccessRequest) (reconcile.Result, error) {
+	reqLogger := log.WithValues("AccessRequest Name", instance.Name)
+
+	if !instance.Spec.Approved {
+		// Withdrawn approval: revoke the role before its expiry
+		return reconcile.Result{}, r.revoke(instance, onboardingv1alpha1.AccessRequestRevoked,
+			fmt.Sprintf("Approval withdrawn, role %s revoked from %s", instance.Spec.Role, instance.Spec.Username))
+	}
+
+	remaining := time.Until(instance.Status.ExpiresAt.Time)
+	if remaining > 0 {
+		// Recreate the RoleBinding if it was removed before the expiry
+		foundRb := &v1.RoleBinding{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Status.RoleBinding, Namespace: instance.Status.Namespace}, foundRb)
+		if err != nil && errors.IsNotFound(err) {
+			env := &onboardingv1alpha1.Environment{}
+			if err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Environment}, env); err != nil {
+				return reconcile.Result{}, err
+			}
+			rolebinding := newRoleBindingForRequest(instance, env)
+			if err := controllerutil.SetControllerReference(instance, rolebinding, r.scheme); err != nil {
+				return reconcile.Result{}, err
+			}
+			reqLogger.Info("Restoring the temporary RoleBinding", "RoleBinding.Namespace", rolebinding.Namespace, "RoleBinding.Name", rolebinding.Name)
+			if err := r.client.Create(context.TODO(), rolebinding); err != nil {
+				return reconcile.Result{}, err
+			}
+		} else if err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{RequeueAfter: remaining}, nil
+	}
+
+	// Expired: revoke the role
+	return reconcile.Result{}, r.revoke(instance, onboardingv1alpha1.AccessRequestExpired,
+		fmt.Sprintf("Role %s revoked from %s", instance.Spec.Role, instance.Spec.Username))
+}
+
+// revoke deletes the temporary RoleBinding of an active request and moves it to the given terminal phase
+func (r *ReconcileAccessRequest) revoke(instance *onboardingv1alpha1.AccessRequest, phase, message string) error {
+	foundRb := &v1.RoleBinding{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Status.RoleBinding, Namespace: instance.Status.Namespace}, foundRb)
+	if err == nil {
+		log.Info("Deleting the temporary RoleBinding", "AccessRequest Name", instance.Name,
+			"RoleBinding.Namespace", foundRb.Namespace, "RoleBinding.Name", foundRb.Name)
+		if err := r.client.Delete(context.TODO(), foundRb); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	instance.Status.Phase = phase
+	instance.Status.Message = message
+	r.audit(instance, "Revoked", "", message)
+	return r.client.Status().Update(context.TODO(), instance)
+}
+
+// reject moves the request to the Rejected phase with the given reason
+func (r *ReconcileAccessRequest) reject(instance *onboardingv1alpha1.AccessRequest, reason string) error {
+	instance.Status.Phase = onboardingv1alpha1.AccessRequestRejected
+	instance.Status.Message = reason
+	r.audit(instance, "Rejected", instance.Spec.ApprovedBy, reason)
+	return r.client.Status().Update(context.TODO(), instance)
+}
+
+// audit appends a record to the request audit log and mirrors it as an event and a log line
+func (r *ReconcileAccessRequest) audit(instance *onboardingv1alpha1.AccessRequest, action, actor, message string) {
+	instance.Status.AuditLog = append(instance.Status.AuditLog, onboardingv1alpha1.AccessRequestAuditRecord{
+		Time:    metav1.Now(),
+		Action:  action,
+		Actor:   actor,
+		Message: message,
+	})
+	eventType := corev1.EventTypeNormal
+	if action == "Rejected" {
+		eventType = corev1.EventTypeWarning
+	}
+	if r.recorder != nil {
+		r.recorder.Event(instance, eventType, action, fmt.Sprintf("%s: %s", actor, message))
+	}
+	log.Info("AccessRequest audit", "AccessRequest Name", instance.Name, "Environment", instance.Spec.Environment,
+		"User", instance.Spec.Username, "Role", instance.Spec.Role, "Action", action, "Actor", actor, "Message", message)
+}
+
+// validate returns the reason why the request can't be granted, or an empty string
+func validate(ar *onboardingv1alpha1.AccessRequest) string {
+	if clusterRoleForRole(ar.Spec.Role) == "" {
+		return fmt.Sprintf("unknown role %q", ar.Spec.Role)
+	}
+	if ar.Spec.Duration.Duration <= 0 {
+		return "duration must be positive"
+	}
+	if ar.Spec.Justification == "" {
+		return "a justification is required"
+	}
+	return ""
+}
+
+// checkApproval returns the reason why the approval isn't valid, or an empty string. The AccessRequest webhook
+// checked that ApprovedBy is the approving user.
+func checkApproval(ar *onboardingv1alpha1.AccessRequest, env *onboardingv1alpha1.Environment) string {
+	if ar.Spec.ApprovedBy != "" && ar.Spec.ApprovedBy == ar.Spec.Username {
+		return "a request can't be approved by its requester"
+	}
+	if len(env.Spec.Approvers) == 0 {
+		return fmt.Sprintf("Environment %s has no approvers, its access requests can't be approved", env.Name)
+	}
+	for _, approver := range env.Spec.Approvers {
+		if approver == ar.Spec.ApprovedBy {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%q is not an approver of Environment %s", ar.Spec.ApprovedBy, env.Name)
+}
+
+// clusterRoleForRole returns the ClusterRole granted for an Environment user role. Unlike the Environment
+// RoleBindings, the dev role is elevated to admin in production: that's the purpose of a break-glass access.
+func clusterRoleForRole(role string) string {
+	switch role {
+	case "admin", "dev":
+		return operatorconfig.Get().ClusterRoles.Admin
+	case "viewer":
+		return operatorconfig.Get().ClusterRoles.Viewer
+	}
+	return ""
+}
+
+// newRoleBindingForRequest returns the temporary rolebinding granting the requested role in the Environment namespace
+func newRoleBindingForRequest(ar *onboardingv1alpha1.AccessRequest, env *onboardingv1alpha1.Environment) *v1.RoleBinding {
+	labels := map[string]string{}
+	for k, v := range env.Labels {
+		labels[k] = v
+	}
+	labels["onboarding.beopenit.com/access-request"] = ar.Name
+	return &v1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      operatorconfig.Get().ObjectNames.AccessRoleBindingPrefix + ar.Name,
+			Namespace: env.Spec.Name,
+			Labels:    labels,
+		},
+		Subjects: []v1.Subject{
+			{
+				Kind: "User",
+				Name: ar.Spec.Username,
+			},
+		},
+		RoleRef: v1.RoleRef{
+			Name:     clusterRoleForRole(ar.Spec.Role),
+			Kind:     "ClusterRole",
+			APIGroup: "rbac.authorization.k8s.io",
+		},
+	}
+}
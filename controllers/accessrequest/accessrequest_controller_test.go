@@ -0,0 +1,196 @@
+package accessrequest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	name        = "break-glass"
+	envName     = "environment"
+	projectname = "project1"
+
+	environment = &onboardingv1alpha1.Environment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: envName,
+		},
+		Spec: onboardingv1alpha1.EnvironmentSpec{
+			Name:      projectname,
+			IsProd:    true,
+			Approvers: []string{"approver1"},
+		},
+	}
+)
+
+func newAccessRequest(approvedBy string) *onboardingv1alpha1.AccessRequest {
+	return &onboardingv1alpha1.AccessRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: onboardingv1alpha1.AccessRequestSpec{
+			Environment:   envName,
+			Username:      "user1",
+			Role:          "dev",
+			Duration:      metav1.Duration{Duration: time.Hour},
+			Justification: "incident INC-42",
+			Approved:      approvedBy != "",
+			ApprovedBy:    approvedBy,
+		},
+	}
+}
+
+func newTestReconciler(objs ...runtime.Object) *ReconcileAccessRequest {
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, &onboardingv1alpha1.Environment{}, &onboardingv1alpha1.AccessRequest{})
+	return &ReconcileAccessRequest{client: fake.NewFakeClient(objs...), scheme: s, recorder: record.NewFakeRecorder(10)}
+}
+
+func reconcileAccessRequest(t *testing.T, r *ReconcileAccessRequest) *onboardingv1alpha1.AccessRequest {
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	ar := &onboardingv1alpha1.AccessRequest{}
+	if err := r.client.Get(context.TODO(), req.NamespacedName, ar); err != nil {
+		t.Fatalf("get accessrequest: (%v)", err)
+	}
+	return ar
+}
+
+func TestAccessRequestGrantAndExpiry(t *testing.T) {
+	r := newTestReconciler(environment.DeepCopy(), newAccessRequest("approver1"))
+
+	ar := reconcileAccessRequest(t, r)
+	if ar.Status.Phase != onboardingv1alpha1.AccessRequestPending {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.AccessRequestPending, ar.Status.Phase)
+	}
+
+	ar = reconcileAccessRequest(t, r)
+	if ar.Status.Phase != onboardingv1alpha1.AccessRequestActive {
+		t.Fatalf("expected phase %s, got %s (%s)", onboardingv1alpha1.AccessRequestActive, ar.Status.Phase, ar.Status.Message)
+	}
+	rb := &v1.RoleBinding{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: "cno-access-" + name, Namespace: projectname}, rb)
+	if err != nil {
+		t.Fatalf("get rolebinding: (%v)", err)
+	}
+	if rb.RoleRef.Name != "cno-admin-cluster-role" || len(rb.Subjects) != 1 || rb.Subjects[0].Name != "user1" {
+		t.Errorf("unexpected temporary rolebinding: %v", rb)
+	}
+
+	// Move the expiry in the past
+	expired := metav1.NewTime(time.Now().Add(-time.Minute))
+	ar.Status.ExpiresAt = &expired
+	if err := r.client.Status().Update(context.TODO(), ar); err != nil {
+		t.Fatalf("update accessrequest: (%v)", err)
+	}
+	ar = reconcileAccessRequest(t, r)
+	if ar.Status.Phase != onboardingv1alpha1.AccessRequestExpired {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.AccessRequestExpired, ar.Status.Phase)
+	}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: "cno-access-" + name, Namespace: projectname}, rb)
+	if !errors.IsNotFound(err) {
+		t.Errorf("expected the temporary rolebinding to be deleted, got (%v)", err)
+	}
+
+	var actions []string
+	for _, record := range ar.Status.AuditLog {
+		actions = append(actions, record.Action)
+	}
+	expected := []string{"Requested", "Approved", "Granted", "Revoked"}
+	if len(actions) != len(expected) {
+		t.Fatalf("expected audit log %v, got %v", expected, actions)
+	}
+	for i := range expected {
+		if actions[i] != expected[i] {
+			t.Errorf("expected audit log %v, got %v", expected, actions)
+		}
+	}
+}
+
+func TestAccessRequestWithdrawnApproval(t *testing.T) {
+	r := newTestReconciler(environment.DeepCopy(), newAccessRequest("approver1"))
+
+	reconcileAccessRequest(t, r)
+	ar := reconcileAccessRequest(t, r)
+	if ar.Status.Phase != onboardingv1alpha1.AccessRequestActive {
+		t.Fatalf("expected phase %s, got %s (%s)", onboardingv1alpha1.AccessRequestActive, ar.Status.Phase, ar.Status.Message)
+	}
+
+	// Withdraw the approval before the expiry
+	ar.Spec.Approved, ar.Spec.ApprovedBy = false, ""
+	if err := r.client.Update(context.TODO(), ar); err != nil {
+		t.Fatalf("update accessrequest: (%v)", err)
+	}
+	ar = reconcileAccessRequest(t, r)
+	if ar.Status.Phase != onboardingv1alpha1.AccessRequestRevoked {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.AccessRequestRevoked, ar.Status.Phase)
+	}
+	rb := &v1.RoleBinding{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: "cno-access-" + name, Namespace: projectname}, rb)
+	if !errors.IsNotFound(err) {
+		t.Errorf("expected the temporary rolebinding to be deleted, got (%v)", err)
+	}
+	if last := ar.Status.AuditLog[len(ar.Status.AuditLog)-1]; last.Action != "Revoked" {
+		t.Errorf("expected the revocation in the audit log, got %v", last)
+	}
+
+	// A revoked request isn't granted again
+	ar.Spec.Approved, ar.Spec.ApprovedBy = true, "approver1"
+	if err := r.client.Update(context.TODO(), ar); err != nil {
+		t.Fatalf("update accessrequest: (%v)", err)
+	}
+	if ar = reconcileAccessRequest(t, r); ar.Status.Phase != onboardingv1alpha1.AccessRequestRevoked {
+		t.Errorf("expected phase %s, got %s", onboardingv1alpha1.AccessRequestRevoked, ar.Status.Phase)
+	}
+}
+
+func TestAccessRequestRejectsUnknownApprover(t *testing.T) {
+	r := newTestReconciler(environment.DeepCopy(), newAccessRequest("someone"))
+
+	reconcileAccessRequest(t, r)
+	ar := reconcileAccessRequest(t, r)
+	if ar.Status.Phase != onboardingv1alpha1.AccessRequestRejected {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.AccessRequestRejected, ar.Status.Phase)
+	}
+	rb := &v1.RoleBinding{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: "cno-access-" + name, Namespace: projectname}, rb)
+	if !errors.IsNotFound(err) {
+		t.Errorf("expected no rolebinding, got (%v)", err)
+	}
+}
+
+func TestAccessRequestWaitsForApproval(t *testing.T) {
+	r := newTestReconciler(environment.DeepCopy(), newAccessRequest(""))
+
+	reconcileAccessRequest(t, r)
+	ar := reconcileAccessRequest(t, r)
+	if ar.Status.Phase != onboardingv1alpha1.AccessRequestPending {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.AccessRequestPending, ar.Status.Phase)
+	}
+}
+
+func TestAccessRequestRejectsEnvironmentWithoutApprovers(t *testing.T) {
+	env := environment.DeepCopy()
+	env.Spec.Approvers = nil
+	r := newTestReconciler(env, newAccessRequest("approver1"))
+
+	reconcileAccessRequest(t, r)
+	ar := reconcileAccessRequest(t, r)
+	if ar.Status.Phase != onboardingv1alpha1.AccessRequestRejected {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.AccessRequestRejected, ar.Status.Phase)
+	}
+}
@@ -0,0 +1,10 @@
+package controller
+
+import (
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/controller/environmentpromotion"
+)
+
+func init() {
+	// AddToManagerFuncs is a list of functions to create controllers and add them to a manager.
+	AddToManagerFuncs = append(AddToManagerFuncs, environmentpromotion.Add)
+}
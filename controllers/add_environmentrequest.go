@@ -0,0 +1,11 @@
+package controller
+
+import (
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/controller/environmentrequest"
+)
+
+func init() {
+	// AddToManagerWithWebhooksFuncs is a list of functions to create the controllers acting on approvals and add
+	// them to a manager when the webhooks are served.
+	AddToManagerWithWebhooksFuncs = append(AddToManagerWithWebhooksFuncs, environmentrequest.Add)
+}
@@ -7,9 +7,17 @@ import (
 // AddToManagerFuncs is a list of functions to add all Controllers to the Manager
 var AddToManagerFuncs []func(manager.Manager) error
 
-// AddToManager adds all Controllers to the Manager
-func AddToManager(m manager.Manager) error {
-	for _, f := range AddToManagerFuncs {
+// AddToManagerWithWebhooksFuncs is a list of functions to add the Controllers acting on approvals to the Manager.
+// Their approvers are only checked by the admission webhooks, they aren't added when the webhooks aren't served.
+var AddToManagerWithWebhooksFuncs []func(manager.Manager) error
+
+// AddToManager adds all Controllers to the Manager, the ones acting on approvals only when webhooks is set
+func AddToManager(m manager.Manager, webhooks bool) error {
+	funcs := AddToManagerFuncs
+	if webhooks {
+		funcs = append(funcs[:len(funcs):len(funcs)], AddToManagerWithWebhooksFuncs...)
+	}
+	for _, f := range funcs {
 		if err := f(m); err != nil {
 			return err
 		}
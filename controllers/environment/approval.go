@@ -0,0 +1,137 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ApprovalWebhook tells whether the Environment webhook checks that the approval annotations are set by an
+// approver. The changes to production Environments stay pending without it. It is set from the manager flags.
+var ApprovalWebhook bool
+
+// requiresApproval tells whether the changes of the Environment must be approved before being applied.
+// Production Environments, and Environments leaving production, are gated.
+func requiresApproval(cr *onboardingv1alpha1.Environment) bool {
+	return cr.Spec.IsProd || (cr.Status.ApprovedSpec != nil && cr.Status.ApprovedSpec.IsProd)
+}
+
+// isApproved tells whether the current generation of the Environment has been approved. The approval annotations
+// are only trusted when the webhook checked them.
+func isApproved(cr *onboardingv1alpha1.Environment) bool {
+	return ApprovalWebhook && cr.Annotations[onboardingv1alpha1.ApprovedGenerationAnnotation] == strconv.FormatInt(cr.Generation, 10)
+}
+
+// setApprovalCondition reports in the ApprovalUnchecked condition that the approvals of an Environment whose
+// changes must be approved are ignored while the webhooks are disabled
+func setApprovalCondition(cr *onboardingv1alpha1.Environment) {
+	if ApprovalWebhook || !requiresApproval(cr) {
+		cr.Status.Conditions.RemoveCondition(onboardingv1alpha1.ApprovalUncheckedCondition)
+		return
+	}
+	cr.Status.Conditions.SetCondition(status.Condition{
+		Type:    onboardingv1alpha1.ApprovalUncheckedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  onboardingv1alpha1.ApprovalWebhookDisabled,
+		Message: "the approvals are only checked with the webhooks enabled, the production changes stay pending",
+	})
+}
+
+// approvedEnvironment returns the Environment to apply: the Environment itself when its changes don't need
+// or already have an approval, a copy holding the last approved spec otherwise, or nil if nothing was approved yet.
+func approvedEnvironment(cr *onboardingv1alpha1.Environment) *onboardingv1alpha1.Environment {
+	if !requiresApproval(cr) || isApproved(cr) {
+		return cr
+	}
+	if cr.Status.ApprovedSpec == nil {
+		return nil
+	}
+	approved := cr.DeepCopy()
+	approved.Spec = *cr.Status.ApprovedSpec.DeepCopy()
+	return approved
+}
+
+// specDiff describes the changes between the approved spec and the desired one. The specs are compared field by
+// field of their JSON form, so that no field escapes the approval.
+func specDiff(approved *onboardingv1alpha1.EnvironmentSpec, desired *onboardingv1alpha1.EnvironmentSpec) []string {
+	if approved == nil {
+		return []string{fmt.Sprintf("create environment %s", desired.Name)}
+	}
+	approvedFields, err := specFields(approved)
+	if err != nil {
+		return []string{fmt.Sprintf("spec: %v", err)}
+	}
+	desiredFields, err := specFields(desired)
+	if err != nil {
+		return []string{fmt.Sprintf("spec: %v", err)}
+	}
+	keys := []string{}
+	for key := range approvedFields {
+		keys = append(keys, key)
+	}
+	for key := range desiredFields {
+		if _, ok := approvedFields[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []string
+	for _, key := range keys {
+		old, ok := approvedFields[key]
+		if !ok {
+			old = "<none>"
+		}
+		new, ok := desiredFields[key]
+		if !ok {
+			new = "<none>"
+		}
+		if old != new {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", key, old, new))
+		}
+	}
+	return changes
+}
+
+// specFields returns the fields of the JSON form of the spec by dotted path. Objects are walked down to their
+// fields, the other values are kept as their JSON encoding, the strings unquoted.
+func specFields(spec *onboardingv1alpha1.EnvironmentSpec) (map[string]string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	var walk func(path string, value interface{}) error
+	walk = func(path string, value interface{}) error {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, field := range v {
+				if path != "" {
+					key = path + "." + key
+				}
+				if err := walk(key, field); err != nil {
+					return err
+				}
+			}
+		case string:
+			fields[path] = v
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			fields[path] = string(data)
+		}
+		return nil
+	}
+	return fields, walk("", value)
+}
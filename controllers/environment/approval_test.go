@@ -0,0 +1,139 @@
+package environment
+
+import (
+	"context"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestProdEnvironmentApprovalGate(t *testing.T) {
+	ApprovalWebhook = true
+	defer func() { ApprovalWebhook = false }()
+	prod := environment.DeepCopy()
+	prod.Spec.IsProd = true
+
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, prod, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient([]runtime.Object{prod}...)
+	r := &ReconcileEnvironment{client: cl, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	// Nothing is created before the approval
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	ns := &corev1.Namespace{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: projectname}, ns); !errors.IsNotFound(err) {
+		t.Fatalf("expected no namespace before approval, got (%v)", err)
+	}
+	found := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, found); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if found.Status.EnvironmentStatus != onboardingv1alpha1.EnvironmentPending || len(found.Status.PendingChanges) != 1 {
+		t.Fatalf("expected a pending creation, got %v", found.Status)
+	}
+
+	// Approve the current generation
+	found.Annotations = map[string]string{onboardingv1alpha1.ApprovedGenerationAnnotation: "0"}
+	if err := cl.Update(context.TODO(), found); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: projectname}, ns); err != nil {
+		t.Fatalf("get namespace: (%v)", err)
+	}
+
+	// Raise the quota in a new generation, the approved quota is kept
+	if err := cl.Get(context.TODO(), req.NamespacedName, found); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	found.Generation = 1
+	found.Spec.ResourceRequests.CPU = "4000m"
+	if err := cl.Update(context.TODO(), found); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	rq := &corev1.ResourceQuota{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "cno-resource-quota", Namespace: projectname}, rq); err != nil {
+		t.Fatalf("get resourcequota: (%v)", err)
+	}
+	if cpu := rq.Spec.Hard["requests.cpu"]; cpu.Cmp(resource.MustParse(requestCPU)) != 0 {
+		t.Errorf("expected the approved requests.cpu %s, got %s", requestCPU, cpu.String())
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, found); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	expected := "resources.requests.cpu: " + requestCPU + " -> 4000m"
+	if len(found.Status.PendingChanges) != 1 || found.Status.PendingChanges[0] != expected {
+		t.Errorf("expected pending changes [%s], got %v", expected, found.Status.PendingChanges)
+	}
+}
+
+func TestProdApprovalIgnoredWithoutWebhook(t *testing.T) {
+	prod := environment.DeepCopy()
+	prod.Spec.IsProd = true
+	prod.Annotations = map[string]string{onboardingv1alpha1.ApprovedGenerationAnnotation: "0"}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, prod, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient([]runtime.Object{prod}...)
+	r := &ReconcileEnvironment{client: cl, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	// The approval annotation isn't checked by a webhook, the creation stays pending
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: projectname}, &corev1.Namespace{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected no namespace without the approval webhook, got (%v)", err)
+	}
+	found := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, found); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if found.Status.EnvironmentStatus != onboardingv1alpha1.EnvironmentPending ||
+		!found.Status.Conditions.IsTrueFor(onboardingv1alpha1.ApprovalUncheckedCondition) {
+		t.Errorf("expected a pending Environment with an unchecked approval, got %v", found.Status)
+	}
+}
+
+func TestSpecDiff(t *testing.T) {
+	approved := environment.Spec.DeepCopy()
+	desired := approved.DeepCopy()
+	desired.ResourceLimits.CPU = "8000m"
+	desired.AllowedRegistries = []string{"registry.example.com"}
+	desired.Bootstrap = &onboardingv1alpha1.Bootstrap{Templates: []string{"network-policies"}}
+
+	expected := []string{
+		"allowedRegistries: <none> -> [\"registry.example.com\"]",
+		"bootstrap.templates: <none> -> [\"network-policies\"]",
+		"resources.limits.cpu: " + limitCPU + " -> 8000m",
+	}
+	changes := specDiff(approved, desired)
+	if len(changes) != len(expected) {
+		t.Fatalf("expected changes %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected changes %v, got %v", expected, changes)
+		}
+	}
+	if changes := specDiff(approved, approved.DeepCopy()); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
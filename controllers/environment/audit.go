@@ -0,0 +1,157 @@
+package environment
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxAuditHistory is the number of audit records kept in the Environment status
+const maxAuditHistory = 20
+
+// AuditWriter receives the audit stream as JSON lines. When nil, the records are written to the operator log.
+// It is set from the manager flags before the controller is added.
+var AuditWriter io.Writer
+
+// auditMu serializes the writes of the records to AuditWriter
+var auditMu sync.Mutex
+
+// auditEntry is a record of the audit stream
+type auditEntry struct {
+	Environment string `json:"environment"`
+	Namespace   string `json:"namespace"`
+	onboardingv1alpha1.AuditRecord
+}
+
+// quotaChanges returns a record for each ResourceQuota key whose quantity is changed from old to new
+func quotaChanges(cr *onboardingv1alpha1.Environment, name string, old, new corev1.ResourceList) []onboardingv1alpha1.AuditRecord {
+	keys := map[corev1.ResourceName]bool{}
+	for key := range old {
+		keys[key] = true
+	}
+	for key := range new {
+		keys[key] = true
+	}
+	var sorted []string
+	for key := range keys {
+		sorted = append(sorted, string(key))
+	}
+	sort.Strings(sorted)
+
+	var records []onboardingv1alpha1.AuditRecord
+	for _, key := range sorted {
+		oldValue, oldFound := old[corev1.ResourceName(key)]
+		newValue, newFound := new[corev1.ResourceName(key)]
+		if oldFound && newFound && oldValue.Cmp(newValue) == 0 {
+			continue
+		}
+		record := newAuditRecord(cr, "ResourceQuota", name, key)
+		if oldFound {
+			record.OldValue = oldValue.String()
+		}
+		if newFound {
+			record.NewValue = newValue.String()
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// subjectsChanges returns a record when the subjects of the RoleBinding are changed from old to new
+func subjectsChanges(cr *onboardingv1alpha1.Environment, name string, old, new []v1.Subject) []onboardingv1alpha1.AuditRecord {
+	oldValue, newValue := formatSubjects(old), formatSubjects(new)
+	if oldValue == newValue {
+		return nil
+	}
+	record := newAuditRecord(cr, "RoleBinding", name, "subjects")
+	record.OldValue = oldValue
+	record.NewValue = newValue
+	return []onboardingv1alpha1.AuditRecord{record}
+}
+
+// formatSubjects returns the sorted Kind:Name list of the subjects
+func formatSubjects(subjects []v1.Subject) string {
+	var names []string
+	for _, subject := range subjects {
+		names = append(names, subject.Kind+":"+subject.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// newAuditRecord returns a record of a change to the field of a child object of the Environment, made for its
+// approved generation
+func newAuditRecord(cr *onboardingv1alpha1.Environment, kind, name, field string) onboardingv1alpha1.AuditRecord {
+	return onboardingv1alpha1.AuditRecord{
+		Time:       metav1.Now(),
+		Kind:       kind,
+		Name:       name,
+		Field:      field,
+		Generation: cr.Status.ApprovedGeneration,
+		Modifier:   lastModifier(cr),
+	}
+}
+
+// lastModifier returns the manager of the latest update of the Environment spec, from its managedFields
+func lastModifier(cr *onboardingv1alpha1.Environment) string {
+	var modifier string
+	var latest time.Time
+	for _, entry := range cr.ManagedFields {
+		if entry.FieldsV1 == nil || !bytes.Contains(entry.FieldsV1.Raw, []byte(`"f:spec"`)) {
+			continue
+		}
+		var updated time.Time
+		if entry.Time != nil {
+			updated = entry.Time.Time
+		}
+		if modifier == "" || updated.After(latest) {
+			modifier = entry.Manager
+			latest = updated
+		}
+	}
+	return modifier
+}
+
+// audit appends the records to the history of the Environment status, they are written to the audit stream by
+// writeAudit once the status is updated
+func audit(cr *onboardingv1alpha1.Environment, records []onboardingv1alpha1.AuditRecord) {
+	cr.Status.AuditHistory = append(cr.Status.AuditHistory, records...)
+}
+
+// boundAuditHistory keeps the latest maxAuditHistory records of the history of the Environment status
+func boundAuditHistory(cr *onboardingv1alpha1.Environment) {
+	if history := cr.Status.AuditHistory; len(history) > maxAuditHistory {
+		cr.Status.AuditHistory = history[len(history)-maxAuditHistory:]
+	}
+}
+
+// writeAudit writes the records to the audit stream
+func writeAudit(cr *onboardingv1alpha1.Environment, records []onboardingv1alpha1.AuditRecord) {
+	auditMu.Lock()
+	for _, record := range records {
+		entry := auditEntry{Environment: cr.Name, Namespace: cr.Spec.Name, AuditRecord: record}
+		if AuditWriter == nil {
+			log.Info("Environment audit", "Environment Name", entry.Environment, "Namespace", entry.Namespace,
+				"Kind", record.Kind, "Name", record.Name, "Field", record.Field, "Old", record.OldValue,
+				"New", record.NewValue, "Generation", record.Generation, "Modifier", record.Modifier)
+			continue
+		}
+		line, err := json.Marshal(entry)
+		if err == nil {
+			_, err = AuditWriter.Write(append(line, '\n'))
+		}
+		if err != nil {
+			log.Error(err, "Failed to write the audit record", "Environment Name", entry.Environment)
+		}
+	}
+	auditMu.Unlock()
+}
@@ -0,0 +1,117 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestEnvironmentAudit(t *testing.T) {
+	buf := &bytes.Buffer{}
+	AuditWriter = buf
+	defer func() { AuditWriter = nil }()
+
+	env := environment.DeepCopy()
+	env.ManagedFields = []metav1.ManagedFieldsEntry{
+		{Manager: "onboarding-portal", Operation: metav1.ManagedFieldsOperationUpdate, FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{}}`)}},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	r := &ReconcileEnvironment{client: cl, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	// The creation records the 7 quota keys and the subjects of the 2 rolebindings
+	if lines := strings.Count(buf.String(), "\n"); lines != 9 {
+		t.Fatalf("expected 9 audit records on creation, got %d:\n%s", lines, buf.String())
+	}
+
+	// Give the admin role to user3
+	buf.Reset()
+	found := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, found); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	found.Spec.Users = append(found.Spec.Users, onboardingv1alpha1.User{Username: "user3", Role: "admin"})
+	if err := cl.Update(context.TODO(), found); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+
+	entry := auditEntry{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON audit record, got (%v):\n%s", err, buf.String())
+	}
+	expected := auditEntry{
+		Environment: name,
+		Namespace:   projectname,
+		AuditRecord: onboardingv1alpha1.AuditRecord{
+			Kind:     "RoleBinding",
+			Name:     "cno-admin-role-binding",
+			Field:    "subjects",
+			OldValue: "User:user1",
+			NewValue: "User:user1,User:user3",
+			Modifier: "onboarding-portal",
+		},
+	}
+	entry.Time = metav1.Time{}
+	if entry != expected {
+		t.Errorf("expected audit record %+v, got %+v", expected, entry)
+	}
+
+	if err := cl.Get(context.TODO(), req.NamespacedName, found); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if len(found.Status.AuditHistory) != 10 {
+		t.Errorf("expected 10 records in the audit history, got %d", len(found.Status.AuditHistory))
+	}
+}
+
+func TestAuditHistoryIsBounded(t *testing.T) {
+	env := environment.DeepCopy()
+	for i := 0; i < 2*maxAuditHistory; i++ {
+		audit(env, quotaChanges(env, "cno-resource-quota", nil, corev1.ResourceList{"requests.cpu": resource.MustParse("1")}))
+		boundAuditHistory(env)
+	}
+	if len(env.Status.AuditHistory) != maxAuditHistory {
+		t.Errorf("expected %d records in the audit history, got %d", maxAuditHistory, len(env.Status.AuditHistory))
+	}
+}
+
+func TestAuditWrittenOnceUpdated(t *testing.T) {
+	buf := &bytes.Buffer{}
+	AuditWriter = buf
+	defer func() { AuditWriter = nil }()
+
+	env := environment.DeepCopy()
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	r := &ReconcileEnvironment{client: failingStatusClient{cl}, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	// The records aren't written while the history holding them isn't persisted
+	if _, err := r.Reconcile(req); err == nil {
+		t.Fatalf("reconcile should fail with the status update")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no audit record before the status update, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,447 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/operatorconfig"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Intervals the bootstrap is applied again at: the templates and the bootstrapped objects, of any kind, aren't
+// watched
+const (
+	bootstrapResyncPeriod = 10 * time.Minute
+	bootstrapRetryPeriod  = time.Minute
+)
+
+// bootstrapData is the data the bootstrap templates are rendered with, e.g. {{ .Namespace }}
+type bootstrapData struct {
+	// Name of the Environment
+	Name      string
+	Namespace string
+	Tier      string
+	IsProd    bool
+	Users     []onboardingv1alpha1.User
+	// Labels of the Environment
+	Labels map[string]string
+}
+
+// reconcileBootstrap applies the objects rendered from the bootstrap templates into the Namespace of the
+// Environment as owned objects. With the Once policy an applied object is left to the Environment users, with the
+// Continuous policy it is updated when its rendered manifest changes, and deleted once no longer rendered. The
+// objects of the name that the Environment doesn't own are left as they are.
+func (r *ReconcileEnvironment) reconcileBootstrap(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error {
+	bootstrap := env.Spec.Bootstrap
+	if bootstrap == nil {
+		instance.Status.Bootstrap = nil
+		return nil
+	}
+	continuous := bootstrap.Policy == onboardingv1alpha1.BootstrapContinuous
+	previous := map[string]onboardingv1alpha1.BootstrapObjectStatus{}
+	for _, object := range instance.Status.Bootstrap {
+		if object.Kind != "" {
+			previous[bootstrapKey(object.APIVersion, object.Kind, object.Name)] = object
+		}
+	}
+	data := newBootstrapData(instance, env)
+
+	var objects []onboardingv1alpha1.BootstrapObjectStatus
+	var failedTemplates []string
+	rendered := map[string]bool{}
+	changed, failed := 0, 0
+	fail := func(template string, err error) {
+		objects = append(objects, onboardingv1alpha1.BootstrapObjectStatus{
+			Template: template,
+			State:    onboardingv1alpha1.BootstrapFailed,
+			Message:  err.Error(),
+		})
+		failedTemplates = append(failedTemplates, template)
+		failed++
+	}
+	for _, name := range bootstrap.Templates {
+		templates, err := r.bootstrapTemplates(ctx, name)
+		if err != nil {
+			fail(name, err)
+			continue
+		}
+		for _, key := range sortedKeys(templates) {
+			templateName := name + "/" + key
+			manifests, err := renderBootstrap(templateName, templates[key], data)
+			if err != nil {
+				fail(templateName, err)
+				continue
+			}
+			for _, obj := range manifests {
+				key := bootstrapKey(obj.GetAPIVersion(), obj.GetKind(), obj.GetName())
+				rendered[key] = true
+				if object, found := previous[key]; found && !continuous && object.State == onboardingv1alpha1.BootstrapApplied {
+					objects = append(objects, object)
+					continue
+				}
+				object := onboardingv1alpha1.BootstrapObjectStatus{
+					Template:   templateName,
+					APIVersion: obj.GetAPIVersion(),
+					Kind:       obj.GetKind(),
+					Name:       obj.GetName(),
+					AppliedAt:  previous[key].AppliedAt,
+				}
+				var applied bool
+				object.State, object.Message, applied = r.applyBootstrapObject(ctx, instance, env.Spec.Name, obj, continuous)
+				if applied {
+					now := metav1.Now()
+					object.AppliedAt = &now
+					changed++
+				}
+				if object.State == onboardingv1alpha1.BootstrapFailed {
+					failed++
+				}
+				objects = append(objects, object)
+			}
+		}
+	}
+
+	// The objects of the templates that failed are kept until the templates render again, the others that are no
+	// longer rendered are deleted with the Continuous policy
+	deleted := 0
+	for _, object := range instance.Status.Bootstrap {
+		key := bootstrapKey(object.APIVersion, object.Kind, object.Name)
+		if object.Kind == "" || rendered[key] {
+			continue
+		}
+		if bootstrapTemplateFailed(failedTemplates, object.Template) {
+			objects = append(objects, object)
+			rendered[key] = true
+			continue
+		}
+		if !continuous || object.State != onboardingv1alpha1.BootstrapApplied {
+			continue
+		}
+		removed, err := r.deleteBootstrapObject(ctx, instance, env.Spec.Name, object)
+		if err != nil {
+			return err
+		}
+		if removed {
+			deleted++
+		}
+	}
+	instance.Status.Bootstrap = objects
+
+	if changed > 0 || deleted > 0 {
+		log.Info("Environment bootstrapped", "Environment Name", instance.Name, "Applied", changed, "Deleted", deleted)
+		if r.recorder != nil {
+			r.recorder.Eventf(instance, corev1.EventTypeNormal, "Bootstrapped", "%d objects applied and %d deleted from the bootstrap templates", changed, deleted)
+		}
+	}
+	if failed > 0 && r.recorder != nil {
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "BootstrapFailed", "%d bootstrap templates or objects failed, see the status", failed)
+	}
+	return nil
+}
+
+// planBootstrap returns the operations the bootstrap step would apply to the objects rendered from the bootstrap
+// templates, without applying them. The templates and objects that fail are left out, they are reported once the
+// bootstrap is applied.
+func (r *ReconcileEnvironment) planBootstrap(ctx context.Context, instance, env *onboardingv1alpha1.Environment) ([]onboardingv1alpha1.PlannedOperation, error) {
+	bootstrap := env.Spec.Bootstrap
+	if bootstrap == nil {
+		return nil, nil
+	}
+	continuous := bootstrap.Policy == onboardingv1alpha1.BootstrapContinuous
+	previous := map[string]onboardingv1alpha1.BootstrapObjectStatus{}
+	for _, object := range instance.Status.Bootstrap {
+		if object.Kind != "" {
+			previous[bootstrapKey(object.APIVersion, object.Kind, object.Name)] = object
+		}
+	}
+	data := newBootstrapData(instance, env)
+
+	var plan []onboardingv1alpha1.PlannedOperation
+	var failedTemplates []string
+	rendered := map[string]bool{}
+	for _, name := range bootstrap.Templates {
+		templates, err := r.bootstrapTemplates(ctx, name)
+		if err != nil {
+			failedTemplates = append(failedTemplates, name)
+			continue
+		}
+		for _, key := range sortedKeys(templates) {
+			templateName := name + "/" + key
+			manifests, err := renderBootstrap(templateName, templates[key], data)
+			if err != nil {
+				failedTemplates = append(failedTemplates, templateName)
+				continue
+			}
+			for _, obj := range manifests {
+				key := bootstrapKey(obj.GetAPIVersion(), obj.GetKind(), obj.GetName())
+				rendered[key] = true
+				if object, found := previous[key]; found && !continuous && object.State == onboardingv1alpha1.BootstrapApplied {
+					continue
+				}
+				hash, err := r.prepareBootstrapObject(obj, env.Spec.Name)
+				if err != nil {
+					continue
+				}
+				operation := onboardingv1alpha1.PlannedOperation{Kind: obj.GetKind(), Name: obj.GetName(), Namespace: env.Spec.Name}
+				found := &unstructured.Unstructured{}
+				found.SetGroupVersionKind(obj.GroupVersionKind())
+				err = r.apiReader().Get(ctx, types.NamespacedName{Name: obj.GetName(), Namespace: env.Spec.Name}, found)
+				switch {
+				case errors.IsNotFound(err):
+					operation.Operation = onboardingv1alpha1.OperationCreate
+				case err != nil:
+					return nil, err
+				case !ownedBy(found, instance) || !continuous || found.GetAnnotations()[onboardingv1alpha1.BootstrapHashAnnotation] == hash:
+					continue
+				default:
+					operation.Operation = onboardingv1alpha1.OperationUpdate
+					operation.Changes = []string{"rendered manifest changed"}
+				}
+				plan = append(plan, operation)
+			}
+		}
+	}
+
+	if !continuous {
+		return plan, nil
+	}
+	for _, object := range instance.Status.Bootstrap {
+		key := bootstrapKey(object.APIVersion, object.Kind, object.Name)
+		if object.Kind == "" || rendered[key] || bootstrapTemplateFailed(failedTemplates, object.Template) ||
+			object.State != onboardingv1alpha1.BootstrapApplied {
+			continue
+		}
+		found := &unstructured.Unstructured{}
+		found.SetAPIVersion(object.APIVersion)
+		found.SetKind(object.Kind)
+		err := r.apiReader().Get(ctx, types.NamespacedName{Name: object.Name, Namespace: env.Spec.Name}, found)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if ownedBy(found, instance) {
+			plan = append(plan, onboardingv1alpha1.PlannedOperation{
+				Operation: onboardingv1alpha1.OperationDelete,
+				Kind:      object.Kind,
+				Name:      object.Name,
+				Namespace: env.Spec.Name,
+			})
+		}
+	}
+	return plan, nil
+}
+
+// newBootstrapData returns the data the bootstrap templates of the Environment are rendered with
+func newBootstrapData(instance, env *onboardingv1alpha1.Environment) bootstrapData {
+	return bootstrapData{
+		Name:      instance.Name,
+		Namespace: env.Spec.Name,
+		Tier:      env.Tier(),
+		IsProd:    env.Spec.IsProd,
+		Users:     env.Spec.Users,
+		Labels:    instance.Labels,
+	}
+}
+
+// bootstrapRequeue returns the delay before the bootstrap of the Environment is applied again, zero when it
+// doesn't need to
+func bootstrapRequeue(instance *onboardingv1alpha1.Environment) time.Duration {
+	for _, object := range instance.Status.Bootstrap {
+		if object.State == onboardingv1alpha1.BootstrapFailed {
+			return bootstrapRetryPeriod
+		}
+	}
+	if bootstrap := instance.Spec.Bootstrap; bootstrap != nil && bootstrap.Policy == onboardingv1alpha1.BootstrapContinuous {
+		return bootstrapResyncPeriod
+	}
+	return 0
+}
+
+// bootstrapTemplates returns the templates of the bootstrap ConfigMap of the name by key. The ConfigMaps aren't
+// cached, they are read from the API server.
+func (r *ReconcileEnvironment) bootstrapTemplates(ctx context.Context, name string) (map[string]string, error) {
+	namespace := operatorconfig.Get().Bootstrap.Namespace
+	if namespace == "" {
+		return nil, fmt.Errorf("the bootstrap namespace of the operator isn't configured")
+	}
+	configMap := &corev1.ConfigMap{}
+	err := r.apiReader().Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, configMap)
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf("ConfigMap %s not found in the bootstrap namespace %s", name, namespace)
+	}
+	return configMap.Data, err
+}
+
+// renderBootstrap renders the template with the data and returns the objects of the YAML documents. The empty
+// documents, e.g. of a false condition, are skipped.
+func renderBootstrap(name, text string, data bootstrapData) ([]*unstructured.Unstructured, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, err
+	}
+	var objects []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(&rendered, 4096)
+	for {
+		content := map[string]interface{}{}
+		if err := decoder.Decode(&content); err == io.EOF {
+			return objects, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(content) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: content}
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" || obj.GetName() == "" {
+			return nil, fmt.Errorf("manifest %d misses its apiVersion, kind or name", len(objects)+1)
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// applyBootstrapObject creates the object in the namespace, or updates it with the Continuous policy when its
+// rendered manifest changed. It returns the state and message of the object, and whether it was applied.
+func (r *ReconcileEnvironment) applyBootstrapObject(ctx context.Context, instance *onboardingv1alpha1.Environment, namespace string, obj *unstructured.Unstructured, continuous bool) (string, string, bool) {
+	gvk := obj.GroupVersionKind()
+	hash, err := r.prepareBootstrapObject(obj, namespace)
+	if err != nil {
+		return onboardingv1alpha1.BootstrapFailed, err.Error(), false
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[onboardingv1alpha1.BootstrapHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+	if err := controllerutil.SetControllerReference(instance, obj, r.scheme); err != nil {
+		return onboardingv1alpha1.BootstrapFailed, err.Error(), false
+	}
+
+	found := &unstructured.Unstructured{}
+	found.SetGroupVersionKind(gvk)
+	err = r.apiReader().Get(ctx, types.NamespacedName{Name: obj.GetName(), Namespace: namespace}, found)
+	if errors.IsNotFound(err) {
+		if err := r.client.Create(ctx, obj); err != nil {
+			return onboardingv1alpha1.BootstrapFailed, err.Error(), false
+		}
+		return onboardingv1alpha1.BootstrapApplied, "Created", true
+	} else if err != nil {
+		return onboardingv1alpha1.BootstrapFailed, err.Error(), false
+	}
+	if !ownedBy(found, instance) {
+		return onboardingv1alpha1.BootstrapSkipped, "An object of the name not owned by the Environment exists", false
+	}
+	if !continuous || found.GetAnnotations()[onboardingv1alpha1.BootstrapHashAnnotation] == hash {
+		return onboardingv1alpha1.BootstrapApplied, "Up to date", false
+	}
+	obj.SetResourceVersion(found.GetResourceVersion())
+	if err := r.client.Update(ctx, obj); err != nil {
+		return onboardingv1alpha1.BootstrapFailed, err.Error(), false
+	}
+	return onboardingv1alpha1.BootstrapApplied, "Updated", true
+}
+
+// prepareBootstrapObject checks that the rendered object can be bootstrapped into the namespace, sets its namespace
+// and returns the hash of its manifest
+func (r *ReconcileEnvironment) prepareBootstrapObject(obj *unstructured.Unstructured, namespace string) (string, error) {
+	gvk := obj.GroupVersionKind()
+	if r.mapper != nil {
+		mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return "", err
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			return "", fmt.Errorf("%s is cluster-scoped, only namespaced objects are bootstrapped", gvk.Kind)
+		}
+	}
+	if objNamespace := obj.GetNamespace(); objNamespace != "" && objNamespace != namespace {
+		return "", fmt.Errorf("namespace %s isn't the Environment namespace", objNamespace)
+	}
+	obj.SetNamespace(namespace)
+	return manifestHash(obj)
+}
+
+// ownedBy tells whether the Environment is the controller of the object
+func ownedBy(obj metav1.Object, instance *onboardingv1alpha1.Environment) bool {
+	owner := metav1.GetControllerOf(obj)
+	return owner != nil && owner.UID == instance.UID
+}
+
+// deleteBootstrapObject deletes the bootstrapped object of the status from the namespace when the Environment
+// still owns it, and tells whether it did
+func (r *ReconcileEnvironment) deleteBootstrapObject(ctx context.Context, instance *onboardingv1alpha1.Environment, namespace string, object onboardingv1alpha1.BootstrapObjectStatus) (bool, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(object.APIVersion)
+	obj.SetKind(object.Kind)
+	err := r.apiReader().Get(ctx, types.NamespacedName{Name: object.Name, Namespace: namespace}, obj)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !ownedBy(obj, instance) {
+		return false, nil
+	}
+	if err := r.client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// manifestHash returns the hash of the rendered manifest of an object
+func manifestHash(obj *unstructured.Unstructured) (string, error) {
+	manifest, err := json.Marshal(obj.Object)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(manifest)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// bootstrapKey identifies a bootstrapped object in the Environment namespace
+func bootstrapKey(apiVersion, kind, name string) string {
+	return apiVersion + "/" + kind + "/" + name
+}
+
+// bootstrapTemplateFailed tells whether the template, as configmap/key, is one of the failed ConfigMaps or
+// templates
+func bootstrapTemplateFailed(failed []string, template string) bool {
+	for _, name := range failed {
+		if template == name || strings.HasPrefix(template, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of the map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
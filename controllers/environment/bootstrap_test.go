@@ -0,0 +1,229 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	configv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/config/v1alpha1"
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/operatorconfig"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const settingsTemplate = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}-settings
+data:
+  tier: {{ .Tier }}
+  level: %s
+---
+{{ if .IsProd }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: production-only
+{{ end }}
+`
+
+const rolesTemplate = `apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: reader
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get", "list"]
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: deployer
+`
+
+func newBootstrapReconciler(t *testing.T, policy string) (*ReconcileEnvironment, client.Client) {
+	cfg := configv1alpha1.NewOperatorConfig()
+	cfg.Bootstrap.Namespace = "onboarding"
+	operatorconfig.Set(cfg)
+	t.Cleanup(func() { operatorconfig.Set(configv1alpha1.NewOperatorConfig()) })
+
+	env := environment.DeepCopy()
+	env.UID = "environment-uid"
+	env.Spec.Bootstrap = &onboardingv1alpha1.Bootstrap{Templates: []string{"defaults", "missing"}, Policy: policy}
+	library := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "onboarding"},
+		Data: map[string]string{
+			"settings.yaml": fmt.Sprintf(settingsTemplate, "info"),
+			"roles.yaml":    rolesTemplate,
+		},
+	}
+	// Created by the Environment users
+	deployer := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "deployer", Namespace: projectname}}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env, library, deployer)
+	return &ReconcileEnvironment{client: cl, scheme: s, recorder: record.NewFakeRecorder(20)}, cl
+}
+
+func reconcileBootstrapped(t *testing.T, r *ReconcileEnvironment) (reconcile.Result, []onboardingv1alpha1.BootstrapObjectStatus) {
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+	result, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	env := &onboardingv1alpha1.Environment{}
+	if err := r.client.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	return result, env.Status.Bootstrap
+}
+
+func updateTemplate(t *testing.T, cl client.Client, key, text string) {
+	library := &corev1.ConfigMap{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "defaults", Namespace: "onboarding"}, library); err != nil {
+		t.Fatalf("get configmap: (%v)", err)
+	}
+	if text == "" {
+		delete(library.Data, key)
+	} else {
+		library.Data[key] = text
+	}
+	if err := cl.Update(context.TODO(), library); err != nil {
+		t.Fatalf("update configmap: (%v)", err)
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	r, cl := newBootstrapReconciler(t, onboardingv1alpha1.BootstrapContinuous)
+
+	result, objects := reconcileBootstrapped(t, r)
+	expected := []onboardingv1alpha1.BootstrapObjectStatus{
+		{Template: "defaults/roles.yaml", Kind: "Role", Name: "reader", State: onboardingv1alpha1.BootstrapApplied},
+		{Template: "defaults/roles.yaml", Kind: "ServiceAccount", Name: "deployer", State: onboardingv1alpha1.BootstrapSkipped},
+		{Template: "defaults/settings.yaml", Kind: "ConfigMap", Name: name + "-settings", State: onboardingv1alpha1.BootstrapApplied},
+		{Template: "missing", State: onboardingv1alpha1.BootstrapFailed},
+	}
+	if len(objects) != len(expected) {
+		t.Fatalf("expected %d bootstrap objects, got %v", len(expected), objects)
+	}
+	for i := range expected {
+		if objects[i].Template != expected[i].Template || objects[i].Kind != expected[i].Kind ||
+			objects[i].Name != expected[i].Name || objects[i].State != expected[i].State {
+			t.Errorf("expected bootstrap object %v, got %v", expected[i], objects[i])
+		}
+	}
+	if result.RequeueAfter != bootstrapRetryPeriod {
+		t.Errorf("failed bootstrap should be retried after %s, got %s", bootstrapRetryPeriod, result.RequeueAfter)
+	}
+
+	settings := &corev1.ConfigMap{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: name + "-settings", Namespace: projectname}, settings); err != nil {
+		t.Fatalf("get configmap: (%v)", err)
+	}
+	if owner := metav1.GetControllerOf(settings); owner == nil || owner.Name != name || settings.Data["tier"] != onboardingv1alpha1.TierDev {
+		t.Errorf("ConfigMap should be rendered and owned by the Environment, got %v", settings)
+	}
+	deployer := &corev1.ServiceAccount{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "deployer", Namespace: projectname}, deployer); err != nil {
+		t.Fatalf("get serviceaccount: (%v)", err)
+	}
+	if metav1.GetControllerOf(deployer) != nil {
+		t.Error("ServiceAccount of the users shouldn't be taken over")
+	}
+
+	// The changed manifests are applied again, the ones no longer rendered are deleted
+	updateTemplate(t, cl, "settings.yaml", fmt.Sprintf(settingsTemplate, "debug"))
+	updateTemplate(t, cl, "roles.yaml", "")
+	reconcileBootstrapped(t, r)
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: name + "-settings", Namespace: projectname}, settings); err != nil {
+		t.Fatalf("get configmap: (%v)", err)
+	}
+	if settings.Data["level"] != "debug" {
+		t.Errorf("ConfigMap should be updated, got %v", settings.Data)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "reader", Namespace: projectname}, &rbacv1.Role{}); err == nil {
+		t.Error("Role no longer rendered should be deleted")
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "deployer", Namespace: projectname}, deployer); err != nil {
+		t.Errorf("ServiceAccount of the users shouldn't be deleted: (%v)", err)
+	}
+}
+
+func TestBootstrapOnce(t *testing.T) {
+	r, cl := newBootstrapReconciler(t, "")
+
+	reconcileBootstrapped(t, r)
+	settings := &corev1.ConfigMap{}
+	key := types.NamespacedName{Name: name + "-settings", Namespace: projectname}
+	if err := cl.Get(context.TODO(), key, settings); err != nil {
+		t.Fatalf("get configmap: (%v)", err)
+	}
+
+	// The users own the applied objects, they are neither updated nor created again
+	updateTemplate(t, cl, "settings.yaml", fmt.Sprintf(settingsTemplate, "debug"))
+	if err := cl.Delete(context.TODO(), &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: projectname}}); err != nil {
+		t.Fatalf("delete role: (%v)", err)
+	}
+	_, objects := reconcileBootstrapped(t, r)
+	if err := cl.Get(context.TODO(), key, settings); err != nil {
+		t.Fatalf("get configmap: (%v)", err)
+	}
+	if settings.Data["level"] != "info" {
+		t.Errorf("ConfigMap shouldn't be updated once applied, got %v", settings.Data)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "reader", Namespace: projectname}, &rbacv1.Role{}); err == nil {
+		t.Error("deleted Role shouldn't be created again")
+	}
+	if len(objects) != 4 || objects[0].Name != "reader" || objects[0].State != onboardingv1alpha1.BootstrapApplied {
+		t.Errorf("applied objects should be kept in the status, got %v", objects)
+	}
+}
+
+func TestBootstrapDryRun(t *testing.T) {
+	r, cl := newBootstrapReconciler(t, onboardingv1alpha1.BootstrapContinuous)
+	reconcileBootstrapped(t, r)
+
+	// The changed manifests and the ones no longer rendered are planned, not applied
+	updateTemplate(t, cl, "settings.yaml", fmt.Sprintf(settingsTemplate, "debug"))
+	updateTemplate(t, cl, "roles.yaml", "")
+	DryRun = true
+	defer func() { DryRun = false }()
+	reconcileBootstrapped(t, r)
+
+	env := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: name}, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	var planned []string
+	for _, operation := range env.Status.Plan {
+		planned = append(planned, formatOperation(operation))
+	}
+	expected := []string{
+		"Update ConfigMap project1/environment-settings: rendered manifest changed",
+		"Delete Role project1/reader",
+	}
+	if !reflect.DeepEqual(planned, expected) {
+		t.Errorf("plan: (%v)", planned)
+	}
+	settings := &corev1.ConfigMap{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: name + "-settings", Namespace: projectname}, settings); err != nil {
+		t.Fatalf("get configmap: (%v)", err)
+	}
+	if settings.Data["level"] != "info" {
+		t.Errorf("ConfigMap updated in dry-run mode, got %v", settings.Data)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "reader", Namespace: projectname}, &rbacv1.Role{}); err != nil {
+		t.Errorf("Role deleted in dry-run mode: (%v)", err)
+	}
+}
@@ -0,0 +1,154 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/objectmeta"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileClone copies the ConfigMaps, Secrets and ServiceAccounts selected in the Namespace of the Environment
+// cloned from into the Namespace of the Environment, once. The objects already in the Namespace are left as they
+// are, and the objects that failed are copied again on the next reconciliations.
+func (r *ReconcileEnvironment) reconcileClone(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error {
+	from := env.Spec.CloneFrom
+	if from == nil || (instance.Status.Clone != nil && instance.Status.Clone.Phase == onboardingv1alpha1.CloneCompleted) {
+		return nil
+	}
+	clone := instance.Status.Clone
+	if clone == nil {
+		clone = &onboardingv1alpha1.CloneStatus{}
+		instance.Status.Clone = clone
+	}
+	clone.Failed = nil
+
+	source := &onboardingv1alpha1.Environment{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: from.Environment}, source)
+	if errors.IsNotFound(err) {
+		clone.Phase = onboardingv1alpha1.CloneFailed
+		clone.Message = fmt.Sprintf("Environment %s not found", from.Environment)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var objects []runtime.Object
+	if from.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(from.Selector)
+		if err != nil {
+			clone.Phase = onboardingv1alpha1.CloneFailed
+			clone.Message = fmt.Sprintf("invalid selector: %v", err)
+			return nil
+		}
+		matching := client.MatchingLabelsSelector{Selector: selector}
+		if objects, err = r.cloneObjects(ctx, source.Spec.Name, env.Spec.Name, matching); err != nil {
+			return err
+		}
+	}
+
+	for _, obj := range objects {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s/%s", obj.GetObjectKind().GroupVersionKind().Kind, accessor.GetName())
+		if contains(clone.Copied, key) || contains(clone.Skipped, key) {
+			continue
+		}
+		err = r.client.Create(ctx, obj)
+		switch {
+		case err == nil:
+			clone.Copied = append(clone.Copied, key)
+		case errors.IsAlreadyExists(err):
+			clone.Skipped = append(clone.Skipped, key)
+		default:
+			clone.Failed = append(clone.Failed, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+
+	if len(clone.Failed) > 0 {
+		clone.Phase = onboardingv1alpha1.CloneFailed
+		clone.Message = fmt.Sprintf("%d objects failed to be copied from Environment %s", len(clone.Failed), source.Name)
+		return nil
+	}
+	clone.Phase = onboardingv1alpha1.CloneCompleted
+	clone.Message = fmt.Sprintf("%d objects copied from Environment %s, %d already found", len(clone.Copied), source.Name, len(clone.Skipped))
+	now := metav1.Now()
+	clone.CompletionTime = &now
+	log.Info("Environment cloned", "Environment Name", instance.Name, "Source", source.Name, "Copied", len(clone.Copied))
+	if r.recorder != nil {
+		r.recorder.Event(instance, corev1.EventTypeNormal, "Cloned", clone.Message)
+	}
+	return nil
+}
+
+// cloneObjects returns copies for the target Namespace of the ConfigMaps, Secrets and ServiceAccounts of the
+// source Namespace matching the selector. The service account tokens and the default ServiceAccount, created by
+// Kubernetes in every Namespace, aren't copied. The objects aren't cached, they are listed from the API server.
+func (r *ReconcileEnvironment) cloneObjects(ctx context.Context, source, target string, selector client.MatchingLabelsSelector) ([]runtime.Object, error) {
+	var objects []runtime.Object
+	opts := []client.ListOption{client.InNamespace(source), selector}
+
+	configMaps := &corev1.ConfigMapList{}
+	if err := r.apiReader().List(ctx, configMaps, opts...); err != nil {
+		return nil, err
+	}
+	for _, configMap := range configMaps.Items {
+		objects = append(objects, &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: objectmeta.Copy(configMap.ObjectMeta, target),
+			Data:       configMap.Data,
+			BinaryData: configMap.BinaryData,
+		})
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := r.apiReader().List(ctx, secrets, opts...); err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets.Items {
+		if secret.Type == corev1.SecretTypeServiceAccountToken {
+			continue
+		}
+		objects = append(objects, &corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: objectmeta.Copy(secret.ObjectMeta, target),
+			Type:       secret.Type,
+			Data:       secret.Data,
+		})
+	}
+
+	serviceAccounts := &corev1.ServiceAccountList{}
+	if err := r.apiReader().List(ctx, serviceAccounts, opts...); err != nil {
+		return nil, err
+	}
+	for _, serviceAccount := range serviceAccounts.Items {
+		if serviceAccount.Name == "default" {
+			continue
+		}
+		objects = append(objects, &corev1.ServiceAccount{
+			TypeMeta:                     metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta:                   objectmeta.Copy(serviceAccount.ObjectMeta, target),
+			ImagePullSecrets:             serviceAccount.ImagePullSecrets,
+			AutomountServiceAccountToken: serviceAccount.AutomountServiceAccountToken,
+		})
+	}
+	return objects, nil
+}
+
+// contains tells whether the value is in the list
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package environment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/objectmeta"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestClonedEnvironment(t *testing.T) {
+	source := environment.DeepCopy()
+	source.Name = "source"
+	source.Spec.Name = "source-project"
+	env := environment.DeepCopy()
+	env.Spec.CloneFrom = &onboardingv1alpha1.CloneFrom{
+		Environment: "source",
+		Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{"clone": "true"}},
+	}
+	selected := map[string]string{"clone": "true"}
+	objects := []runtime.Object{
+		source, env,
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "source-project", Labels: selected,
+				Annotations: map[string]string{objectmeta.LastAppliedAnnotation: "{}", "team": "a"}},
+			Data: map[string]string{"level": "debug"},
+		},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "local", Namespace: "source-project"}},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "source-project", Labels: selected},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("{}")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "deployer-token", Namespace: "source-project", Labels: selected},
+			Type:       corev1.SecretTypeServiceAccountToken,
+		},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "deployer", Namespace: "source-project", Labels: selected}},
+		// Already in the Namespace of the clone
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "deployer", Namespace: projectname}},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(objects...)
+	r := &ReconcileEnvironment{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	cloned := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, cloned); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	clone := cloned.Status.Clone
+	if clone == nil || clone.Phase != onboardingv1alpha1.CloneCompleted || clone.CompletionTime == nil {
+		t.Fatalf("clone should be completed: %v", clone)
+	}
+	if copied := []string{"ConfigMap/settings", "Secret/registry"}; !reflect.DeepEqual(clone.Copied, copied) {
+		t.Errorf("expected %v copied, got %v", copied, clone.Copied)
+	}
+	if skipped := []string{"ServiceAccount/deployer"}; !reflect.DeepEqual(clone.Skipped, skipped) {
+		t.Errorf("expected %v skipped, got %v", skipped, clone.Skipped)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "settings", Namespace: projectname}, configMap); err != nil {
+		t.Fatalf("get configmap: (%v)", err)
+	}
+	if configMap.Data["level"] != "debug" || configMap.Annotations["team"] != "a" {
+		t.Errorf("ConfigMap should be copied, got %v", configMap)
+	}
+	if _, found := configMap.Annotations[objectmeta.LastAppliedAnnotation]; found {
+		t.Errorf("ConfigMap copy shouldn't keep the %s annotation", objectmeta.LastAppliedAnnotation)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "local", Namespace: projectname}, &corev1.ConfigMap{}); err == nil {
+		t.Error("ConfigMap not selected shouldn't be copied")
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "deployer-token", Namespace: projectname}, &corev1.Secret{}); err == nil {
+		t.Error("service account token shouldn't be copied")
+	}
+}
+
+func TestCloneFromMissingEnvironment(t *testing.T) {
+	env := environment.DeepCopy()
+	env.Spec.CloneFrom = &onboardingv1alpha1.CloneFrom{Environment: "missing"}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	r := &ReconcileEnvironment{client: cl, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	failed := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, failed); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if clone := failed.Status.Clone; clone == nil || clone.Phase != onboardingv1alpha1.CloneFailed {
+		t.Errorf("clone should fail without source Environment: %v", clone)
+	}
+}
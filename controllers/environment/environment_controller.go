@@ -2,17 +2,27 @@ package environment
 
 import (
 	"context"
+	"fmt"
+	"time"
+
 	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/operatorconfig"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/sharding"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/tracing"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -35,7 +45,13 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileEnvironment{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return &ReconcileEnvironment{
+		client:   tracing.WrapClient(mgr.GetClient(), mgr.GetScheme()),
+		reader:   mgr.GetAPIReader(),
+		scheme:   mgr.GetScheme(),
+		mapper:   mgr.GetRESTMapper(),
+		recorder: mgr.GetEventRecorderFor("environment-controller"),
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -46,8 +62,12 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Only the Environments of the shard of the operator instance, and their child objects, are reconciled
+	shard := sharding.Current.EnvironmentPredicate()
+	owned := sharding.Current.RelatedPredicate(mgr.GetClient(), sharding.ControllerEnvironment)
+
 	// Watch for changes to primary resource Environment
-	err = c.Watch(&source.Kind{Type: &onboardingv1alpha1.Environment{}}, &handler.EnqueueRequestForObject{})
+	err = c.Watch(&source.Kind{Type: &onboardingv1alpha1.Environment{}}, &handler.EnqueueRequestForObject{}, shard)
 	if err != nil {
 		return err
 	}
@@ -56,7 +76,7 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	err = c.Watch(&source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
 		OwnerType:    &onboardingv1alpha1.Environment{},
-	})
+	}, owned)
 	if err != nil {
 		return err
 	}
@@ -65,7 +85,7 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	err = c.Watch(&source.Kind{Type: &corev1.ResourceQuota{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
 		OwnerType:    &onboardingv1alpha1.Environment{},
-	})
+	}, owned)
 	if err != nil {
 		return err
 	}
@@ -74,10 +94,30 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	err = c.Watch(&source.Kind{Type: &v1.RoleBinding{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
 		OwnerType:    &onboardingv1alpha1.Environment{},
-	})
+	}, owned)
 	if err != nil {
 		return err
 	}
+
+	// Requeue every Environment when the operator configuration is reloaded, to apply the new LimitRange defaults
+	reloads := make(chan event.GenericEvent)
+	err = c.Watch(&source.Channel{Source: reloads}, &handler.EnqueueRequestForObject{}, shard)
+	if err != nil {
+		return err
+	}
+	operatorconfig.OnReload(func() {
+		environments := &onboardingv1alpha1.EnvironmentList{}
+		if err := mgr.GetClient().List(context.TODO(), environments); err != nil {
+			log.Error(err, "Failed to list the Environments to apply the reloaded configuration")
+			return
+		}
+		// The controller only reads the channel once elected, the reload mustn't wait for it on a standby replica
+		go func() {
+			for i := range environments.Items {
+				reloads <- event.GenericEvent{Meta: &environments.Items[i], Object: &environments.Items[i]}
+			}
+		}()
+	})
 	return nil
 }
 
@@ -89,7 +129,12 @@ type ReconcileEnvironment struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
 	client client.Client
+	// reader reads the objects that aren't cached from the apiserver, the client when nil
+	reader client.Reader
 	scheme *runtime.Scheme
+	// mapper tells the scope of the bootstrapped objects, it isn't checked when nil
+	mapper   meta.RESTMapper
+	recorder record.EventRecorder
 }
 
 // Reconcile reads that state of the cluster for an Environment object and makes changes based on the state read
@@ -98,184 +143,421 @@ type ReconcileEnvironment struct {
 // The Controller will requeue the Request to be processed again if the returned error is non-nil or
 // Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
 func (r *ReconcileEnvironment) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx, span := tracing.Start(context.Background(), "Reconcile Environment", tracing.EnvironmentKey.String(request.Name))
+	result, err := r.reconcile(ctx, request)
+	tracing.End(span, err)
+	return result, err
+}
+
+// reconcile reconciles the Environment of the request, ctx holds the span of the Reconcile call
+func (r *ReconcileEnvironment) reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
 	reqLogger := log.WithValues("Environment Name", request.Name)
 	reqLogger.Info("Reconciling Environment")
 
 	// Fetch the Environment instance
 	instance := &onboardingv1alpha1.Environment{}
-	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	err := r.client.Get(ctx, request.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
+			forgetEnvironment(request.Name)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
+	tracing.SetAttributes(ctx, tracing.NamespaceKey.String(instance.Spec.Name))
+	// The changes to the status are reported once persisted
+	previous := instance.Status.DeepCopy()
+
+	// The Environment may have been relabelled out of the shard since it was queued, its new shard reconciles it
+	if !sharding.Current.Owns(instance) {
+		reqLogger.Info("Environment belongs to another shard")
+		forgetEnvironment(request.Name)
+		return reconcile.Result{}, nil
+	}
+	instance.Status.Shard = sharding.Current.String()
+
+	// A paused Environment keeps its child objects as they are, only their drift from the spec is reported
+	now := time.Now()
+	paused, until, invalid := pauseState(instance, now)
+	if paused {
+		return r.reconcilePaused(ctx, instance, previous, now, until, invalid)
+	}
+	r.resume(instance)
+
+	// In dry-run mode the changes to the child objects are planned instead of applied
+	if reason := dryRunReason(instance); reason != "" {
+		return r.reconcileDryRun(ctx, instance, previous, reason)
+	}
+	leaveDryRun(instance)
+
+	// Production changes are only applied once approved, the last approved spec is kept meanwhile
+	env := approvedEnvironment(instance)
+	setApprovalCondition(instance)
+
+	// Non-production Environments expire after the TTL of their approved spec, the expiry is requeued
+	expired, requeueAfter, err := r.reconcileExpiry(ctx, instance, env, now)
+	if err != nil || expired {
+		return reconcile.Result{}, err
+	}
+	firstReady := false
+	if env != instance {
+		reqLogger.Info("Environment changes are waiting for approval", "Generation", instance.Generation)
+		instance.Status.EnvironmentStatus = onboardingv1alpha1.EnvironmentPending
+		instance.Status.PendingChanges = specDiff(instance.Status.ApprovedSpec, &instance.Spec)
+		if env == nil {
+			if err := r.updateStatus(ctx, instance, previous); err != nil {
+				return reconcile.Result{}, err
+			}
+			reportEnvironment(instance)
+			return reconcile.Result{RequeueAfter: requeueAfter}, nil
+		}
+	} else {
+		firstReady = markReady(instance, now)
+		instance.Status.EnvironmentStatus = onboardingv1alpha1.EnvironmentReady
+		instance.Status.ApprovedGeneration = instance.Generation
+		instance.Status.ApprovedSpec = instance.Spec.DeepCopy()
+		instance.Status.PendingChanges = nil
+	}
+
+	// Reconcile the child objects step by step
+	for _, step := range r.steps() {
+		if err := r.runStep(ctx, step, instance, env); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	err = r.updateStatus(ctx, instance, previous)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if firstReady {
+		observeReady(instance)
+	}
+	reportEnvironment(instance)
+	if next := instance.Status.NextHibernationChange; next != nil && (requeueAfter == 0 || next.Sub(now) < requeueAfter) {
+		requeueAfter = next.Sub(now)
+	}
+	if bootstrap := bootstrapRequeue(instance); bootstrap > 0 && (requeueAfter == 0 || bootstrap < requeueAfter) {
+		requeueAfter = bootstrap
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// apiReader returns the reader of the objects that aren't cached
+func (r *ReconcileEnvironment) apiReader() client.Reader {
+	if r.reader == nil {
+		return r.client
+	}
+	return r.reader
+}
+
+// reconcileStep reconciles a child object of the Environment: instance is the Environment owning it and env the
+// Environment holding the approved spec to apply
+type reconcileStep struct {
+	name      string
+	reconcile func(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error
+}
+
+// steps returns the reconcile steps, in order
+func (r *ReconcileEnvironment) steps() []reconcileStep {
+	return []reconcileStep{
+		{name: "namespace", reconcile: r.reconcileNamespace},
+		{name: "quota", reconcile: r.reconcileResourceQuota},
+		{name: "pressure", reconcile: r.reconcileQuotaPressure},
+		{name: "limitrange", reconcile: r.reconcileLimitRange},
+		{name: "rbac", reconcile: r.reconcileRoleBindings},
+		{name: "clone", reconcile: r.reconcileClone},
+		{name: "bootstrap", reconcile: r.reconcileBootstrap},
+		{name: "hibernation", reconcile: r.reconcileHibernation},
+	}
+}
+
+// runStep runs a reconcile step in a child span and records its duration and error in the metrics
+func (r *ReconcileEnvironment) runStep(ctx context.Context, step reconcileStep, instance, env *onboardingv1alpha1.Environment) error {
+	ctx, span := tracing.Start(ctx, "Reconcile "+step.name,
+		tracing.EnvironmentKey.String(instance.Name), tracing.NamespaceKey.String(env.Spec.Name))
+	start := time.Now()
+	err := step.reconcile(ctx, instance, env)
+	observeStep(step.name, start, err)
+	tracing.End(span, err)
+	return err
+}
+
+// updateStatus updates the status of the Environment, then reports its changes from the previous status: the
+// audit records appended to its history since and the quota pressure change
+func (r *ReconcileEnvironment) updateStatus(ctx context.Context, instance *onboardingv1alpha1.Environment, previous *onboardingv1alpha1.EnvironmentStatus) error {
+	records := instance.Status.AuditHistory[len(previous.AuditHistory):]
+	boundAuditHistory(instance)
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return err
+	}
+	writeAudit(instance, records)
+	r.reportQuotaPressure(instance, previous)
+	return nil
+}
+
+// reconcileNamespace creates the Namespace of the Environment
+func (r *ReconcileEnvironment) reconcileNamespace(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error {
+	reqLogger := log.WithValues("Environment Name", instance.Name)
 
 	// Define a new Namespace object
-	namespace := newNamespaceForCR(instance)
+	namespace := newNamespaceForCR(env)
 
 	// Set Environment instance as the owner and controller
 	if err := controllerutil.SetControllerReference(instance, namespace, r.scheme); err != nil {
-		return reconcile.Result{}, err
+		return err
 	}
 
 	// Check if this Namespace already exists
 	foundNs := &corev1.Namespace{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: namespace.Name}, foundNs)
+	err := r.client.Get(ctx, types.NamespacedName{Name: namespace.Name}, foundNs)
 	if err != nil && errors.IsNotFound(err) {
 		reqLogger.Info("Creating a new Namespace", "Namespace.Name", namespace.Name)
-		err = r.client.Create(context.TODO(), namespace)
+		err = r.client.Create(ctx, namespace)
 		if err != nil {
-			return reconcile.Result{}, err
+			return err
 		}
 	} else if err != nil {
-		return reconcile.Result{}, err
+		return err
+	} else if adopt := env.Spec.Adopt && metav1.GetControllerOf(foundNs) == nil; adopt && foundNs.Labels[onboardingv1alpha1.AdoptableLabel] != "true" {
+		// Only the namespaces opted in by their owners are adopted
+		if r.recorder != nil {
+			r.recorder.Event(instance, corev1.EventTypeWarning, "AdoptionRefused",
+				fmt.Sprintf("Namespace %s isn't labelled %s=true", foundNs.Name, onboardingv1alpha1.AdoptableLabel))
+		}
+		return fmt.Errorf("namespace %s isn't labelled %s=true, it can't be adopted", foundNs.Name, onboardingv1alpha1.AdoptableLabel)
+	} else if !adopt && !metav1.IsControlledBy(foundNs, instance) {
+		// The Namespace belongs to another Environment or to nobody, it isn't taken over
+		if r.recorder != nil {
+			r.recorder.Event(instance, corev1.EventTypeWarning, "NamespaceConflict",
+				fmt.Sprintf("Namespace %s isn't controlled by the Environment", foundNs.Name))
+		}
+		return fmt.Errorf("namespace %s isn't controlled by Environment %s", foundNs.Name, instance.Name)
+	} else if adopt || foundNs.Labels[onboardingv1alpha1.EnvironmentLabel] != instance.Name {
+		// Namespaces created by older versions miss the Environment label
+		if foundNs.Labels == nil {
+			foundNs.Labels = map[string]string{}
+		}
+		foundNs.Labels[onboardingv1alpha1.EnvironmentLabel] = instance.Name
+		if adopt {
+			// The Namespace existed before the Environment, which now owns it
+			reqLogger.Info("Adopting the Namespace", "Namespace.Name", foundNs.Name)
+			if err := controllerutil.SetControllerReference(instance, foundNs, r.scheme); err != nil {
+				return err
+			}
+		}
+		err = r.client.Update(ctx, foundNs)
+		if err != nil {
+			return err
+		}
+		if adopt && r.recorder != nil {
+			r.recorder.Event(instance, corev1.EventTypeNormal, "Adopted", fmt.Sprintf("Namespace %s adopted", foundNs.Name))
+		}
 	}
 	reqLogger.Info("Namespace reconciled", "Namespace.Name", foundNs.Name)
+	return nil
+}
 
-
+// reconcileResourceQuota creates or updates the ResourceQuota of the Environment namespace
+func (r *ReconcileEnvironment) reconcileResourceQuota(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error {
+	reqLogger := log.WithValues("Environment Name", instance.Name)
 
 	// Define a new resource quota object
-	rq := newResourceQuotaForCR(instance)
+	rq, err := newResourceQuotaForCR(env)
+	if err != nil {
+		return err
+	}
 	// Set Environment instance as the owner and controller
 	if err := controllerutil.SetControllerReference(instance, rq, r.scheme); err != nil {
-		return reconcile.Result{}, err
+		return err
 	}
 	// Check if this ResourceQuota already exists
 	foundResourceQuota := &corev1.ResourceQuota{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: rq.Name, Namespace: rq.Namespace}, foundResourceQuota)
+	err = r.client.Get(ctx, types.NamespacedName{Name: rq.Name, Namespace: rq.Namespace}, foundResourceQuota)
 	if err != nil && errors.IsNotFound(err) {
 		reqLogger.Info("Creating a new ResourceQuota", "ResourceQuota.Namespace", rq.Namespace, "ResourceQuota.Name", rq.Name)
-		err = r.client.Create(context.TODO(), rq)
+		err = r.client.Create(ctx, rq)
 		if err != nil {
-			return reconcile.Result{}, err
+			return err
 		}
+		audit(instance, quotaChanges(instance, rq.Name, nil, rq.Spec.Hard))
 	} else if err != nil {
-		return reconcile.Result{}, err
+		return err
 	} else {
 		//resourceQuota update
 		rq.ResourceVersion = foundResourceQuota.ResourceVersion
-		err = r.client.Update(context.TODO(), rq)
-		if err!=nil{
-			return reconcile.Result{}, err
+		err = r.client.Update(ctx, rq)
+		if err != nil {
+			return err
 		}
+		audit(instance, quotaChanges(instance, rq.Name, foundResourceQuota.Spec.Hard, rq.Spec.Hard))
+		// The quota controller updates the ResourceQuota status, which requeues the Environment to refresh its usage
+		instance.Status.Usage, instance.Status.MaxUsagePercent = quotaUsage(foundResourceQuota)
 	}
 	reqLogger.Info("ResourceQuota reconciled", "ResourceQuota.Namespace", rq.Namespace, "ResourceQuota.Name", rq.Name)
+	return nil
+}
+
+// reconcileLimitRange creates or updates the LimitRange of the Environment namespace
+func (r *ReconcileEnvironment) reconcileLimitRange(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error {
+	reqLogger := log.WithValues("Environment Name", instance.Name)
 
 	// Define a new resource limitRange object
-	limitRange := getLimiteRange(instance)
+	limitRange := getLimiteRange(env)
 	// Set Environment instance as the owner and controller
 	if err := controllerutil.SetControllerReference(instance, limitRange, r.scheme); err != nil {
-		return reconcile.Result{}, err
+		return err
 	}
 	// Check if this LimitRange already exists
 	foundLimitRange := &corev1.LimitRange{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: limitRange.Name, Namespace: limitRange.Namespace}, foundLimitRange)
+	err := r.client.Get(ctx, types.NamespacedName{Name: limitRange.Name, Namespace: limitRange.Namespace}, foundLimitRange)
 	if err != nil && errors.IsNotFound(err) {
 		reqLogger.Info("Creating a new LimitRange", "LimitRange.Namespace", limitRange.Namespace, "LimitRange.Name", limitRange.Name)
-		err = r.client.Create(context.TODO(), limitRange)
+		err = r.client.Create(ctx, limitRange)
 		if err != nil {
-			return reconcile.Result{}, err
+			return err
 		}
 	} else if err != nil {
-		return reconcile.Result{}, err
+		return err
+	} else if !equality.Semantic.DeepEqual(foundLimitRange.Spec, limitRange.Spec) || metav1.GetControllerOf(foundLimitRange) == nil {
+		// The container defaults were changed in the operator configuration or the Environment, or the LimitRange
+		// of an adopted Namespace isn't owned yet
+		reqLogger.Info("Updating the LimitRange", "LimitRange.Namespace", limitRange.Namespace, "LimitRange.Name", limitRange.Name)
+		limitRange.ResourceVersion = foundLimitRange.ResourceVersion
+		err = r.client.Update(ctx, limitRange)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// reconcileRoleBindings creates or updates the RoleBindings granting the Environment users their role
+func (r *ReconcileEnvironment) reconcileRoleBindings(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error {
+	reqLogger := log.WithValues("Environment Name", instance.Name)
 
 	// Define a new rolebinding object
-	adminRolebinding := newRoleBindingForCR(instance)
+	adminRolebinding := newRoleBindingForCR(env)
 	for _, rolebinding := range adminRolebinding {
 		// Set Environment instance as the owner and controller
 		if err := controllerutil.SetControllerReference(instance, rolebinding, r.scheme); err != nil {
-			return reconcile.Result{}, err
+			return err
 		}
 		// Check if this RoleBinding already exists
 		foundRb := &v1.RoleBinding{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: rolebinding.Name, Namespace: rolebinding.Namespace}, foundRb)
+		err := r.client.Get(ctx, types.NamespacedName{Name: rolebinding.Name, Namespace: rolebinding.Namespace}, foundRb)
 		if err != nil && errors.IsNotFound(err) {
 			reqLogger.Info("Creating a new RoleBinding", "RoleBinding.Namespace", rolebinding.Namespace, "RoleBinding.Name", rolebinding.Name)
-			err = r.client.Create(context.TODO(), rolebinding)
+			err = r.client.Create(ctx, rolebinding)
 			if err != nil {
-				return reconcile.Result{}, err
+				return err
 			}
+			audit(instance, subjectsChanges(instance, rolebinding.Name, nil, rolebinding.Subjects))
 		} else if err != nil {
-			return reconcile.Result{}, err
-		}else {
+			return err
+		} else {
 			//roleBinding update
 			rolebinding.ResourceVersion = foundRb.ResourceVersion
-			err = r.client.Update(context.TODO(), rolebinding)
-			if err!=nil{
-				return reconcile.Result{}, err
+			err = r.client.Update(ctx, rolebinding)
+			if err != nil {
+				return err
 			}
+			audit(instance, subjectsChanges(instance, rolebinding.Name, foundRb.Subjects, rolebinding.Subjects))
 		}
 		reqLogger.Info("RoleBinding reconciled", "RoleBinding.Namespace", rolebinding.Namespace, "RoleBinding.Name", rolebinding.Name)
 	}
-
-	return reconcile.Result{}, nil
+	return nil
 }
 
-// newNamespaceForCR returns a namespace with the name and labels defined in the cr spec
+// newNamespaceForCR returns a namespace with the name and labels defined in the cr spec, labelled with the
+// Environment name
 func newNamespaceForCR(cr *onboardingv1alpha1.Environment) *corev1.Namespace {
+	labels := map[string]string{}
+	for k, v := range cr.Labels {
+		labels[k] = v
+	}
+	labels[onboardingv1alpha1.EnvironmentLabel] = cr.Name
 	namespace := &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:   cr.Spec.Name,
-			Labels: cr.Labels,
+			Labels: labels,
 		},
 	}
 	return namespace
 }
 
-// newResourceQuotaForCR returns a resourcequota with the name and labels defined in the cr spec
-func newResourceQuotaForCR(cr *onboardingv1alpha1.Environment) *corev1.ResourceQuota {
+// newResourceQuotaForCR returns a resourcequota with the name and labels defined in the cr spec, or an error when a
+// quantity of the spec is empty or invalid
+func newResourceQuotaForCR(cr *onboardingv1alpha1.Environment) (*corev1.ResourceQuota, error) {
+	quantities := []struct {
+		name     corev1.ResourceName
+		field    string
+		quantity string
+	}{
+		{"requests.cpu", "resources.requests.cpu", cr.Spec.Resources.ResourceRequests.CPU},
+		{"requests.memory", "resources.requests.memory", cr.Spec.Resources.ResourceRequests.Memory},
+		{"requests.ephemeral-storage", "resources.requests.ephemeral-storage", cr.Spec.Resources.ResourceRequests.EphemeralStorage},
+		{"limits.cpu", "resources.limits.cpu", cr.Spec.Resources.ResourceLimits.CPU},
+		{"limits.memory", "resources.limits.memory", cr.Spec.Resources.ResourceLimits.Memory},
+		{"limits.ephemeral-storage", "resources.limits.ephemeral-storage", cr.Spec.Resources.ResourceLimits.EphemeralStorage},
+		{"requests.storage", "storage", cr.Spec.Storage},
+	}
+	hard := corev1.ResourceList{}
+	for _, q := range quantities {
+		quantity, err := resource.ParseQuantity(q.quantity)
+		if err != nil {
+			return nil, fmt.Errorf("spec.%s %q: %v", q.field, q.quantity, err)
+		}
+		hard[q.name] = quantity
+	}
 	resourceQuota := &corev1.ResourceQuota{
 		TypeMeta: metav1.TypeMeta{
 			Kind: "ResourceQuota",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "cno-resource-quota",
+			Name:      operatorconfig.Get().ObjectNames.ResourceQuota,
 			Namespace: cr.Spec.Name,
 			Labels:    cr.Labels,
 		},
 		Spec: corev1.ResourceQuotaSpec{
-			Hard: corev1.ResourceList{
-				"requests.cpu":               resource.MustParse(cr.Spec.Resources.ResourceRequests.CPU),
-				"requests.memory":            resource.MustParse(cr.Spec.Resources.ResourceRequests.Memory),
-				"requests.ephemeral-storage": resource.MustParse(cr.Spec.Resources.ResourceRequests.EphemeralStorage),
-				"limits.cpu":                 resource.MustParse(cr.Spec.Resources.ResourceLimits.CPU),
-				"limits.memory":              resource.MustParse(cr.Spec.Resources.ResourceLimits.Memory),
-				"limits.ephemeral-storage":   resource.MustParse(cr.Spec.Resources.ResourceLimits.EphemeralStorage),
-				"requests.storage":           resource.MustParse(cr.Spec.Storage),
-			},
+			Hard: hard,
 		},
 	}
-	return resourceQuota
+	return resourceQuota, nil
 }
 
+// getLimiteRange returns the limitrange of the container defaults of the operator configuration, overridden by
+// the ones of the cr spec
 func getLimiteRange(cr *onboardingv1alpha1.Environment) *corev1.LimitRange {
+	cfg := operatorconfig.Get()
+	defaults, defaultRequests := cfg.LimitRange.Default, cfg.LimitRange.DefaultRequest
+	if overrides := cr.Spec.LimitRange; overrides != nil {
+		if len(overrides.Default) > 0 {
+			defaults = overrides.Default
+		}
+		if len(overrides.DefaultRequest) > 0 {
+			defaultRequests = overrides.DefaultRequest
+		}
+	}
 	return &corev1.LimitRange{
 		TypeMeta: metav1.TypeMeta{
 			Kind: "LimitRange",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "cno-limit-range",
+			Name:      cfg.ObjectNames.LimitRange,
 			Namespace: cr.Spec.Name,
 			Labels:    cr.Labels,
 		},
 		Spec: corev1.LimitRangeSpec{
-			Limits: []corev1.LimitRangeItem {
+			Limits: []corev1.LimitRangeItem{
 				{
-					Type: "Container",
-					Default: corev1.ResourceList{
-						"cpu":    resource.MustParse("500m"),
-						"memory": resource.MustParse("512Mi"),
-					},
-					DefaultRequest: corev1.ResourceList{
-						"cpu":    resource.MustParse("100m"),
-						"memory": resource.MustParse("256Mi"),
-					},
+					Type:           "Container",
+					Default:        defaults.DeepCopy(),
+					DefaultRequest: defaultRequests.DeepCopy(),
 				},
 			},
 		},
@@ -284,6 +566,7 @@ func getLimiteRange(cr *onboardingv1alpha1.Environment) *corev1.LimitRange {
 
 // newRolebindingForCR returns a rolebinding with the name and labels defined in the cr spec
 func newRoleBindingForCR(cr *onboardingv1alpha1.Environment) []*v1.RoleBinding {
+	cfg := operatorconfig.Get()
 	var result []*v1.RoleBinding
 	var admins, viewers []v1.Subject
 	for _, user := range cr.Spec.Users {
@@ -292,7 +575,7 @@ func newRoleBindingForCR(cr *onboardingv1alpha1.Environment) []*v1.RoleBinding {
 				Kind: "User",
 				Name: user.Username,
 			})
-		} else if user.Role == "dev" && !cr.Spec.IsProd{
+		} else if user.Role == "dev" && !cr.Spec.IsProd {
 			admins = append(admins, v1.Subject{
 				Kind: "User",
 				Name: user.Username,
@@ -306,13 +589,13 @@ func newRoleBindingForCR(cr *onboardingv1alpha1.Environment) []*v1.RoleBinding {
 	}
 	adminRoleBinding := &v1.RoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "cno-admin-role-binding",
+			Name:      cfg.ObjectNames.AdminRoleBinding,
 			Namespace: cr.Spec.Name,
 			Labels:    cr.Labels,
 		},
 		Subjects: admins,
 		RoleRef: v1.RoleRef{
-			Name:     "cno-admin-cluster-role",
+			Name:     cfg.ClusterRoles.Admin,
 			Kind:     "ClusterRole",
 			APIGroup: "rbac.authorization.k8s.io",
 		},
@@ -320,13 +603,13 @@ func newRoleBindingForCR(cr *onboardingv1alpha1.Environment) []*v1.RoleBinding {
 	result = append(result, adminRoleBinding)
 	viewerRoleBinding := &v1.RoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "cno-viewer-role-binding",
+			Name:      cfg.ObjectNames.ViewerRoleBinding,
 			Namespace: cr.Spec.Name,
 			Labels:    cr.Labels,
 		},
 		Subjects: viewers,
 		RoleRef: v1.RoleRef{
-			Name:     "cno-viewer-cluster-role",
+			Name:     cfg.ClusterRoles.Viewer,
 			Kind:     "ClusterRole",
 			APIGroup: "rbac.authorization.k8s.io",
 		},
@@ -14,6 +14,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
@@ -62,8 +63,12 @@ var (
 
 	namespace = &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   environment.Spec.Name,
-			Labels: environment.Labels,
+			Name: environment.Spec.Name,
+			Labels: map[string]string{
+				"uid":                                "test-uid",
+				"name":                               "environment",
+				onboardingv1alpha1.EnvironmentLabel: name,
+			},
 		},
 	}
 
@@ -141,7 +146,7 @@ func TestEnvironmentController(t *testing.T) {
 
 	// Register operator types with the runtime scheme.
 	s := scheme.Scheme
-	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, environment)
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, environment, &onboardingv1alpha1.EnvironmentPolicyList{})
 
 	// Create a fake client to mock API calls.
 	cl := fake.NewFakeClient(objs...)
@@ -229,12 +234,22 @@ func TestNewNamespaceForCR(t *testing.T) {
 }
 
 func TestNewResourceQuotaForCR(t *testing.T) {
-	rq := newResourceQuotaForCR(environment)
+	rq, err := newResourceQuotaForCR(environment)
+	if err != nil {
+		t.Fatalf("newResourceQuotaForCR: (%v)", err)
+	}
 	if !reflect.DeepEqual(resourceQuota, rq) {
 		t.Errorf("newResourceQuotaForCR didn't produce the expected output")
 	} else {
 		t.Logf("newResourceQuotaForCR produced the expected resourcequota")
 	}
+
+	// An empty quantity is an error, not a panic
+	empty := environment.DeepCopy()
+	empty.Spec.Resources = onboardingv1alpha1.Resources{}
+	if _, err := newResourceQuotaForCR(empty); err == nil {
+		t.Errorf("newResourceQuotaForCR accepted empty resources")
+	}
 }
 func TestNewRoleBindingForCR(t *testing.T) {
 	rb := newRoleBindingForCR(environment)
@@ -251,3 +266,101 @@ func TestNewRoleBindingForCR(t *testing.T) {
 		t.Logf("newRoleBindingForCR produced the expected rolebinding")
 	}
 }
+
+func TestAdoptedNamespace(t *testing.T) {
+	env := environment.DeepCopy()
+	env.Spec.Adopt = true
+	env.Spec.LimitRange = &onboardingv1alpha1.LimitRangeDefaults{
+		Default: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+	}
+	legacy := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: projectname, Labels: map[string]string{"team": "a"}}}
+	optedIn := legacy.DeepCopy()
+	optedIn.Labels[onboardingv1alpha1.AdoptableLabel] = "true"
+	limitRange := &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: "cno-limit-range", Namespace: projectname},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+			Type:           "Container",
+			Default:        corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			DefaultRequest: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("256Mi")},
+		}}},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env, legacy, limitRange)
+	r := &ReconcileEnvironment{client: cl, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	// A Namespace that isn't opted in isn't adopted
+	if _, err := r.Reconcile(req); err == nil {
+		t.Fatalf("reconcile should fail on a Namespace that isn't adoptable")
+	}
+	adopted := &corev1.Namespace{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: projectname}, adopted); err != nil {
+		t.Fatalf("get namespace: (%v)", err)
+	}
+	if owner := metav1.GetControllerOf(adopted); owner != nil {
+		t.Fatalf("Namespace shouldn't be adopted without opt-in, got owner %v", owner)
+	}
+	optedIn.ResourceVersion = adopted.ResourceVersion
+	if err := cl.Update(context.TODO(), optedIn); err != nil {
+		t.Fatalf("update namespace: (%v)", err)
+	}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: projectname}, adopted); err != nil {
+		t.Fatalf("get namespace: (%v)", err)
+	}
+	if owner := metav1.GetControllerOf(adopted); owner == nil || owner.Name != name || adopted.Labels["team"] != "a" {
+		t.Errorf("Namespace should be adopted in place, got owner %v and labels %v", owner, adopted.Labels)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "cno-limit-range", Namespace: projectname}, limitRange); err != nil {
+		t.Fatalf("get limitrange: (%v)", err)
+	}
+	if owner := metav1.GetControllerOf(limitRange); owner == nil || owner.Name != name {
+		t.Errorf("LimitRange should be adopted, got owner %v", owner)
+	}
+	if cpu := limitRange.Spec.Limits[0].Default[corev1.ResourceCPU]; cpu.String() != "1" {
+		t.Errorf("LimitRange should keep the default cpu of the Environment, got %s", cpu.String())
+	}
+}
+
+func TestNamespaceOfAnotherEnvironment(t *testing.T) {
+	env := environment.DeepCopy()
+	env.UID = "environment-uid"
+	other := environment.DeepCopy()
+	other.Name = "other"
+	other.UID = "other-uid"
+	controller := true
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   projectname,
+		Labels: map[string]string{onboardingv1alpha1.EnvironmentLabel: other.Name},
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: onboardingv1alpha1.SchemeGroupVersion.String(),
+			Kind:       "Environment",
+			Name:       other.Name,
+			UID:        other.UID,
+			Controller: &controller,
+		}},
+	}}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env, other, ns)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileEnvironment{client: cl, scheme: s, recorder: recorder}
+
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}); err == nil {
+		t.Fatalf("reconcile should fail on a Namespace controlled by another Environment")
+	}
+	found := &corev1.Namespace{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: projectname}, found); err != nil {
+		t.Fatalf("get namespace: (%v)", err)
+	}
+	if found.Labels[onboardingv1alpha1.EnvironmentLabel] != other.Name || !metav1.IsControlledBy(found, other) {
+		t.Errorf("Namespace should stay with Environment %s, got labels %v", other.Name, found.Labels)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("a NamespaceConflict event should be recorded, got %d events", len(recorder.Events))
+	}
+}
@@ -0,0 +1,228 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultWarningPeriod is how long before their expiry the owners of an Environment are warned, when the
+// EnvironmentPolicies of its tier don't set it
+const defaultWarningPeriod = 3 * 24 * time.Hour
+
+// expiryNotification is the body of the expiry warnings posted to QuotaAlertHook
+type expiryNotification struct {
+	Environment string      `json:"environment"`
+	Namespace   string      `json:"namespace"`
+	Reason      string      `json:"reason"`
+	Message     string      `json:"message"`
+	ExpiresAt   metav1.Time `json:"expiresAt"`
+}
+
+// expiry holds the expiry settings of an Environment
+type expiry struct {
+	// ttl after the last activity, no expiry when zero
+	ttl     time.Duration
+	warning time.Duration
+	action  string
+}
+
+// reconcileExpiry sets the expiry of a non-production Environment in its status, warns its owners when the expiry
+// is near and deletes the Environment once it is reached with the Delete action. The expiry is read from env, the
+// Environment holding the approved spec, nil when nothing was approved yet. It returns whether the Environment was
+// deleted, and otherwise how long until its next expiry deadline, zero when there is none. An Environment expired
+// with the Hibernate action is hibernated by the hibernation step.
+func (r *ReconcileEnvironment) reconcileExpiry(ctx context.Context, instance, env *onboardingv1alpha1.Environment, now time.Time) (bool, time.Duration, error) {
+	reqLogger := log.WithValues("Environment Name", instance.Name)
+
+	// Production Environments never expire, nor the Environments whose changes wait for an approval: an unapproved
+	// spec leaving production mustn't get them deleted
+	if env == nil || requiresApproval(instance) || env.Tier() == onboardingv1alpha1.TierProd {
+		clearExpiry(instance)
+		return false, 0, nil
+	}
+	settings, err := r.expirySettings(ctx, env)
+	if err != nil {
+		return false, 0, err
+	}
+	if settings.ttl == 0 && env.Spec.ExpiresAt == nil {
+		clearExpiry(instance)
+		return false, 0, nil
+	}
+
+	lastActivity, err := r.lastActivity(ctx, env)
+	if err != nil {
+		return false, 0, err
+	}
+	instance.Status.LastActivity = &metav1.Time{Time: lastActivity}
+	expiresAt, invalid := expiryTime(env, lastActivity, settings.ttl)
+	instance.Status.ExpiresAt = &metav1.Time{Time: expiresAt}
+
+	if !now.Before(expiresAt) && settings.action == onboardingv1alpha1.ExpiryDelete {
+		reqLogger.Info("Environment expired", "ExpiresAt", expiresAt, "Action", settings.action)
+		if r.recorder != nil {
+			r.recorder.Event(instance, corev1.EventTypeWarning, "Expired",
+				fmt.Sprintf("expired at %s, %s", expiresAt.UTC().Format(time.RFC3339), settings.action))
+		}
+		// The child objects are garbage collected with the Environment
+		if err := r.client.Delete(ctx, instance); err != nil && !errors.IsNotFound(err) {
+			return false, 0, err
+		}
+		return true, 0, nil
+	}
+
+	condition := status.Condition{
+		Type:    onboardingv1alpha1.ExpiringCondition,
+		Status:  corev1.ConditionFalse,
+		Reason:  onboardingv1alpha1.ExpiryScheduled,
+		Message: fmt.Sprintf("%s at %s", settings.action, expiresAt.UTC().Format(time.RFC3339)),
+	}
+	if invalid != nil {
+		condition.Message += ", " + invalid.Error()
+	}
+	warnAt := expiresAt.Add(-settings.warning)
+	next := warnAt
+	switch {
+	case !now.Before(expiresAt):
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = onboardingv1alpha1.ExpiryReached
+		condition.Message = fmt.Sprintf("expired at %s, %s", expiresAt.UTC().Format(time.RFC3339), settings.action)
+		next = now
+	case !now.Before(warnAt):
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = onboardingv1alpha1.ExpiryWarning
+		next = expiresAt
+	}
+	changed := !instance.Status.Conditions.IsTrueFor(onboardingv1alpha1.ExpiringCondition) && condition.IsTrue()
+	instance.Status.Conditions.SetCondition(condition)
+	if changed {
+		reqLogger.Info("Environment expiring", "ExpiresAt", expiresAt)
+		if r.recorder != nil {
+			r.recorder.Event(instance, corev1.EventTypeWarning, string(onboardingv1alpha1.ExpiringCondition),
+				fmt.Sprintf("%s: %s, extend it with the %s annotation", condition.Reason, condition.Message,
+					onboardingv1alpha1.ExtendUntilAnnotation))
+		}
+		if QuotaAlertHook != "" {
+			err := notify(expiryNotification{
+				Environment: instance.Name,
+				Namespace:   instance.Spec.Name,
+				Reason:      string(condition.Reason),
+				Message:     condition.Message,
+				ExpiresAt:   *instance.Status.ExpiresAt,
+			})
+			if err != nil {
+				// A failed notification doesn't fail the reconcile, the condition and the event still report it
+				reqLogger.Error(err, "Failed to notify the expiry", "Hook", QuotaAlertHook)
+			}
+		}
+	}
+	return false, next.Sub(now), nil
+}
+
+// clearExpiry removes the expiry of an Environment that doesn't expire from its status
+func clearExpiry(instance *onboardingv1alpha1.Environment) {
+	instance.Status.LastActivity = nil
+	instance.Status.ExpiresAt = nil
+	instance.Status.Conditions.RemoveCondition(onboardingv1alpha1.ExpiringCondition)
+}
+
+// expirySettings returns the expiry settings of the Environment: the lowest TTL and the longest warning period
+// of the EnvironmentPolicy rules of its tier, the TTL and the action of the Environment taking precedence
+func (r *ReconcileEnvironment) expirySettings(ctx context.Context, instance *onboardingv1alpha1.Environment) (expiry, error) {
+	settings := expiry{}
+	policies := &onboardingv1alpha1.EnvironmentPolicyList{}
+	if err := r.client.List(ctx, policies); err != nil {
+		return settings, err
+	}
+	for _, policy := range policies.Items {
+		for _, rule := range policy.Spec.Rules {
+			if (rule.Tier != "" && rule.Tier != instance.Tier()) || rule.Expiry == nil {
+				continue
+			}
+			if ttl := rule.Expiry.TTL; ttl != nil && ttl.Duration > 0 && (settings.ttl == 0 || ttl.Duration < settings.ttl) {
+				settings.ttl = ttl.Duration
+			}
+			if warning := rule.Expiry.WarningPeriod; warning != nil && warning.Duration > settings.warning {
+				settings.warning = warning.Duration
+			}
+			if settings.action == "" {
+				settings.action = rule.Expiry.Action
+			}
+		}
+	}
+	if instance.Spec.TTL != nil {
+		settings.ttl = instance.Spec.TTL.Duration
+	}
+	if instance.Spec.ExpiryAction != "" {
+		settings.action = instance.Spec.ExpiryAction
+	}
+	if settings.warning == 0 {
+		settings.warning = defaultWarningPeriod
+	}
+	if settings.action == "" {
+		settings.action = onboardingv1alpha1.ExpiryDelete
+	}
+	if instance.Spec.Adopt && settings.action == onboardingv1alpha1.ExpiryDelete {
+		// The adopted Namespace existed before the Environment, it isn't deleted with it
+		settings.action = onboardingv1alpha1.ExpiryHibernate
+	}
+	return settings, nil
+}
+
+// expiryTime returns the expiry of the Environment: its expiresAt, or its last activity plus the TTL, postponed
+// by the extend-until annotation. An annotation that can't be parsed is ignored and returned as an error.
+func expiryTime(cr *onboardingv1alpha1.Environment, lastActivity time.Time, ttl time.Duration) (time.Time, error) {
+	expiresAt := lastActivity.Add(ttl)
+	if cr.Spec.ExpiresAt != nil {
+		expiresAt = cr.Spec.ExpiresAt.Time
+	}
+	value, ok := cr.Annotations[onboardingv1alpha1.ExtendUntilAnnotation]
+	if !ok {
+		return expiresAt, nil
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return expiresAt, fmt.Errorf("invalid annotation %s: %v", onboardingv1alpha1.ExtendUntilAnnotation, err)
+	}
+	if until.After(expiresAt) {
+		expiresAt = until
+	}
+	return expiresAt, nil
+}
+
+// lastActivity returns the latest activity seen on the Environment: its creation, the latest update of its spec,
+// the latest Pod started in its Namespace, or the last activity of its status
+func (r *ReconcileEnvironment) lastActivity(ctx context.Context, instance *onboardingv1alpha1.Environment) (time.Time, error) {
+	latest := instance.CreationTimestamp.Time
+	later := func(t time.Time) {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	if instance.Status.LastActivity != nil {
+		later(instance.Status.LastActivity.Time)
+	}
+	for _, entry := range instance.ManagedFields {
+		if entry.Time != nil && entry.FieldsV1 != nil && bytes.Contains(entry.FieldsV1.Raw, []byte(`"f:spec"`)) {
+			later(entry.Time.Time)
+		}
+	}
+
+	// The Pods aren't cached, they are listed from the API server
+	pods := &corev1.PodList{}
+	if err := r.apiReader().List(ctx, pods, client.InNamespace(instance.Spec.Name)); err != nil {
+		return latest, err
+	}
+	for _, pod := range pods.Items {
+		later(pod.CreationTimestamp.Time)
+	}
+	return latest, nil
+}
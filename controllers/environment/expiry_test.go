@@ -0,0 +1,186 @@
+package environment
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestExpiryTime(t *testing.T) {
+	lastActivity := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := metav1.NewTime(time.Date(2020, 6, 3, 12, 0, 0, 0, time.UTC))
+	tests := []struct {
+		expiresAt   *metav1.Time
+		annotations map[string]string
+		expected    time.Time
+		invalid     bool
+	}{
+		{nil, nil, lastActivity.Add(24 * time.Hour), false},
+		{&expiresAt, nil, expiresAt.Time, false},
+		{nil, map[string]string{onboardingv1alpha1.ExtendUntilAnnotation: "2020-06-05T12:00:00Z"}, time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC), false},
+		// An extension doesn't bring the expiry forward
+		{&expiresAt, map[string]string{onboardingv1alpha1.ExtendUntilAnnotation: "2020-06-02T12:00:00Z"}, expiresAt.Time, false},
+		{nil, map[string]string{onboardingv1alpha1.ExtendUntilAnnotation: "next week"}, lastActivity.Add(24 * time.Hour), true},
+	}
+	for _, test := range tests {
+		env := environment.DeepCopy()
+		env.Spec.ExpiresAt = test.expiresAt
+		env.Annotations = test.annotations
+		expected, err := expiryTime(env, lastActivity, 24*time.Hour)
+		if !expected.Equal(test.expected) || (err != nil) != test.invalid {
+			t.Errorf("expiryTime(%v, %v): (%v, %v)", test.expiresAt, test.annotations, expected, err)
+		}
+	}
+}
+
+func TestExpiringEnvironment(t *testing.T) {
+	env := environment.DeepCopy()
+	env.CreationTimestamp = metav1.NewTime(time.Now().Add(-9 * 24 * time.Hour))
+	env.Spec.TTL = &metav1.Duration{Duration: 10 * 24 * time.Hour}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileEnvironment{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	// The Environment expires in a day, within the warning period
+	res, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if res.RequeueAfter <= 23*time.Hour || res.RequeueAfter > 24*time.Hour {
+		t.Errorf("reconcile should requeue the expiry in a day, got %v", res.RequeueAfter)
+	}
+	expiring := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, expiring); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if !expiring.Status.Conditions.IsTrueFor(onboardingv1alpha1.ExpiringCondition) || expiring.Status.ExpiresAt == nil {
+		t.Errorf("Environment should be expiring: %v", expiring.Status.Conditions)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Warning Expiring ExpiryWarning") {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("an expiry warning event should be recorded")
+	}
+
+	// A Pod started in the Namespace postpones the expiry
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:              "app",
+		Namespace:         projectname,
+		CreationTimestamp: metav1.Now(),
+	}}
+	if err := cl.Create(context.TODO(), pod); err != nil {
+		t.Fatalf("create pod: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	active := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, active); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	condition := active.Status.Conditions.GetCondition(onboardingv1alpha1.ExpiringCondition)
+	if condition == nil || condition.Reason != onboardingv1alpha1.ExpiryScheduled || !condition.IsFalse() {
+		t.Errorf("Environment expiry should be scheduled: %v", condition)
+	}
+	if active.Status.ExpiresAt.Before(expiring.Status.ExpiresAt) || active.Status.ExpiresAt.Equal(expiring.Status.ExpiresAt) {
+		t.Errorf("expiry should be postponed from %v, got %v", expiring.Status.ExpiresAt, active.Status.ExpiresAt)
+	}
+
+	// An Environment past its expiry is deleted
+	active.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	if err := cl.Update(context.TODO(), active); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, &onboardingv1alpha1.Environment{}); !errors.IsNotFound(err) {
+		t.Errorf("expired Environment should be deleted: (%v)", err)
+	}
+}
+
+func TestProductionEnvironmentDoesntExpire(t *testing.T) {
+	env := environment.DeepCopy()
+	env.Spec.IsProd = true
+	env.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	env.Status.ApprovedSpec = env.Spec.DeepCopy()
+	env.Status.ApprovedGeneration = env.Generation
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	r := &ReconcileEnvironment{client: cl, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	found := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, found); err != nil {
+		t.Fatalf("production Environment shouldn't expire: (%v)", err)
+	}
+	if found.Status.ExpiresAt != nil {
+		t.Errorf("production Environment shouldn't have an expiry: %v", found.Status.ExpiresAt)
+	}
+}
+
+func TestAdoptedEnvironmentHibernatesAtExpiry(t *testing.T) {
+	env := environment.DeepCopy()
+	env.Spec.Adopt = true
+	env.Spec.ExpiryAction = onboardingv1alpha1.ExpiryDelete
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	r := &ReconcileEnvironment{client: fake.NewFakeClient(env), scheme: s}
+
+	settings, err := r.expirySettings(context.TODO(), env)
+	if err != nil {
+		t.Fatalf("expiry settings: (%v)", err)
+	}
+	if settings.action != onboardingv1alpha1.ExpiryHibernate {
+		t.Errorf("adopted Environment should hibernate at expiry, got %s", settings.action)
+	}
+}
+
+func TestUnapprovedDowngradeDoesntExpire(t *testing.T) {
+	env := environment.DeepCopy()
+	env.Status.ApprovedSpec = env.Spec.DeepCopy()
+	env.Status.ApprovedSpec.IsProd = true
+	env.Status.ApprovedGeneration = env.Generation
+	// Left production with an expiry in the past, without approval
+	env.Generation = 1
+	env.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	env.Spec.ExpiryAction = onboardingv1alpha1.ExpiryDelete
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	r := &ReconcileEnvironment{client: cl, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	found := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, found); err != nil {
+		t.Fatalf("unapproved downgrade shouldn't expire the Environment: (%v)", err)
+	}
+	if found.Status.EnvironmentStatus != onboardingv1alpha1.EnvironmentPending || found.Status.ExpiresAt != nil {
+		t.Errorf("expected a pending Environment without expiry, got %v", found.Status)
+	}
+}
@@ -0,0 +1,257 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	"github.com/robfig/cron/v3"
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// hibernationLookback is how far back the schedules are evaluated to find the latest hibernation and wake-up,
+// so that weekly schedules are supported
+const hibernationLookback = 8 * 24 * time.Hour
+
+// hibernationState tells whether the Environment of the hibernation settings is hibernated at now, why, and when
+// its schedules next change the state (zero without schedule). The Environment is hibernated when its latest
+// scheduled hibernation is more recent than its latest scheduled wake-up.
+func hibernationState(hibernation *onboardingv1alpha1.Hibernation, now time.Time) (bool, status.ConditionReason, time.Time, error) {
+	if hibernation == nil {
+		return false, "", time.Time{}, nil
+	}
+	if hibernation.Hibernate {
+		return true, onboardingv1alpha1.HibernatedManually, time.Time{}, nil
+	}
+	if hibernation.Schedule == "" && hibernation.WakeUpSchedule == "" {
+		return false, "", time.Time{}, nil
+	}
+	schedule, err := parseSchedule("schedule", hibernation.Schedule)
+	if err != nil {
+		return false, onboardingv1alpha1.HibernationInvalid, time.Time{}, err
+	}
+	wakeUp, err := parseSchedule("wake-up schedule", hibernation.WakeUpSchedule)
+	if err != nil {
+		return false, onboardingv1alpha1.HibernationInvalid, time.Time{}, err
+	}
+
+	next := schedule.Next(now)
+	if wakeUpNext := wakeUp.Next(now); wakeUpNext.Before(next) {
+		next = wakeUpNext
+	}
+	if latestActivation(schedule, now).After(latestActivation(wakeUp, now)) {
+		return true, onboardingv1alpha1.HibernatedOnSchedule, next, nil
+	}
+	return false, onboardingv1alpha1.HibernationWokeUp, next, nil
+}
+
+// parseSchedule parses a hibernation cron schedule, both schedules being required
+func parseSchedule(name, value string) (cron.Schedule, error) {
+	if value == "" {
+		return nil, fmt.Errorf("the hibernation %s is missing", name)
+	}
+	schedule, err := cron.ParseStandard(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hibernation %s %q: %v", name, value, err)
+	}
+	return schedule, nil
+}
+
+// latestActivation returns the latest activation of the schedule within hibernationLookback of now, or zero
+func latestActivation(schedule cron.Schedule, now time.Time) time.Time {
+	var latest time.Time
+	for next := schedule.Next(now.Add(-hibernationLookback)); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+		latest = next
+	}
+	return latest
+}
+
+// reconcileHibernation hibernates the workloads of the Environment Namespace while its hibernation is on, or it
+// expired with the Hibernate action, and wakes them up otherwise
+func (r *ReconcileEnvironment) reconcileHibernation(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error {
+	reqLogger := log.WithValues("Environment Name", instance.Name)
+
+	now := time.Now()
+	hibernate, reason, next, invalid := hibernationState(env.Spec.Hibernation, now)
+	if expiring := instance.Status.Conditions.GetCondition(onboardingv1alpha1.ExpiringCondition); !hibernate &&
+		expiring != nil && expiring.Reason == onboardingv1alpha1.ExpiryReached {
+		hibernate, reason = true, onboardingv1alpha1.HibernatedAtExpiry
+	}
+	instance.Status.NextHibernationChange = nil
+	if !next.IsZero() {
+		instance.Status.NextHibernationChange = &metav1.Time{Time: next}
+	}
+	if !hibernate && reason == "" {
+		if instance.Status.Hibernation != onboardingv1alpha1.HibernationHibernated {
+			// The hibernation is off and nothing is left to wake up
+			instance.Status.Hibernation = ""
+			instance.Status.Conditions.RemoveCondition(onboardingv1alpha1.HibernatedCondition)
+			return nil
+		}
+		reason = onboardingv1alpha1.HibernationWokeUp
+	}
+
+	changed, err := r.hibernateWorkloads(ctx, env.Spec.Name, hibernate)
+	if err != nil {
+		return err
+	}
+
+	condition := status.Condition{
+		Type:    onboardingv1alpha1.HibernatedCondition,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: fmt.Sprintf("%d workloads woken up", changed),
+	}
+	state := onboardingv1alpha1.HibernationAwake
+	if hibernate {
+		condition.Status = corev1.ConditionTrue
+		condition.Message = fmt.Sprintf("%d workloads hibernated", changed)
+		state = onboardingv1alpha1.HibernationHibernated
+	}
+	if invalid != nil {
+		condition.Message = invalid.Error()
+	}
+	previous := instance.Status.Conditions.GetCondition(condition.Type)
+	if previous == nil || previous.Reason != condition.Reason || instance.Status.Hibernation != state {
+		reqLogger.Info("Environment hibernation changed", "Hibernation", state, "Reason", condition.Reason)
+		if r.recorder != nil {
+			eventType := corev1.EventTypeNormal
+			if invalid != nil {
+				eventType = corev1.EventTypeWarning
+			}
+			r.recorder.Event(instance, eventType, string(onboardingv1alpha1.HibernatedCondition),
+				fmt.Sprintf("%s: %s", condition.Reason, condition.Message))
+		}
+	} else {
+		// Only the transitions report the count of the workloads changed
+		condition.Message = previous.Message
+	}
+	instance.Status.Hibernation = state
+	instance.Status.Conditions.SetCondition(condition)
+	return nil
+}
+
+// hibernateWorkloads scales the Deployments and StatefulSets of the Namespace to zero and suspends its CronJobs
+// when hibernate is set, keeping their state in annotations, or restores them otherwise. It returns the count of
+// the workloads changed. The workloads aren't cached, they are listed from the API server.
+func (r *ReconcileEnvironment) hibernateWorkloads(ctx context.Context, namespace string, hibernate bool) (int, error) {
+	changed := 0
+	update := func(obj runtime.Object, modified bool) error {
+		if !modified {
+			return nil
+		}
+		changed++
+		return r.client.Update(ctx, obj)
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := r.apiReader().List(ctx, deployments, client.InNamespace(namespace)); err != nil {
+		return changed, err
+	}
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		if err := update(deployment, hibernateReplicas(deployment, &deployment.Spec.Replicas, hibernate)); err != nil {
+			return changed, err
+		}
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := r.apiReader().List(ctx, statefulSets, client.InNamespace(namespace)); err != nil {
+		return changed, err
+	}
+	for i := range statefulSets.Items {
+		statefulSet := &statefulSets.Items[i]
+		if err := update(statefulSet, hibernateReplicas(statefulSet, &statefulSet.Spec.Replicas, hibernate)); err != nil {
+			return changed, err
+		}
+	}
+
+	cronJobs := &batchv1beta1.CronJobList{}
+	if err := r.apiReader().List(ctx, cronJobs, client.InNamespace(namespace)); err != nil {
+		return changed, err
+	}
+	for i := range cronJobs.Items {
+		cronJob := &cronJobs.Items[i]
+		if err := update(cronJob, hibernateSuspend(cronJob, &cronJob.Spec.Suspend, hibernate)); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// hibernateReplicas scales the replicas of the workload to zero, keeping them in the hibernated-replicas
+// annotation, or restores them from the annotation. It tells whether the workload was modified.
+func hibernateReplicas(obj metav1.Object, replicas **int32, hibernate bool) bool {
+	annotations := obj.GetAnnotations()
+	kept, found := annotations[onboardingv1alpha1.HibernatedReplicasAnnotation]
+	if hibernate {
+		if found && *replicas != nil && **replicas == 0 {
+			return false
+		}
+		if !found {
+			// The API server defaults the replicas to 1
+			current := int32(1)
+			if *replicas != nil {
+				current = **replicas
+			}
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[onboardingv1alpha1.HibernatedReplicasAnnotation] = strconv.Itoa(int(current))
+			obj.SetAnnotations(annotations)
+		}
+		zero := int32(0)
+		*replicas = &zero
+		return true
+	}
+	if !found {
+		return false
+	}
+	if count, err := strconv.ParseInt(kept, 10, 32); err == nil {
+		restored := int32(count)
+		*replicas = &restored
+	} else {
+		log.Error(err, "Invalid hibernated replicas, the workload keeps its replicas", "Name", obj.GetName(), "Namespace", obj.GetNamespace())
+	}
+	delete(annotations, onboardingv1alpha1.HibernatedReplicasAnnotation)
+	obj.SetAnnotations(annotations)
+	return true
+}
+
+// hibernateSuspend suspends the CronJob, keeping whether it was suspended in the hibernated-suspend annotation, or
+// restores its suspension from the annotation. It tells whether the CronJob was modified.
+func hibernateSuspend(obj metav1.Object, suspend **bool, hibernate bool) bool {
+	annotations := obj.GetAnnotations()
+	kept, found := annotations[onboardingv1alpha1.HibernatedSuspendAnnotation]
+	if hibernate {
+		if found && *suspend != nil && **suspend {
+			return false
+		}
+		if !found {
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[onboardingv1alpha1.HibernatedSuspendAnnotation] = strconv.FormatBool(*suspend != nil && **suspend)
+			obj.SetAnnotations(annotations)
+		}
+		suspended := true
+		*suspend = &suspended
+		return true
+	}
+	if !found {
+		return false
+	}
+	restored := kept == "true"
+	*suspend = &restored
+	delete(annotations, onboardingv1alpha1.HibernatedSuspendAnnotation)
+	obj.SetAnnotations(annotations)
+	return true
+}
@@ -0,0 +1,149 @@
+package environment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestHibernationState(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2020, 6, 3, 22, 0, 0, 0, time.UTC)
+	nights := &onboardingv1alpha1.Hibernation{Schedule: "0 20 * * 1-5", WakeUpSchedule: "0 7 * * 1-5"}
+	tests := []struct {
+		name        string
+		hibernation *onboardingv1alpha1.Hibernation
+		now         time.Time
+		hibernated  bool
+		next        time.Time
+		invalid     bool
+	}{
+		{"no hibernation", nil, now, false, time.Time{}, false},
+		{"manual", &onboardingv1alpha1.Hibernation{Hibernate: true, Schedule: "0 20 * * 1-5"}, now, true, time.Time{}, false},
+		{"night", nights, now, true, time.Date(2020, 6, 4, 7, 0, 0, 0, time.UTC), false},
+		{"day", nights, now.Add(-12 * time.Hour), false, time.Date(2020, 6, 3, 20, 0, 0, 0, time.UTC), false},
+		// Friday evening until Monday morning
+		{"weekend", nights, time.Date(2020, 6, 7, 12, 0, 0, 0, time.UTC), true, time.Date(2020, 6, 8, 7, 0, 0, 0, time.UTC), false},
+		{"time zone", &onboardingv1alpha1.Hibernation{Schedule: "CRON_TZ=Europe/Paris 0 20 * * *", WakeUpSchedule: "CRON_TZ=Europe/Paris 0 7 * * *"},
+			time.Date(2020, 6, 3, 18, 30, 0, 0, time.UTC), true, time.Date(2020, 6, 4, 5, 0, 0, 0, time.UTC), false},
+		{"missing wake-up", &onboardingv1alpha1.Hibernation{Schedule: "0 20 * * 1-5"}, now, false, time.Time{}, true},
+	}
+	for _, test := range tests {
+		hibernated, _, next, err := hibernationState(test.hibernation, test.now)
+		if hibernated != test.hibernated || !next.Equal(test.next) || (err != nil) != test.invalid {
+			t.Errorf("%s: hibernationState: (%v, %v, %v)", test.name, hibernated, next, err)
+		}
+	}
+}
+
+func TestHibernatedEnvironment(t *testing.T) {
+	env := environment.DeepCopy()
+	env.Spec.Hibernation = &onboardingv1alpha1.Hibernation{Hibernate: true}
+	replicas := int32(3)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: projectname},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: projectname}}
+	cronJob := &batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: projectname}}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env, deployment, statefulSet, cronJob)
+	r := &ReconcileEnvironment{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	hibernated := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, hibernated); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if hibernated.Status.Hibernation != onboardingv1alpha1.HibernationHibernated ||
+		!hibernated.Status.Conditions.IsTrueFor(onboardingv1alpha1.HibernatedCondition) {
+		t.Errorf("Environment should be hibernated: %v", hibernated.Status.Conditions)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "web", Namespace: projectname}, deployment); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	if *deployment.Spec.Replicas != 0 || deployment.Annotations[onboardingv1alpha1.HibernatedReplicasAnnotation] != "3" {
+		t.Errorf("Deployment should be scaled to zero, got %d replicas and annotations %v", *deployment.Spec.Replicas, deployment.Annotations)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "db", Namespace: projectname}, statefulSet); err != nil {
+		t.Fatalf("get statefulset: (%v)", err)
+	}
+	if *statefulSet.Spec.Replicas != 0 || statefulSet.Annotations[onboardingv1alpha1.HibernatedReplicasAnnotation] != "1" {
+		t.Errorf("StatefulSet should be scaled to zero, got %d replicas and annotations %v", *statefulSet.Spec.Replicas, statefulSet.Annotations)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "backup", Namespace: projectname}, cronJob); err != nil {
+		t.Fatalf("get cronjob: (%v)", err)
+	}
+	if !*cronJob.Spec.Suspend || cronJob.Annotations[onboardingv1alpha1.HibernatedSuspendAnnotation] != "false" {
+		t.Errorf("CronJob should be suspended, got annotations %v", cronJob.Annotations)
+	}
+
+	// Waking the Environment up restores its workloads
+	hibernated.Spec.Hibernation.Hibernate = false
+	if err := cl.Update(context.TODO(), hibernated); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	awake := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, awake); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if awake.Status.Hibernation != onboardingv1alpha1.HibernationAwake ||
+		!awake.Status.Conditions.IsFalseFor(onboardingv1alpha1.HibernatedCondition) {
+		t.Errorf("Environment should be awake: %v", awake.Status.Conditions)
+	}
+	deployment = &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "web", Namespace: projectname}, deployment); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	if *deployment.Spec.Replicas != 3 || len(deployment.Annotations) != 0 {
+		t.Errorf("Deployment replicas should be restored, got %d replicas and annotations %v", *deployment.Spec.Replicas, deployment.Annotations)
+	}
+	cronJob = &batchv1beta1.CronJob{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "backup", Namespace: projectname}, cronJob); err != nil {
+		t.Fatalf("get cronjob: (%v)", err)
+	}
+	if *cronJob.Spec.Suspend || len(cronJob.Annotations) != 0 {
+		t.Errorf("CronJob should be resumed, got annotations %v", cronJob.Annotations)
+	}
+}
+
+func TestHibernatedAtExpiry(t *testing.T) {
+	env := environment.DeepCopy()
+	env.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	env.Spec.ExpiryAction = onboardingv1alpha1.ExpiryHibernate
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	r := &ReconcileEnvironment{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	expired := &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, expired); err != nil {
+		t.Fatalf("expired Environment shouldn't be deleted: (%v)", err)
+	}
+	condition := expired.Status.Conditions.GetCondition(onboardingv1alpha1.HibernatedCondition)
+	if condition == nil || !condition.IsTrue() || condition.Reason != onboardingv1alpha1.HibernatedAtExpiry {
+		t.Errorf("expired Environment should be hibernated: %v", condition)
+	}
+}
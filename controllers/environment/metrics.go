@@ -0,0 +1,119 @@
+package environment
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	environmentsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "onboarding_environments",
+		Help: "Number of Environments by phase and tier",
+	}, []string{"phase", "tier"})
+
+	environmentUsersGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "onboarding_environment_users",
+		Help: "Number of users of an Environment by role",
+	}, []string{"environment", "role"})
+
+	reconcileStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "onboarding_reconcile_step_duration_seconds",
+		Help: "Duration of the Environment reconcile steps",
+	}, []string{"step"})
+
+	reconcileStepErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "onboarding_reconcile_step_errors_total",
+		Help: "Number of errors of the Environment reconcile steps",
+	}, []string{"step"})
+
+	timeToReady = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "onboarding_environment_time_to_ready_seconds",
+		Help:    "Time from the creation of an Environment to its first Ready status",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	})
+)
+
+func init() {
+	// Register the metrics in the controller-runtime registry served on the metrics port
+	metrics.Registry.MustRegister(environmentsGauge, environmentUsersGauge, reconcileStepDuration, reconcileStepErrors, timeToReady)
+}
+
+// environmentMetrics is the last state of an Environment reported in the gauges
+type environmentMetrics struct {
+	phase string
+	tier  string
+	roles map[string]int
+}
+
+var (
+	metricsMu sync.Mutex
+	// reported holds the state reported for each Environment by name
+	reported = map[string]environmentMetrics{}
+)
+
+// observeStep records the duration and the error of a reconcile step started at start
+func observeStep(step string, start time.Time, err error) {
+	reconcileStepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+	if err != nil {
+		reconcileStepErrors.WithLabelValues(step).Inc()
+	}
+}
+
+// markReady records the time the Environment becomes Ready for the first time, before its status is set Ready, and
+// tells whether the time it took is observed. The Environments Ready before ReadyAt was recorded, with an approved
+// spec or a Ready status, get it without being observed: their age isn't the time they took.
+func markReady(cr *onboardingv1alpha1.Environment, now time.Time) bool {
+	if cr.Status.ReadyAt != nil {
+		return false
+	}
+	readyAt := metav1.NewTime(now)
+	cr.Status.ReadyAt = &readyAt
+	return cr.Status.ApprovedSpec == nil && cr.Status.EnvironmentStatus != onboardingv1alpha1.EnvironmentReady
+}
+
+// observeReady records the time the Environment took to become Ready for the first time
+func observeReady(cr *onboardingv1alpha1.Environment) {
+	timeToReady.Observe(cr.Status.ReadyAt.Sub(cr.CreationTimestamp.Time).Seconds())
+}
+
+// reportEnvironment updates the gauges with the state of the Environment
+func reportEnvironment(cr *onboardingv1alpha1.Environment) {
+	roles := map[string]int{}
+	for _, user := range cr.Spec.Users {
+		roles[user.Role]++
+	}
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	forget(cr.Name)
+	reported[cr.Name] = environmentMetrics{phase: cr.Status.EnvironmentStatus, tier: cr.Tier(), roles: roles}
+	environmentsGauge.WithLabelValues(cr.Status.EnvironmentStatus, cr.Tier()).Inc()
+	for role, count := range roles {
+		environmentUsersGauge.WithLabelValues(cr.Name, role).Set(float64(count))
+	}
+}
+
+// forgetEnvironment removes a deleted Environment from the gauges
+func forgetEnvironment(name string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	forget(name)
+}
+
+// forget removes the state reported for an Environment, metricsMu must be held
+func forget(name string) {
+	previous, ok := reported[name]
+	if !ok {
+		return
+	}
+	environmentsGauge.WithLabelValues(previous.phase, previous.tier).Dec()
+	for role := range previous.roles {
+		environmentUsersGauge.DeleteLabelValues(name, role)
+	}
+	delete(reported, name)
+}
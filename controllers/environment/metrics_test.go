@@ -0,0 +1,84 @@
+package environment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestEnvironmentMetrics(t *testing.T) {
+	env := environment.DeepCopy()
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	r := &ReconcileEnvironment{client: cl, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if got := testutil.ToFloat64(environmentsGauge.WithLabelValues(onboardingv1alpha1.EnvironmentReady, onboardingv1alpha1.TierDev)); got != 1 {
+		t.Errorf("ready environments: (%v)", got)
+	}
+	if got := testutil.ToFloat64(environmentUsersGauge.WithLabelValues(name, "admin")); got != 1 {
+		t.Errorf("admin users: (%v)", got)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if env.Status.ReadyAt == nil {
+		t.Errorf("the first Ready status should be recorded")
+	}
+
+	// Reconciling again doesn't count the Environment twice
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if got := testutil.ToFloat64(environmentsGauge.WithLabelValues(onboardingv1alpha1.EnvironmentReady, onboardingv1alpha1.TierDev)); got != 1 {
+		t.Errorf("ready environments after second reconcile: (%v)", got)
+	}
+
+	// The deleted Environment is removed from the gauges
+	forgetEnvironment(name)
+	if got := testutil.ToFloat64(environmentsGauge.WithLabelValues(onboardingv1alpha1.EnvironmentReady, onboardingv1alpha1.TierDev)); got != 0 {
+		t.Errorf("ready environments after deletion: (%v)", got)
+	}
+	if got := testutil.CollectAndCount(environmentUsersGauge); got != 0 {
+		t.Errorf("user series after deletion: (%v)", got)
+	}
+}
+
+func TestMarkReady(t *testing.T) {
+	now := time.Now()
+	readyAt := metav1.NewTime(now.Add(-time.Hour))
+	tests := []struct {
+		name     string
+		status   onboardingv1alpha1.EnvironmentStatus
+		observed bool
+	}{
+		{name: "new Environment", observed: true},
+		{name: "new Environment approved after waiting", status: onboardingv1alpha1.EnvironmentStatus{EnvironmentStatus: onboardingv1alpha1.EnvironmentPending}, observed: true},
+		{name: "already recorded", status: onboardingv1alpha1.EnvironmentStatus{EnvironmentStatus: onboardingv1alpha1.EnvironmentReady, ReadyAt: &readyAt}},
+		{name: "Ready before the upgrade", status: onboardingv1alpha1.EnvironmentStatus{EnvironmentStatus: onboardingv1alpha1.EnvironmentReady}},
+		{name: "approved before the upgrade", status: onboardingv1alpha1.EnvironmentStatus{EnvironmentStatus: onboardingv1alpha1.EnvironmentPending, ApprovedSpec: &environment.Spec}},
+	}
+	for _, tt := range tests {
+		env := environment.DeepCopy()
+		env.Status = tt.status
+		if observed := markReady(env, now); observed != tt.observed {
+			t.Errorf("%s: observed (%v) expected (%v)", tt.name, observed, tt.observed)
+		}
+		if env.Status.ReadyAt == nil || (tt.status.ReadyAt != nil && !env.Status.ReadyAt.Equal(tt.status.ReadyAt)) {
+			t.Errorf("%s: ReadyAt (%v)", tt.name, env.Status.ReadyAt)
+		}
+	}
+}
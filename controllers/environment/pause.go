@@ -0,0 +1,116 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// pauseState tells whether the reconciliation of the Environment is paused at now, and until when (zero when
+// the pause has no expiry). An expiry that can't be parsed doesn't end the pause and is returned as an error.
+func pauseState(cr *onboardingv1alpha1.Environment, now time.Time) (bool, time.Time, error) {
+	if cr.Annotations[onboardingv1alpha1.PausedAnnotation] != "true" {
+		return false, time.Time{}, nil
+	}
+	value, ok := cr.Annotations[onboardingv1alpha1.PausedUntilAnnotation]
+	if !ok {
+		return true, time.Time{}, nil
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return true, time.Time{}, fmt.Errorf("invalid annotation %s: %v", onboardingv1alpha1.PausedUntilAnnotation, err)
+	}
+	return now.Before(until), until, nil
+}
+
+// reconcilePaused reports the drift of the child objects of a paused Environment without changing them, and
+// requeues the Environment when the pause expires
+func (r *ReconcileEnvironment) reconcilePaused(ctx context.Context, instance *onboardingv1alpha1.Environment, previous *onboardingv1alpha1.EnvironmentStatus, now, until time.Time, invalid error) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Environment Name", instance.Name)
+
+	condition := status.Condition{
+		Type:    onboardingv1alpha1.PausedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  onboardingv1alpha1.PausedByAnnotation,
+		Message: "reconciliation paused",
+	}
+	if !until.IsZero() {
+		condition.Message += " until " + until.UTC().Format(time.RFC3339)
+	}
+	if invalid != nil {
+		condition.Message += ", " + invalid.Error()
+	}
+	if !instance.Status.Conditions.IsTrueFor(onboardingv1alpha1.PausedCondition) {
+		reqLogger.Info("Environment reconciliation paused", "Until", until)
+		if r.recorder != nil {
+			r.recorder.Event(instance, corev1.EventTypeNormal, string(onboardingv1alpha1.PausedCondition), condition.Message)
+		}
+	}
+	instance.Status.Conditions.SetCondition(condition)
+
+	// Nothing was applied to the cluster before the first approval
+	instance.Status.Drift = nil
+	if env := approvedEnvironment(instance); env != nil {
+		// The quota pressure only reads the cluster, it is still evaluated to monitor the paused Environment
+		for _, step := range []reconcileStep{
+			{name: "drift", reconcile: r.reconcileDrift},
+			{name: "pressure", reconcile: r.reconcileQuotaPressure},
+		} {
+			if err := r.runStep(ctx, step, instance, env); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+	}
+
+	if err := r.updateStatus(ctx, instance, previous); err != nil {
+		return reconcile.Result{}, err
+	}
+	reportEnvironment(instance)
+	if until.IsZero() {
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{RequeueAfter: until.Sub(now)}, nil
+}
+
+// resume sets the Paused condition of an Environment whose pause ended, and clears its drift
+func (r *ReconcileEnvironment) resume(instance *onboardingv1alpha1.Environment) {
+	instance.Status.Drift = nil
+	if !instance.Status.Conditions.IsTrueFor(onboardingv1alpha1.PausedCondition) {
+		return
+	}
+	condition := status.Condition{
+		Type:    onboardingv1alpha1.PausedCondition,
+		Status:  corev1.ConditionFalse,
+		Reason:  onboardingv1alpha1.PauseRemoved,
+		Message: "reconciliation resumed",
+	}
+	if instance.Annotations[onboardingv1alpha1.PausedAnnotation] == "true" {
+		condition.Reason = onboardingv1alpha1.PauseExpired
+	}
+	instance.Status.Conditions.SetCondition(condition)
+	log.Info("Environment reconciliation resumed", "Environment Name", instance.Name, "Reason", condition.Reason)
+	if r.recorder != nil {
+		r.recorder.Event(instance, corev1.EventTypeNormal, string(onboardingv1alpha1.PausedCondition),
+			fmt.Sprintf("%s: %s", condition.Reason, condition.Message))
+	}
+}
+
+// reconcileDrift lists in the Environment status the changes the reconcile steps would make to the child objects,
+// without making them. The ResourceQuota usage is refreshed as well.
+func (r *ReconcileEnvironment) reconcileDrift(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error {
+	plan, err := r.plan(ctx, instance, env)
+	if err != nil {
+		return err
+	}
+	var drift []string
+	for _, operation := range plan {
+		drift = append(drift, formatOperation(operation))
+	}
+	instance.Status.Drift = drift
+	return nil
+}
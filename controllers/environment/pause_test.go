@@ -0,0 +1,132 @@
+package environment
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPauseState(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		annotations map[string]string
+		paused      bool
+		invalid     bool
+	}{
+		{nil, false, false},
+		{map[string]string{onboardingv1alpha1.PausedAnnotation: "false"}, false, false},
+		{map[string]string{onboardingv1alpha1.PausedAnnotation: "true"}, true, false},
+		{map[string]string{onboardingv1alpha1.PausedAnnotation: "true", onboardingv1alpha1.PausedUntilAnnotation: "2020-06-01T13:00:00Z"}, true, false},
+		{map[string]string{onboardingv1alpha1.PausedAnnotation: "true", onboardingv1alpha1.PausedUntilAnnotation: "2020-06-01T11:00:00Z"}, false, false},
+		// An invalid expiry keeps the Environment paused
+		{map[string]string{onboardingv1alpha1.PausedAnnotation: "true", onboardingv1alpha1.PausedUntilAnnotation: "tomorrow"}, true, true},
+	}
+	for _, test := range tests {
+		env := environment.DeepCopy()
+		env.Annotations = test.annotations
+		paused, _, err := pauseState(env, now)
+		if paused != test.paused || (err != nil) != test.invalid {
+			t.Errorf("pauseState(%v): (%v, %v)", test.annotations, paused, err)
+		}
+	}
+}
+
+func TestPausedEnvironment(t *testing.T) {
+	env := environment.DeepCopy()
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileEnvironment{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+	rqKey := types.NamespacedName{Name: "cno-resource-quota", Namespace: projectname}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+
+	// Pause the Environment and raise its quota by hand
+	if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	env.Annotations = map[string]string{
+		onboardingv1alpha1.PausedAnnotation:      "true",
+		onboardingv1alpha1.PausedUntilAnnotation: until,
+	}
+	if err := cl.Update(context.TODO(), env); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+	rq := &corev1.ResourceQuota{}
+	if err := cl.Get(context.TODO(), rqKey, rq); err != nil {
+		t.Fatalf("get resourcequota: (%v)", err)
+	}
+	rq.Spec.Hard["requests.cpu"] = resource.MustParse("4")
+	if err := cl.Update(context.TODO(), rq); err != nil {
+		t.Fatalf("update resourcequota: (%v)", err)
+	}
+
+	res, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if res.RequeueAfter <= 0 || res.RequeueAfter > time.Hour {
+		t.Errorf("requeue after: (%v)", res.RequeueAfter)
+	}
+	if err := cl.Get(context.TODO(), rqKey, rq); err != nil {
+		t.Fatalf("get resourcequota: (%v)", err)
+	}
+	if cpu := rq.Spec.Hard["requests.cpu"]; cpu.String() != "4" {
+		t.Errorf("paused resourcequota was changed: (%v)", cpu.String())
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	condition := env.Status.Conditions.GetCondition(onboardingv1alpha1.PausedCondition)
+	if condition == nil || !condition.IsTrue() || !strings.Contains(condition.Message, until) {
+		t.Errorf("paused condition: (%v)", condition)
+	}
+	if len(env.Status.Drift) != 1 || env.Status.Drift[0] != "Update ResourceQuota project1/cno-resource-quota: requests.cpu 4 -> 1" {
+		t.Errorf("drift: (%v)", env.Status.Drift)
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Normal Paused reconciliation paused") {
+		t.Errorf("event: (%v)", event)
+	}
+
+	// Once the pause expires the drift is reverted
+	env.Annotations[onboardingv1alpha1.PausedUntilAnnotation] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	if err := cl.Update(context.TODO(), env); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), rqKey, rq); err != nil {
+		t.Fatalf("get resourcequota: (%v)", err)
+	}
+	if cpu := rq.Spec.Hard["requests.cpu"]; cpu.Cmp(resource.MustParse(requestCPU)) != 0 {
+		t.Errorf("resumed resourcequota: (%v)", cpu.String())
+	}
+	env = &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	condition = env.Status.Conditions.GetCondition(onboardingv1alpha1.PausedCondition)
+	if condition == nil || !condition.IsFalse() || condition.Reason != onboardingv1alpha1.PauseExpired {
+		t.Errorf("resumed condition: (%v)", condition)
+	}
+	if env.Status.Drift != nil {
+		t.Errorf("drift after resume: (%v)", env.Status.Drift)
+	}
+}
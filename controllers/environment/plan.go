@@ -0,0 +1,220 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DryRun makes the operator plan the changes to every Environment instead of applying them.
+// It is set from the manager flags before the controller is added.
+var DryRun bool
+
+// dryRunReason returns the reason the Environment is in dry-run mode, or an empty reason
+func dryRunReason(cr *onboardingv1alpha1.Environment) status.ConditionReason {
+	if DryRun {
+		return onboardingv1alpha1.DryRunByFlag
+	}
+	if cr.Annotations[onboardingv1alpha1.DryRunAnnotation] == "true" {
+		return onboardingv1alpha1.DryRunByAnnotation
+	}
+	return ""
+}
+
+// reconcileDryRun reports the plan of an Environment in dry-run mode in its status, and as events when it changes
+func (r *ReconcileEnvironment) reconcileDryRun(ctx context.Context, instance *onboardingv1alpha1.Environment, previous *onboardingv1alpha1.EnvironmentStatus, reason status.ConditionReason) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Environment Name", instance.Name)
+
+	instance.Status.Conditions.SetCondition(status.Condition{
+		Type:    onboardingv1alpha1.DryRunCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: "changes are planned, not applied",
+	})
+	previousPlan := instance.Status.Plan
+	instance.Status.Plan = nil
+	if env := approvedEnvironment(instance); env != nil {
+		for _, step := range []reconcileStep{
+			{name: "plan", reconcile: r.reconcilePlan},
+			{name: "pressure", reconcile: r.reconcileQuotaPressure},
+		} {
+			if err := r.runStep(ctx, step, instance, env); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(previousPlan, instance.Status.Plan) {
+		for _, operation := range instance.Status.Plan {
+			reqLogger.Info("Planned operation", "Operation", formatOperation(operation))
+			if r.recorder != nil {
+				r.recorder.Event(instance, corev1.EventTypeNormal, string(onboardingv1alpha1.DryRunCondition), formatOperation(operation))
+			}
+		}
+	}
+	if err := r.updateStatus(ctx, instance, previous); err != nil {
+		return reconcile.Result{}, err
+	}
+	reportEnvironment(instance)
+	return reconcile.Result{}, nil
+}
+
+// leaveDryRun sets the DryRun condition of an Environment whose changes are applied again, and clears its plan
+func leaveDryRun(instance *onboardingv1alpha1.Environment) {
+	instance.Status.Plan = nil
+	if !instance.Status.Conditions.IsTrueFor(onboardingv1alpha1.DryRunCondition) {
+		return
+	}
+	instance.Status.Conditions.SetCondition(status.Condition{
+		Type:    onboardingv1alpha1.DryRunCondition,
+		Status:  corev1.ConditionFalse,
+		Reason:  onboardingv1alpha1.DryRunDisabled,
+		Message: "changes are applied",
+	})
+}
+
+// reconcilePlan sets the plan of the Environment status to the operations the reconcile steps would apply to its
+// child objects. The ResourceQuota usage is refreshed as well.
+func (r *ReconcileEnvironment) reconcilePlan(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error {
+	plan, err := r.plan(ctx, instance, env)
+	instance.Status.Plan = plan
+	return err
+}
+
+// plan returns the operations the reconcile steps would apply to the child objects of the Environment, without
+// applying them. The operator doesn't delete child objects, they are garbage collected with the Environment, apart
+// from the bootstrapped objects no longer rendered with the Continuous policy.
+func (r *ReconcileEnvironment) plan(ctx context.Context, instance, env *onboardingv1alpha1.Environment) ([]onboardingv1alpha1.PlannedOperation, error) {
+	var plan []onboardingv1alpha1.PlannedOperation
+	// add plans the creation of the object when it isn't found, or its update when it has changes
+	add := func(kind, name, namespace string, found bool, changes []string) {
+		operation := onboardingv1alpha1.PlannedOperation{Kind: kind, Name: name, Namespace: namespace}
+		switch {
+		case !found:
+			operation.Operation = onboardingv1alpha1.OperationCreate
+		case len(changes) > 0:
+			operation.Operation = onboardingv1alpha1.OperationUpdate
+			operation.Changes = changes
+		default:
+			return
+		}
+		plan = append(plan, operation)
+	}
+
+	namespace := newNamespaceForCR(env)
+	foundNs := &corev1.Namespace{}
+	found, err := r.find(ctx, types.NamespacedName{Name: namespace.Name}, foundNs)
+	if err != nil {
+		return nil, err
+	}
+	var changes []string
+	if label := onboardingv1alpha1.EnvironmentLabel; found && foundNs.Labels[label] != instance.Name {
+		changes = append(changes, fmt.Sprintf("labels.%s %s -> %s", label, foundNs.Labels[label], instance.Name))
+	}
+	add("Namespace", namespace.Name, "", found, changes)
+
+	rq, err := newResourceQuotaForCR(env)
+	if err != nil {
+		return nil, err
+	}
+	foundRq := &corev1.ResourceQuota{}
+	if found, err = r.find(ctx, types.NamespacedName{Name: rq.Name, Namespace: rq.Namespace}, foundRq); err != nil {
+		return nil, err
+	}
+	changes = nil
+	if found {
+		changes = recordChanges("", quotaChanges(instance, rq.Name, foundRq.Spec.Hard, rq.Spec.Hard))
+		instance.Status.Usage, instance.Status.MaxUsagePercent = quotaUsage(foundRq)
+	}
+	add("ResourceQuota", rq.Name, rq.Namespace, found, changes)
+
+	limitRange := getLimiteRange(env)
+	foundLimitRange := &corev1.LimitRange{}
+	if found, err = r.find(ctx, types.NamespacedName{Name: limitRange.Name, Namespace: limitRange.Namespace}, foundLimitRange); err != nil {
+		return nil, err
+	}
+	changes = nil
+	if found && !equality.Semantic.DeepEqual(foundLimitRange.Spec, limitRange.Spec) {
+		changes = limitChanges(instance, foundLimitRange.Spec.Limits, limitRange.Spec.Limits[0])
+		if len(changes) == 0 {
+			// Only the other limits differ, they are replaced
+			changes = []string{"limits replaced"}
+		}
+	}
+	add("LimitRange", limitRange.Name, limitRange.Namespace, found, changes)
+
+	for _, rolebinding := range newRoleBindingForCR(env) {
+		foundRb := &v1.RoleBinding{}
+		if found, err = r.find(ctx, types.NamespacedName{Name: rolebinding.Name, Namespace: rolebinding.Namespace}, foundRb); err != nil {
+			return nil, err
+		}
+		changes = nil
+		if found {
+			if foundRb.RoleRef != rolebinding.RoleRef {
+				changes = append(changes, fmt.Sprintf("roleRef %s -> %s", foundRb.RoleRef.Name, rolebinding.RoleRef.Name))
+			}
+			changes = append(changes, recordChanges("", subjectsChanges(instance, rolebinding.Name, foundRb.Subjects, rolebinding.Subjects))...)
+		}
+		add("RoleBinding", rolebinding.Name, rolebinding.Namespace, found, changes)
+	}
+
+	bootstrap, err := r.planBootstrap(ctx, instance, env)
+	if err != nil {
+		return nil, err
+	}
+	return append(plan, bootstrap...), nil
+}
+
+// limitChanges returns the changes of the container defaults of the LimitRange from its items to the desired item
+func limitChanges(cr *onboardingv1alpha1.Environment, items []corev1.LimitRangeItem, desired corev1.LimitRangeItem) []string {
+	var found corev1.LimitRangeItem
+	for _, item := range items {
+		if item.Type == desired.Type {
+			found = item
+		}
+	}
+	changes := recordChanges("default.", quotaChanges(cr, "", found.Default, desired.Default))
+	return append(changes, recordChanges("defaultRequest.", quotaChanges(cr, "", found.DefaultRequest, desired.DefaultRequest))...)
+}
+
+// recordChanges formats the changes of the audit records as "field old -> new", the fields being prefixed
+func recordChanges(prefix string, records []onboardingv1alpha1.AuditRecord) []string {
+	var changes []string
+	for _, record := range records {
+		changes = append(changes, fmt.Sprintf("%s%s %s -> %s", prefix, record.Field, record.OldValue, record.NewValue))
+	}
+	return changes
+}
+
+// formatOperation describes a planned operation, e.g. "Update ResourceQuota ns/name: requests.cpu 2 -> 1"
+func formatOperation(operation onboardingv1alpha1.PlannedOperation) string {
+	name := operation.Name
+	if operation.Namespace != "" {
+		name = operation.Namespace + "/" + name
+	}
+	description := fmt.Sprintf("%s %s %s", operation.Operation, operation.Kind, name)
+	if len(operation.Changes) > 0 {
+		description += ": " + strings.Join(operation.Changes, ", ")
+	}
+	return description
+}
+
+// find gets the object of the key, and tells whether it exists
+func (r *ReconcileEnvironment) find(ctx context.Context, key types.NamespacedName, obj runtime.Object) (bool, error) {
+	err := r.client.Get(ctx, key, obj)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,141 @@
+package environment
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestDryRunEnvironment(t *testing.T) {
+	env := environment.DeepCopy()
+	env.Annotations = map[string]string{onboardingv1alpha1.DryRunAnnotation: "true"}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileEnvironment{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	// Nothing is created, every child object is planned
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: projectname}, &corev1.Namespace{}); err == nil {
+		t.Errorf("namespace created in dry-run mode")
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	var planned []string
+	for _, operation := range env.Status.Plan {
+		planned = append(planned, formatOperation(operation))
+	}
+	expected := []string{
+		"Create Namespace project1",
+		"Create ResourceQuota project1/cno-resource-quota",
+		"Create LimitRange project1/cno-limit-range",
+		"Create RoleBinding project1/cno-admin-role-binding",
+		"Create RoleBinding project1/cno-viewer-role-binding",
+	}
+	if !reflect.DeepEqual(planned, expected) {
+		t.Errorf("plan: (%v)", planned)
+	}
+	if !env.Status.Conditions.IsTrueFor(onboardingv1alpha1.DryRunCondition) {
+		t.Errorf("dry-run condition: (%v)", env.Status.Conditions)
+	}
+	if len(recorder.Events) != len(expected) {
+		t.Errorf("events: (%d)", len(recorder.Events))
+	}
+
+	// An unchanged plan isn't reported again
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if len(recorder.Events) != len(expected) {
+		t.Errorf("events after second reconcile: (%d)", len(recorder.Events))
+	}
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+
+	// Apply the changes, then change the live objects and plan again
+	if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	delete(env.Annotations, onboardingv1alpha1.DryRunAnnotation)
+	if err := cl.Update(context.TODO(), env); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	env = &onboardingv1alpha1.Environment{}
+	if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if env.Status.Plan != nil || !env.Status.Conditions.IsFalseFor(onboardingv1alpha1.DryRunCondition) {
+		t.Errorf("status after leaving dry-run: (%v, %v)", env.Status.Plan, env.Status.Conditions)
+	}
+
+	rq := &corev1.ResourceQuota{}
+	rqKey := types.NamespacedName{Name: "cno-resource-quota", Namespace: projectname}
+	if err := cl.Get(context.TODO(), rqKey, rq); err != nil {
+		t.Fatalf("get resourcequota: (%v)", err)
+	}
+	rq.Spec.Hard["limits.memory"] = resource.MustParse("1Gi")
+	if err := cl.Update(context.TODO(), rq); err != nil {
+		t.Fatalf("update resourcequota: (%v)", err)
+	}
+	rb := &v1.RoleBinding{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "cno-viewer-role-binding", Namespace: projectname}, rb); err != nil {
+		t.Fatalf("get rolebinding: (%v)", err)
+	}
+	rb.Subjects = append(rb.Subjects, v1.Subject{Kind: "User", Name: "intruder"})
+	if err := cl.Update(context.TODO(), rb); err != nil {
+		t.Fatalf("update rolebinding: (%v)", err)
+	}
+
+	DryRun = true
+	defer func() { DryRun = false }()
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), rqKey, rq); err != nil {
+		t.Fatalf("get resourcequota: (%v)", err)
+	}
+	if memory := rq.Spec.Hard["limits.memory"]; memory.String() != "1Gi" {
+		t.Errorf("resourcequota changed in dry-run mode: (%v)", memory.String())
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	planned = nil
+	for _, operation := range env.Status.Plan {
+		planned = append(planned, formatOperation(operation))
+	}
+	expected = []string{
+		"Update ResourceQuota project1/cno-resource-quota: limits.memory 1Gi -> 500Mi",
+		"Update RoleBinding project1/cno-viewer-role-binding: subjects User:intruder,User:user2 -> User:user2",
+	}
+	if !reflect.DeepEqual(planned, expected) {
+		t.Errorf("plan: (%v)", planned)
+	}
+	if condition := env.Status.Conditions.GetCondition(onboardingv1alpha1.DryRunCondition); condition.Reason != onboardingv1alpha1.DryRunByFlag {
+		t.Errorf("dry-run condition: (%v)", condition)
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Normal DryRun Update ResourceQuota") {
+		t.Errorf("event: (%v)", event)
+	}
+}
@@ -0,0 +1,216 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Default quota usage thresholds, used when neither the Environment nor the EnvironmentPolicies of its tier set them
+const (
+	defaultWarningThreshold  = 80
+	defaultCriticalThreshold = 95
+)
+
+// quotaHysteresis is the number of percentage points the usage must drop below a threshold to leave its level,
+// so that a usage oscillating around a threshold doesn't flap the QuotaPressure condition
+const quotaHysteresis = 5
+
+// QuotaAlertHook is the URL the quota pressure changes and the expiry warnings are posted to as JSON. No
+// notification is sent when empty.
+// It is set from the manager flags before the controller is added.
+var QuotaAlertHook string
+
+// notificationClient posts the notifications to QuotaAlertHook
+var notificationClient = &http.Client{Timeout: 10 * time.Second}
+
+// pressureNotification is the body posted to QuotaAlertHook
+type pressureNotification struct {
+	Environment     string                          `json:"environment"`
+	Namespace       string                          `json:"namespace"`
+	Reason          string                          `json:"reason"`
+	Message         string                          `json:"message"`
+	MaxUsagePercent int32                           `json:"maxUsagePercent"`
+	Usage           []onboardingv1alpha1.QuotaUsage `json:"usage,omitempty"`
+}
+
+// pressure levels, ordered by severity
+const (
+	pressureNone = iota
+	pressureWarning
+	pressureCritical
+)
+
+var pressureReasons = []status.ConditionReason{
+	pressureNone:     onboardingv1alpha1.QuotaPressureNone,
+	pressureWarning:  onboardingv1alpha1.QuotaPressureWarning,
+	pressureCritical: onboardingv1alpha1.QuotaPressureCritical,
+}
+
+// reconcileQuotaPressure evaluates the quota usage against the thresholds of the Environment and sets the
+// QuotaPressure condition. Its level changes are reported by reportQuotaPressure once the status is updated.
+func (r *ReconcileEnvironment) reconcileQuotaPressure(ctx context.Context, instance, env *onboardingv1alpha1.Environment) error {
+	thresholds, err := r.quotaThresholds(ctx, instance)
+	if err != nil {
+		return err
+	}
+	level := pressureLevel(instance.Status.MaxUsagePercent, pressureOf(instance.Status.Conditions), thresholds)
+
+	condition := status.Condition{
+		Type:    onboardingv1alpha1.QuotaPressureCondition,
+		Status:  corev1.ConditionFalse,
+		Reason:  pressureReasons[level],
+		Message: pressureMessage(instance.Status.Usage, thresholds),
+	}
+	if level != pressureNone {
+		condition.Status = corev1.ConditionTrue
+	}
+	instance.Status.Conditions.SetCondition(condition)
+	return nil
+}
+
+// reportQuotaPressure reports the level change of the persisted QuotaPressure condition of the Environment from
+// its previous status as an event and a notification
+func (r *ReconcileEnvironment) reportQuotaPressure(instance *onboardingv1alpha1.Environment, previous *onboardingv1alpha1.EnvironmentStatus) {
+	reqLogger := log.WithValues("Environment Name", instance.Name)
+
+	condition := instance.Status.Conditions.GetCondition(onboardingv1alpha1.QuotaPressureCondition)
+	level := pressureOf(instance.Status.Conditions)
+	if condition == nil || level == pressureOf(previous.Conditions) {
+		return
+	}
+
+	reqLogger.Info("Quota pressure changed", "Reason", condition.Reason, "Max usage percent", instance.Status.MaxUsagePercent)
+	if r.recorder != nil {
+		eventType := corev1.EventTypeWarning
+		if level == pressureNone {
+			eventType = corev1.EventTypeNormal
+		}
+		r.recorder.Event(instance, eventType, string(onboardingv1alpha1.QuotaPressureCondition),
+			fmt.Sprintf("%s: %s", condition.Reason, condition.Message))
+	}
+	if QuotaAlertHook != "" {
+		if err := notifyPressure(instance, *condition); err != nil {
+			// A failed notification doesn't fail the reconcile, the condition and the event still report the change
+			reqLogger.Error(err, "Failed to notify the quota pressure", "Hook", QuotaAlertHook)
+		}
+	}
+}
+
+// pressureOf returns the level of the QuotaPressure condition in conditions
+func pressureOf(conditions status.Conditions) int {
+	if condition := conditions.GetCondition(onboardingv1alpha1.QuotaPressureCondition); condition != nil && condition.IsTrue() {
+		for level, reason := range pressureReasons {
+			if condition.Reason == reason {
+				return level
+			}
+		}
+	}
+	return pressureNone
+}
+
+// quotaThresholds returns the thresholds of the Environment: its own, or the lowest of the EnvironmentPolicy
+// rules of its tier, or the defaults
+func (r *ReconcileEnvironment) quotaThresholds(ctx context.Context, instance *onboardingv1alpha1.Environment) (onboardingv1alpha1.QuotaThresholds, error) {
+	var fromPolicies onboardingv1alpha1.QuotaThresholds
+	policies := &onboardingv1alpha1.EnvironmentPolicyList{}
+	if err := r.client.List(ctx, policies); err != nil {
+		return fromPolicies, err
+	}
+	lowest := func(current, value int32) int32 {
+		if value > 0 && (current == 0 || value < current) {
+			return value
+		}
+		return current
+	}
+	for _, policy := range policies.Items {
+		for _, rule := range policy.Spec.Rules {
+			if (rule.Tier == "" || rule.Tier == instance.Tier()) && rule.QuotaThresholds != nil {
+				fromPolicies.Warning = lowest(fromPolicies.Warning, rule.QuotaThresholds.Warning)
+				fromPolicies.Critical = lowest(fromPolicies.Critical, rule.QuotaThresholds.Critical)
+			}
+		}
+	}
+
+	thresholds := onboardingv1alpha1.QuotaThresholds{Warning: defaultWarningThreshold, Critical: defaultCriticalThreshold}
+	for _, override := range []*onboardingv1alpha1.QuotaThresholds{&fromPolicies, instance.Spec.QuotaThresholds} {
+		if override == nil {
+			continue
+		}
+		if override.Warning > 0 {
+			thresholds.Warning = override.Warning
+		}
+		if override.Critical > 0 {
+			thresholds.Critical = override.Critical
+		}
+	}
+	return thresholds, nil
+}
+
+// pressureLevel returns the level of the usage percent. A level is entered when its threshold is reached and
+// only left once the usage drops quotaHysteresis points below it.
+func pressureLevel(percent int32, previous int, thresholds onboardingv1alpha1.QuotaThresholds) int {
+	switch {
+	case percent >= thresholds.Critical:
+		return pressureCritical
+	case previous == pressureCritical && percent > thresholds.Critical-quotaHysteresis:
+		return pressureCritical
+	case percent >= thresholds.Warning:
+		return pressureWarning
+	case previous >= pressureWarning && percent > thresholds.Warning-quotaHysteresis:
+		return pressureWarning
+	}
+	return pressureNone
+}
+
+// pressureMessage lists the quota keys whose usage is above the warning threshold
+func pressureMessage(usage []onboardingv1alpha1.QuotaUsage, thresholds onboardingv1alpha1.QuotaThresholds) string {
+	var keys []string
+	for _, u := range usage {
+		if u.Percent >= thresholds.Warning-quotaHysteresis {
+			keys = append(keys, fmt.Sprintf("%s at %d%% (%s/%s)", u.Resource, u.Percent, u.Used, u.Hard))
+		}
+	}
+	message := fmt.Sprintf("thresholds %d%% warning, %d%% critical", thresholds.Warning, thresholds.Critical)
+	if len(keys) > 0 {
+		message = strings.Join(keys, ", ") + "; " + message
+	}
+	return message
+}
+
+// notifyPressure posts the QuotaPressure condition of the Environment to QuotaAlertHook
+func notifyPressure(instance *onboardingv1alpha1.Environment, condition status.Condition) error {
+	return notify(pressureNotification{
+		Environment:     instance.Name,
+		Namespace:       instance.Spec.Name,
+		Reason:          string(condition.Reason),
+		Message:         condition.Message,
+		MaxUsagePercent: instance.Status.MaxUsagePercent,
+		Usage:           instance.Status.Usage,
+	})
+}
+
+// notify posts the notification to QuotaAlertHook as JSON
+func notify(notification interface{}) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	resp, err := notificationClient.Post(QuotaAlertHook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert hook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package environment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPressureLevel(t *testing.T) {
+	thresholds := onboardingv1alpha1.QuotaThresholds{Warning: 80, Critical: 95}
+	tests := []struct {
+		percent  int32
+		previous int
+		expected int
+	}{
+		{50, pressureNone, pressureNone},
+		{80, pressureNone, pressureWarning},
+		{95, pressureWarning, pressureCritical},
+		// Hysteresis keeps the level until the usage drops 5 points below its threshold
+		{92, pressureCritical, pressureCritical},
+		{90, pressureCritical, pressureWarning},
+		{78, pressureWarning, pressureWarning},
+		{78, pressureNone, pressureNone},
+		{75, pressureWarning, pressureNone},
+	}
+	for _, test := range tests {
+		if level := pressureLevel(test.percent, test.previous, thresholds); level != test.expected {
+			t.Errorf("pressureLevel(%d, %d): (%d) expected (%d)", test.percent, test.previous, level, test.expected)
+		}
+	}
+}
+
+func TestQuotaPressure(t *testing.T) {
+	var notifications []pressureNotification
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		notification := pressureNotification{}
+		if err := json.NewDecoder(req.Body).Decode(&notification); err != nil {
+			t.Errorf("decode notification: (%v)", err)
+		}
+		notifications = append(notifications, notification)
+	}))
+	defer hook.Close()
+	QuotaAlertHook = hook.URL
+	defer func() { QuotaAlertHook = "" }()
+
+	env := environment.DeepCopy()
+	// The dev tier policy lowers the warning threshold
+	policy := &onboardingv1alpha1.EnvironmentPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev"},
+		Spec: onboardingv1alpha1.EnvironmentPolicySpec{Rules: []onboardingv1alpha1.EnvironmentPolicyRule{
+			{Tier: onboardingv1alpha1.TierDev, QuotaThresholds: &onboardingv1alpha1.QuotaThresholds{Warning: 70}},
+		}},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, policy, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env, policy)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileEnvironment{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	setUsage := func(used string) {
+		rq := &corev1.ResourceQuota{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: "cno-resource-quota", Namespace: projectname}, rq); err != nil {
+			t.Fatalf("get resourcequota: (%v)", err)
+		}
+		rq.Status.Hard = corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("100Mi")}
+		rq.Status.Used = corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse(used)}
+		if err := cl.Status().Update(context.TODO(), rq); err != nil {
+			t.Fatalf("update resourcequota status: (%v)", err)
+		}
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+		if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+			t.Fatalf("get environment: (%v)", err)
+		}
+	}
+
+	setUsage("72Mi")
+	condition := env.Status.Conditions.GetCondition(onboardingv1alpha1.QuotaPressureCondition)
+	if condition == nil || !condition.IsTrue() || condition.Reason != onboardingv1alpha1.QuotaPressureWarning {
+		t.Fatalf("condition at 72%%: (%v)", condition)
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Warning QuotaPressure WarningThreshold") {
+		t.Errorf("event: (%v)", event)
+	}
+
+	// Within the hysteresis band the level is kept and nothing is reported
+	setUsage("67Mi")
+	if !env.Status.Conditions.IsTrueFor(onboardingv1alpha1.QuotaPressureCondition) {
+		t.Errorf("condition at 67%%: (%v)", env.Status.Conditions)
+	}
+
+	setUsage("96Mi")
+	if condition := env.Status.Conditions.GetCondition(onboardingv1alpha1.QuotaPressureCondition); condition.Reason != onboardingv1alpha1.QuotaPressureCritical {
+		t.Errorf("condition at 96%%: (%v)", condition)
+	}
+
+	setUsage("10Mi")
+	if !env.Status.Conditions.IsFalseFor(onboardingv1alpha1.QuotaPressureCondition) {
+		t.Errorf("condition at 10%%: (%v)", env.Status.Conditions)
+	}
+	if len(recorder.Events) != 2 {
+		t.Errorf("events: (%d)", len(recorder.Events))
+	}
+	if len(notifications) != 3 {
+		t.Fatalf("notifications: (%v)", notifications)
+	}
+	if notifications[1].Reason != "CriticalThreshold" || notifications[1].MaxUsagePercent != 96 || notifications[1].Namespace != projectname {
+		t.Errorf("critical notification: (%v)", notifications[1])
+	}
+}
+
+// failingStatusClient fails the status updates of the wrapped client
+type failingStatusClient struct {
+	client.Client
+}
+
+func (c failingStatusClient) Status() client.StatusWriter {
+	return failingStatusWriter{c.Client.Status()}
+}
+
+type failingStatusWriter struct {
+	client.StatusWriter
+}
+
+func (failingStatusWriter) Update(context.Context, runtime.Object, ...client.UpdateOption) error {
+	return fmt.Errorf("status update failed")
+}
+
+func TestQuotaPressureReportedOnceUpdated(t *testing.T) {
+	var notifications []pressureNotification
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		notification := pressureNotification{}
+		if err := json.NewDecoder(req.Body).Decode(&notification); err != nil {
+			t.Errorf("decode notification: (%v)", err)
+		}
+		notifications = append(notifications, notification)
+	}))
+	defer hook.Close()
+	QuotaAlertHook = hook.URL
+	defer func() { QuotaAlertHook = "" }()
+
+	env := environment.DeepCopy()
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileEnvironment{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	setUsage := func() {
+		rq := &corev1.ResourceQuota{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: "cno-resource-quota", Namespace: projectname}, rq); err != nil {
+			t.Fatalf("get resourcequota: (%v)", err)
+		}
+		rq.Status.Hard = corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("100Mi")}
+		rq.Status.Used = corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("90Mi")}
+		if err := cl.Status().Update(context.TODO(), rq); err != nil {
+			t.Fatalf("update resourcequota status: (%v)", err)
+		}
+	}
+
+	// The pressure change isn't reported while the condition isn't persisted
+	setUsage()
+	r.client = failingStatusClient{cl}
+	if _, err := r.Reconcile(req); err == nil {
+		t.Fatalf("reconcile should fail with the status update")
+	}
+	if len(recorder.Events) != 0 || len(notifications) != 0 {
+		t.Fatalf("nothing should be reported before the status update, got %d events and notifications (%v)", len(recorder.Events), notifications)
+	}
+
+	setUsage()
+	r.client = cl
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if len(recorder.Events) != 1 || len(notifications) != 1 || notifications[0].Reason != "WarningThreshold" {
+		t.Errorf("the warning should be reported once, got %d events and notifications (%v)", len(recorder.Events), notifications)
+	}
+}
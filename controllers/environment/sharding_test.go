@@ -0,0 +1,53 @@
+package environment
+
+import (
+	"context"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/sharding"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestShardedEnvironment(t *testing.T) {
+	defer func() { sharding.Current = sharding.Shard{} }()
+	env := environment.DeepCopy()
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	r := &ReconcileEnvironment{client: cl, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	// The Environment of another shard is left alone
+	shard, err := sharding.New("uid!=test-uid", 0, 0)
+	if err != nil {
+		t.Fatalf("new shard: (%v)", err)
+	}
+	sharding.Current = shard
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: projectname}, &corev1.Namespace{}); err == nil {
+		t.Errorf("namespace created by another shard")
+	}
+
+	shard, err = sharding.New("uid=test-uid", 0, 0)
+	if err != nil {
+		t.Fatalf("new shard: (%v)", err)
+	}
+	sharding.Current = shard
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if env.Status.Shard != "uid=test-uid" {
+		t.Errorf("status shard: (%v)", env.Status.Shard)
+	}
+}
@@ -0,0 +1,57 @@
+package environment
+
+import (
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/tracing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	env := environment.DeepCopy()
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	r := &ReconcileEnvironment{client: tracing.WrapClient(fake.NewFakeClient(env), s), scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+
+	spans := map[string]*sdktrace.SpanSnapshot{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	root, step, create := spans["Reconcile Environment"], spans["Reconcile namespace"], spans["Create Namespace"]
+	if root == nil || step == nil || create == nil {
+		t.Fatalf("spans: (%v)", spans)
+	}
+	if step.Parent.SpanID() != root.SpanContext.SpanID() || create.Parent.SpanID() != step.SpanContext.SpanID() {
+		t.Errorf("span parents: step (%v) create (%v)", step.Parent.SpanID(), create.Parent.SpanID())
+	}
+	attributes := map[string]string{}
+	for _, attribute := range root.Attributes {
+		attributes[string(attribute.Key)] = attribute.Value.Emit()
+	}
+	if attributes["onboarding.environment"] != name || attributes["onboarding.namespace"] != projectname ||
+		attributes["onboarding.result"] != "success" {
+		t.Errorf("reconcile attributes: (%v)", attributes)
+	}
+	for _, stepName := range []string{"quota", "pressure", "limitrange", "rbac"} {
+		if spans["Reconcile "+stepName] == nil {
+			t.Errorf("missing span of step %s", stepName)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package environment
+
+import (
+	"sort"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// quotaUsage returns the consumption of each hard key of the ResourceQuota status, sorted by key, and the
+// highest percentage
+func quotaUsage(rq *corev1.ResourceQuota) ([]onboardingv1alpha1.QuotaUsage, int32) {
+	var keys []string
+	for key := range rq.Status.Hard {
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+
+	var usage []onboardingv1alpha1.QuotaUsage
+	var max int32
+	for _, key := range keys {
+		hard := rq.Status.Hard[corev1.ResourceName(key)]
+		used := rq.Status.Used[corev1.ResourceName(key)]
+		var percent int32
+		if hard.MilliValue() > 0 {
+			percent = int32(float64(used.MilliValue()) * 100 / float64(hard.MilliValue()))
+		} else if used.MilliValue() > 0 {
+			percent = 100
+		}
+		if percent > max {
+			max = percent
+		}
+		usage = append(usage, onboardingv1alpha1.QuotaUsage{
+			Resource: key,
+			Hard:     hard.String(),
+			Used:     used.String(),
+			Percent:  percent,
+		})
+	}
+	return usage, max
+}
@@ -0,0 +1,73 @@
+package environment
+
+import (
+	"context"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestEnvironmentUsage(t *testing.T) {
+	env := environment.DeepCopy()
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env, &onboardingv1alpha1.EnvironmentPolicyList{})
+	cl := fake.NewFakeClient(env)
+	r := &ReconcileEnvironment{client: cl, scheme: s}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+
+	// Simulate the quota controller updating the ResourceQuota status
+	rq := &corev1.ResourceQuota{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "cno-resource-quota", Namespace: projectname}, rq); err != nil {
+		t.Fatalf("get resourcequota: (%v)", err)
+	}
+	rq.Status.Hard = corev1.ResourceList{
+		corev1.ResourceRequestsCPU:     resource.MustParse("2"),
+		corev1.ResourceRequestsMemory:  resource.MustParse("4Gi"),
+		corev1.ResourcePods:            resource.MustParse("0"),
+		corev1.ResourceRequestsStorage: resource.MustParse("200Ti"),
+	}
+	rq.Status.Used = corev1.ResourceList{
+		corev1.ResourceRequestsCPU:    resource.MustParse("500m"),
+		corev1.ResourceRequestsMemory: resource.MustParse("3Gi"),
+		// Large enough for the milli value times 100 to overflow an int64
+		corev1.ResourceRequestsStorage: resource.MustParse("100Ti"),
+	}
+	if err := cl.Status().Update(context.TODO(), rq); err != nil {
+		t.Fatalf("update resourcequota status: (%v)", err)
+	}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	expected := []onboardingv1alpha1.QuotaUsage{
+		{Resource: "pods", Hard: "0", Used: "0", Percent: 0},
+		{Resource: "requests.cpu", Hard: "2", Used: "500m", Percent: 25},
+		{Resource: "requests.memory", Hard: "4Gi", Used: "3Gi", Percent: 75},
+		{Resource: "requests.storage", Hard: "200Ti", Used: "100Ti", Percent: 50},
+	}
+	if len(env.Status.Usage) != len(expected) {
+		t.Fatalf("usage: (%v)", env.Status.Usage)
+	}
+	for i := range expected {
+		if env.Status.Usage[i] != expected[i] {
+			t.Errorf("usage %d: (%v) expected (%v)", i, env.Status.Usage[i], expected[i])
+		}
+	}
+	if env.Status.MaxUsagePercent != 75 {
+		t.Errorf("max usage percent: (%v)", env.Status.MaxUsagePercent)
+	}
+}
@@ -0,0 +1,482 @@
+package environmentpromotion
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/objectmeta"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/sharding"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_environmentpromotion")
+
+const (
+	// environmentNotFoundRetry is the delay before checking again a promotion between missing Environments
+	environmentNotFoundRetry = time.Minute
+	// promotionRetry is the delay before promoting again the objects that failed
+	promotionRetry = time.Minute
+)
+
+// defaultKinds are the kinds promoted when the promotion doesn't list any
+var defaultKinds = []string{"ConfigMap", "Deployment"}
+
+// ApprovalWebhook tells whether the EnvironmentPromotion webhook checks that ApprovedBy is the approving user. The
+// promotions into production Environments are rejected without it. It is set from the manager flags.
+var ApprovalWebhook bool
+
+// Approvers are the operator approvers, who approve the promotions into every production Environment. They are set
+// from the manager flags.
+var Approvers []string
+
+// Add creates a new EnvironmentPromotion Controller and adds it to the Manager. The Manager will set fields on the
+// Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileEnvironmentPromotion{
+		client:   mgr.GetClient(),
+		reader:   mgr.GetAPIReader(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetEventRecorderFor("environmentpromotion-controller"),
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("environmentpromotion-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource EnvironmentPromotion, only the promotions into the Environments of
+	// the shard of the operator instance are reconciled. The promoted objects aren't owned by the promotion.
+	return c.Watch(&source.Kind{Type: &onboardingv1alpha1.EnvironmentPromotion{}}, &handler.EnqueueRequestForObject{},
+		sharding.Current.RelatedPredicate(mgr.GetClient(), targetEnvironment))
+}
+
+// targetEnvironment returns the target Environment of an EnvironmentPromotion, for the shard predicate
+func targetEnvironment(_ metav1.Object, obj runtime.Object) (string, error) {
+	if promotion, ok := obj.(*onboardingv1alpha1.EnvironmentPromotion); ok {
+		return promotion.Spec.Target, nil
+	}
+	return "", nil
+}
+
+// blank assignment to verify that ReconcileEnvironmentPromotion implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileEnvironmentPromotion{}
+
+// ReconcileEnvironmentPromotion reconciles an EnvironmentPromotion object
+type ReconcileEnvironmentPromotion struct {
+	client client.Client
+	// reader reads the objects that aren't cached from the apiserver, the client when nil
+	reader   client.Reader
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+// apiReader returns the reader of the objects that aren't cached
+func (r *ReconcileEnvironmentPromotion) apiReader() client.Reader {
+	if r.reader == nil {
+		return r.client
+	}
+	return r.reader
+}
+
+// Reconcile copies the objects selected in the Namespace of the source Environment into the Namespace of the target
+// Environment, with the overrides of the promotion, once approved when the target is a production Environment.
+// The result of each object is kept in the promotion status, and the objects that failed are promoted again later.
+func (r *ReconcileEnvironmentPromotion) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := log.WithValues("EnvironmentPromotion Name", request.Name)
+	reqLogger.Info("Reconciling EnvironmentPromotion")
+	ctx := context.TODO()
+
+	// Fetch the EnvironmentPromotion instance
+	instance := &onboardingv1alpha1.EnvironmentPromotion{}
+	err := r.client.Get(ctx, request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// The promoted objects are left in the target Namespace
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// The promotion is handled by the operator instance of the shard of its target Environment
+	owned, err := sharding.Current.OwnsEnvironment(ctx, r.client, instance.Spec.Target)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !owned {
+		reqLogger.Info("EnvironmentPromotion target Environment belongs to another shard", "Environment", instance.Spec.Target)
+		return reconcile.Result{}, nil
+	}
+
+	switch instance.Status.Phase {
+	case onboardingv1alpha1.PromotionPromoted, onboardingv1alpha1.PromotionRejected:
+		// Terminal phases, a new promotion must be created to promote the objects again
+		return reconcile.Result{}, nil
+	case "":
+		instance.Status.Phase = onboardingv1alpha1.PromotionPending
+		return reconcile.Result{}, r.client.Status().Update(ctx, instance)
+	}
+
+	if reason := validate(instance); reason != "" {
+		return reconcile.Result{}, r.reject(instance, reason)
+	}
+	// Checked by validate
+	selector, _ := metav1.LabelSelectorAsSelector(&instance.Spec.Selector)
+
+	source := &onboardingv1alpha1.Environment{}
+	target := &onboardingv1alpha1.Environment{}
+	for _, env := range []*onboardingv1alpha1.Environment{source, target} {
+		name := instance.Spec.Source
+		if env == target {
+			name = instance.Spec.Target
+		}
+		err = r.client.Get(ctx, types.NamespacedName{Name: name}, env)
+		if errors.IsNotFound(err) {
+			instance.Status.Message = fmt.Sprintf("Environment %s not found", name)
+			if err := r.client.Status().Update(ctx, instance); err != nil {
+				return reconcile.Result{}, err
+			}
+			return reconcile.Result{RequeueAfter: environmentNotFoundRetry}, nil
+		} else if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if target.Tier() == onboardingv1alpha1.TierProd {
+		if !instance.Spec.Approved {
+			instance.Status.Message = "Waiting for approval"
+			return reconcile.Result{}, r.client.Status().Update(ctx, instance)
+		}
+		if reason := checkApproval(instance, target); reason != "" {
+			return reconcile.Result{}, r.reject(instance, reason)
+		}
+		reqLogger.Info("EnvironmentPromotion approved", "Target", target.Name, "ApprovedBy", instance.Spec.ApprovedBy)
+	}
+
+	results, err := r.promote(ctx, instance, source.Spec.Name, target.Spec.Name, client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	instance.Status.Results = results
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Result]++
+	}
+	summary := fmt.Sprintf("%d created, %d updated, %d unchanged", counts[onboardingv1alpha1.PromotionCreated],
+		counts[onboardingv1alpha1.PromotionUpdated], counts[onboardingv1alpha1.PromotionUnchanged])
+
+	if failed := counts[onboardingv1alpha1.PromotionError]; failed > 0 {
+		instance.Status.Phase = onboardingv1alpha1.PromotionFailed
+		instance.Status.Message = fmt.Sprintf("%d objects failed to be promoted from Environment %s to %s, %s",
+			failed, source.Name, target.Name, summary)
+		r.event(instance, corev1.EventTypeWarning, "PromotionFailed", instance.Status.Message)
+		if err := r.client.Status().Update(ctx, instance); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{RequeueAfter: promotionRetry}, nil
+	}
+	now := metav1.Now()
+	instance.Status.Phase = onboardingv1alpha1.PromotionPromoted
+	instance.Status.PromotedAt = &now
+	instance.Status.Message = fmt.Sprintf("Promoted from Environment %s to %s: %s", source.Name, target.Name, summary)
+	reqLogger.Info("Objects promoted", "Source", source.Name, "Target", target.Name, "Objects", len(results))
+	r.event(instance, corev1.EventTypeNormal, "Promoted", instance.Status.Message)
+	return reconcile.Result{}, r.client.Status().Update(ctx, instance)
+}
+
+// promote copies the objects of the promoted kinds selected in the source Namespace into the target Namespace and
+// returns the result of each object. The objects are read from the API server, they aren't cached.
+func (r *ReconcileEnvironmentPromotion) promote(ctx context.Context, instance *onboardingv1alpha1.EnvironmentPromotion, source, target string, selector client.MatchingLabelsSelector) ([]onboardingv1alpha1.PromotionResult, error) {
+	var promoted []runtime.Object
+	opts := []client.ListOption{client.InNamespace(source), selector}
+	for _, kind := range promotedKinds(instance) {
+		switch kind {
+		case "ConfigMap":
+			configMaps := &corev1.ConfigMapList{}
+			if err := r.apiReader().List(ctx, configMaps, opts...); err != nil {
+				return nil, err
+			}
+			for _, configMap := range configMaps.Items {
+				promoted = append(promoted, &corev1.ConfigMap{
+					ObjectMeta: promotedObjectMeta(configMap.ObjectMeta, target, instance.Name),
+					Data:       configMap.Data,
+					BinaryData: configMap.BinaryData,
+				})
+			}
+		case "Secret":
+			secrets := &corev1.SecretList{}
+			if err := r.apiReader().List(ctx, secrets, opts...); err != nil {
+				return nil, err
+			}
+			for _, secret := range secrets.Items {
+				if secret.Type == corev1.SecretTypeServiceAccountToken {
+					continue
+				}
+				promoted = append(promoted, &corev1.Secret{
+					ObjectMeta: promotedObjectMeta(secret.ObjectMeta, target, instance.Name),
+					Type:       secret.Type,
+					Data:       secret.Data,
+				})
+			}
+		case "Deployment":
+			deployments := &appsv1.DeploymentList{}
+			if err := r.apiReader().List(ctx, deployments, opts...); err != nil {
+				return nil, err
+			}
+			for _, deployment := range deployments.Items {
+				spec := *deployment.Spec.DeepCopy()
+				overrideImages(&spec.Template.Spec, instance.Spec.Overrides.Images)
+				if replicas, found := instance.Spec.Overrides.Replicas[deployment.Name]; found {
+					spec.Replicas = &replicas
+				}
+				promoted = append(promoted, &appsv1.Deployment{
+					ObjectMeta: promotedObjectMeta(deployment.ObjectMeta, target, instance.Name),
+					Spec:       spec,
+				})
+			}
+		}
+	}
+
+	var results []onboardingv1alpha1.PromotionResult
+	for _, obj := range promoted {
+		result, err := r.apply(ctx, obj)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// apply creates the promoted object in the target Namespace, or merges it into the existing object
+func (r *ReconcileEnvironmentPromotion) apply(ctx context.Context, obj runtime.Object) (onboardingv1alpha1.PromotionResult, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return onboardingv1alpha1.PromotionResult{}, err
+	}
+	result := onboardingv1alpha1.PromotionResult{Kind: kindOf(obj), Name: accessor.GetName()}
+	failed := func(err error) (onboardingv1alpha1.PromotionResult, error) {
+		result.Result = onboardingv1alpha1.PromotionError
+		result.Message = err.Error()
+		return result, nil
+	}
+
+	existing := obj.DeepCopyObject()
+	err = r.apiReader().Get(ctx, types.NamespacedName{Name: accessor.GetName(), Namespace: accessor.GetNamespace()}, existing)
+	if errors.IsNotFound(err) {
+		if err := r.client.Create(ctx, obj); err != nil {
+			return failed(err)
+		}
+		result.Result = onboardingv1alpha1.PromotionCreated
+		return result, nil
+	} else if err != nil {
+		return failed(err)
+	}
+
+	previous := existing.DeepCopyObject()
+	if err := mergePromoted(existing, obj); err != nil {
+		return failed(err)
+	}
+	if equality.Semantic.DeepEqual(previous, existing) {
+		result.Result = onboardingv1alpha1.PromotionUnchanged
+		return result, nil
+	}
+	if err := r.client.Update(ctx, existing); err != nil {
+		return failed(err)
+	}
+	result.Result = onboardingv1alpha1.PromotionUpdated
+	return result, nil
+}
+
+// reject moves the promotion to the Rejected phase with the given reason
+func (r *ReconcileEnvironmentPromotion) reject(instance *onboardingv1alpha1.EnvironmentPromotion, reason string) error {
+	instance.Status.Phase = onboardingv1alpha1.PromotionRejected
+	instance.Status.Message = reason
+	r.event(instance, corev1.EventTypeWarning, "Rejected", reason)
+	return r.client.Status().Update(context.TODO(), instance)
+}
+
+// event records an event on the promotion
+func (r *ReconcileEnvironmentPromotion) event(instance *onboardingv1alpha1.EnvironmentPromotion, eventType, reason, message string) {
+	if r.recorder != nil {
+		r.recorder.Event(instance, eventType, reason, message)
+	}
+}
+
+// validate returns the reason why the promotion can't be done, or an empty string
+func validate(promotion *onboardingv1alpha1.EnvironmentPromotion) string {
+	if promotion.Spec.Source == promotion.Spec.Target {
+		return "the source and target Environments must differ"
+	}
+	if _, err := metav1.LabelSelectorAsSelector(&promotion.Spec.Selector); err != nil {
+		return fmt.Sprintf("invalid selector: %v", err)
+	}
+	for _, kind := range promotion.Spec.Kinds {
+		if kind != "ConfigMap" && kind != "Secret" && kind != "Deployment" {
+			return fmt.Sprintf("kind %q can't be promoted", kind)
+		}
+	}
+	return ""
+}
+
+// checkApproval returns the reason why the approval of a promotion into a production Environment isn't valid, or
+// an empty string. The approvers are the operator approvers and the ones of the approved spec of the target, its
+// live spec may not be approved yet. The EnvironmentPromotion webhook checked that ApprovedBy is the approving user,
+// and its membership of the approver groups.
+func checkApproval(promotion *onboardingv1alpha1.EnvironmentPromotion, target *onboardingv1alpha1.Environment) string {
+	if !ApprovalWebhook {
+		return "the approvals of the promotions into production Environments are only checked with the webhooks enabled"
+	}
+	approvers := append([]string{}, Approvers...)
+	if target.Status.ApprovedSpec != nil {
+		approvers = append(approvers, target.Status.ApprovedSpec.Approvers...)
+	}
+	if len(approvers) == 0 {
+		return fmt.Sprintf("Environment %s has no approved approvers, promotions into it can't be approved", target.Name)
+	}
+	for _, approver := range approvers {
+		if approver == promotion.Spec.ApprovedBy || strings.HasPrefix(approver, "group:") {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%q is not an approver of Environment %s", promotion.Spec.ApprovedBy, target.Name)
+}
+
+// promotedKinds returns the kinds of the objects promoted
+func promotedKinds(promotion *onboardingv1alpha1.EnvironmentPromotion) []string {
+	if len(promotion.Spec.Kinds) == 0 {
+		return defaultKinds
+	}
+	return promotion.Spec.Kinds
+}
+
+// promotedObjectMeta returns the metadata of the promoted copy of an object in the namespace: its name, labels and
+// annotations, without the runtime fields, and the name of the promotion
+func promotedObjectMeta(source metav1.ObjectMeta, namespace, promotion string) metav1.ObjectMeta {
+	promoted := objectmeta.Copy(source, namespace)
+	promoted.Annotations[onboardingv1alpha1.PromotedByAnnotation] = promotion
+	return promoted
+}
+
+// mergePromoted merges the labels, the annotations and the content of the promoted object into the existing one.
+// A hibernated Deployment stays scaled to zero, its promoted replicas are restored when it wakes up.
+func mergePromoted(existing, promoted runtime.Object) error {
+	existingMeta, err := meta.Accessor(existing)
+	if err != nil {
+		return err
+	}
+	promotedMeta, err := meta.Accessor(promoted)
+	if err != nil {
+		return err
+	}
+	existingMeta.SetLabels(merge(existingMeta.GetLabels(), promotedMeta.GetLabels()))
+	existingMeta.SetAnnotations(merge(existingMeta.GetAnnotations(), promotedMeta.GetAnnotations()))
+
+	switch existing := existing.(type) {
+	case *corev1.ConfigMap:
+		promoted := promoted.(*corev1.ConfigMap)
+		existing.Data = promoted.Data
+		existing.BinaryData = promoted.BinaryData
+	case *corev1.Secret:
+		promoted := promoted.(*corev1.Secret)
+		if existing.Type != promoted.Type {
+			return fmt.Errorf("the Secret type %s can't be changed to %s", existing.Type, promoted.Type)
+		}
+		existing.Data = promoted.Data
+	case *appsv1.Deployment:
+		promoted := promoted.(*appsv1.Deployment)
+		replicas := existing.Spec.Replicas
+		existing.Spec = promoted.Spec
+		if _, hibernated := existing.Annotations[onboardingv1alpha1.HibernatedReplicasAnnotation]; hibernated {
+			// The API server defaults the replicas to 1
+			count := int32(1)
+			if promoted.Spec.Replicas != nil {
+				count = *promoted.Spec.Replicas
+			}
+			existing.Annotations[onboardingv1alpha1.HibernatedReplicasAnnotation] = fmt.Sprint(count)
+			existing.Spec.Replicas = replicas
+		}
+	}
+	return nil
+}
+
+// merge returns the values of the existing map overwritten by the promoted ones
+func merge(existing, promoted map[string]string) map[string]string {
+	if len(promoted) == 0 {
+		return existing
+	}
+	merged := map[string]string{}
+	for key, value := range existing {
+		merged[key] = value
+	}
+	for key, value := range promoted {
+		merged[key] = value
+	}
+	return merged
+}
+
+// overrideImages replaces the tags of the images of the pod containers whose repository has a tag override
+func overrideImages(spec *corev1.PodSpec, tags map[string]string) {
+	for i := range spec.InitContainers {
+		spec.InitContainers[i].Image = overrideImage(spec.InitContainers[i].Image, tags)
+	}
+	for i := range spec.Containers {
+		spec.Containers[i].Image = overrideImage(spec.Containers[i].Image, tags)
+	}
+}
+
+// overrideImage returns the image with the tag overriding the tag or the digest of its repository, or the image
+// itself without override
+func overrideImage(image string, tags map[string]string) string {
+	repository := image
+	if i := strings.Index(repository, "@"); i >= 0 {
+		repository = repository[:i]
+	}
+	// The registry host may have a port, the tag follows the last path segment
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+	if tag, found := tags[repository]; found {
+		return repository + ":" + tag
+	}
+	return image
+}
+
+// kindOf returns the kind of a promoted object
+func kindOf(obj runtime.Object) string {
+	switch obj.(type) {
+	case *corev1.ConfigMap:
+		return "ConfigMap"
+	case *corev1.Secret:
+		return "Secret"
+	case *appsv1.Deployment:
+		return "Deployment"
+	}
+	return ""
+}
@@ -0,0 +1,200 @@
+package environmentpromotion
+
+import (
+	"context"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	name     = "release-42"
+	promoted = map[string]string{"promote": "true"}
+
+	staging = &onboardingv1alpha1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "staging"},
+		Spec:       onboardingv1alpha1.EnvironmentSpec{Name: "shop-staging", Tier: "staging"},
+	}
+	production = &onboardingv1alpha1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "production"},
+		Spec:       onboardingv1alpha1.EnvironmentSpec{Name: "shop-prod", IsProd: true, Approvers: []string{"approver1"}},
+		Status: onboardingv1alpha1.EnvironmentStatus{
+			ApprovedSpec: &onboardingv1alpha1.EnvironmentSpec{Name: "shop-prod", IsProd: true, Approvers: []string{"approver1"}},
+		},
+	}
+)
+
+func newPromotion(target, approvedBy string) *onboardingv1alpha1.EnvironmentPromotion {
+	return &onboardingv1alpha1.EnvironmentPromotion{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: onboardingv1alpha1.EnvironmentPromotionSpec{
+			Source:   "staging",
+			Target:   target,
+			Selector: metav1.LabelSelector{MatchLabels: promoted},
+			Overrides: onboardingv1alpha1.PromotionOverrides{
+				Images:   map[string]string{"registry:5000/shop/web": "1.2.0"},
+				Replicas: map[string]int32{"web": 4},
+			},
+			Approved:   approvedBy != "",
+			ApprovedBy: approvedBy,
+		},
+	}
+}
+
+func newTestReconciler(objs ...runtime.Object) *ReconcileEnvironmentPromotion {
+	ApprovalWebhook = true
+	replicas := int32(1)
+	objs = append(objs, staging.DeepCopy(), production.DeepCopy(),
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "shop-staging", Labels: promoted},
+			Data:       map[string]string{"level": "info"},
+		},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "local", Namespace: "shop-staging"}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop-staging", Labels: promoted},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+					{Name: "web", Image: "registry:5000/shop/web:1.2.0-rc1"},
+					{Name: "proxy", Image: "envoyproxy/envoy:v1.14"},
+				}}},
+			},
+		})
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, &onboardingv1alpha1.Environment{}, &onboardingv1alpha1.EnvironmentPromotion{})
+	return &ReconcileEnvironmentPromotion{client: fake.NewFakeClient(objs...), scheme: s, recorder: record.NewFakeRecorder(10)}
+}
+
+func reconcilePromotion(t *testing.T, r *ReconcileEnvironmentPromotion) *onboardingv1alpha1.EnvironmentPromotion {
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	promotion := &onboardingv1alpha1.EnvironmentPromotion{}
+	if err := r.client.Get(context.TODO(), req.NamespacedName, promotion); err != nil {
+		t.Fatalf("get environmentpromotion: (%v)", err)
+	}
+	return promotion
+}
+
+func TestPromotion(t *testing.T) {
+	zero := int32(0)
+	hibernated := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop-prod",
+			Annotations: map[string]string{onboardingv1alpha1.HibernatedReplicasAnnotation: "2"}},
+		Spec: appsv1.DeploymentSpec{Replicas: &zero},
+	}
+	r := newTestReconciler(newPromotion("production", "approver1"), hibernated)
+
+	reconcilePromotion(t, r)
+	promotion := reconcilePromotion(t, r)
+	if promotion.Status.Phase != onboardingv1alpha1.PromotionPromoted || promotion.Status.PromotedAt == nil {
+		t.Fatalf("expected phase %s, got %s (%s)", onboardingv1alpha1.PromotionPromoted, promotion.Status.Phase, promotion.Status.Message)
+	}
+	expected := []onboardingv1alpha1.PromotionResult{
+		{Kind: "ConfigMap", Name: "settings", Result: onboardingv1alpha1.PromotionCreated},
+		{Kind: "Deployment", Name: "web", Result: onboardingv1alpha1.PromotionUpdated},
+	}
+	if len(promotion.Status.Results) != len(expected) {
+		t.Fatalf("expected results %v, got %v", expected, promotion.Status.Results)
+	}
+	for i := range expected {
+		if promotion.Status.Results[i] != expected[i] {
+			t.Errorf("expected results %v, got %v", expected, promotion.Status.Results)
+		}
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "settings", Namespace: "shop-prod"}, configMap); err != nil {
+		t.Fatalf("get configmap: (%v)", err)
+	}
+	if configMap.Data["level"] != "info" || configMap.Annotations[onboardingv1alpha1.PromotedByAnnotation] != name {
+		t.Errorf("ConfigMap should be promoted, got %v", configMap)
+	}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "local", Namespace: "shop-prod"}, &corev1.ConfigMap{}); err == nil {
+		t.Error("ConfigMap not selected shouldn't be promoted")
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "web", Namespace: "shop-prod"}, deployment); err != nil {
+		t.Fatalf("get deployment: (%v)", err)
+	}
+	containers := deployment.Spec.Template.Spec.Containers
+	if len(containers) != 2 || containers[0].Image != "registry:5000/shop/web:1.2.0" || containers[1].Image != "envoyproxy/envoy:v1.14" {
+		t.Errorf("Deployment images should be overridden, got %v", containers)
+	}
+	// The hibernated Deployment gets its replicas on wake-up
+	if *deployment.Spec.Replicas != 0 || deployment.Annotations[onboardingv1alpha1.HibernatedReplicasAnnotation] != "4" {
+		t.Errorf("hibernated Deployment should stay scaled to zero, got %d replicas and annotations %v", *deployment.Spec.Replicas, deployment.Annotations)
+	}
+}
+
+func TestPromotionWaitsForApproval(t *testing.T) {
+	r := newTestReconciler(newPromotion("production", ""))
+
+	reconcilePromotion(t, r)
+	promotion := reconcilePromotion(t, r)
+	if promotion.Status.Phase != onboardingv1alpha1.PromotionPending || promotion.Status.Message != "Waiting for approval" {
+		t.Fatalf("expected phase %s, got %s (%s)", onboardingv1alpha1.PromotionPending, promotion.Status.Phase, promotion.Status.Message)
+	}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "settings", Namespace: "shop-prod"}, &corev1.ConfigMap{}); err == nil {
+		t.Error("objects shouldn't be promoted before the approval")
+	}
+
+	promotion.Spec.Approved = true
+	promotion.Spec.ApprovedBy = "someone"
+	if err := r.client.Update(context.TODO(), promotion); err != nil {
+		t.Fatalf("update environmentpromotion: (%v)", err)
+	}
+	promotion = reconcilePromotion(t, r)
+	if promotion.Status.Phase != onboardingv1alpha1.PromotionRejected {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.PromotionRejected, promotion.Status.Phase)
+	}
+}
+
+func TestOverrideImage(t *testing.T) {
+	tags := map[string]string{"registry:5000/shop/web": "2.0", "nginx": "1.19"}
+	tests := map[string]string{
+		"registry:5000/shop/web:1.0":           "registry:5000/shop/web:2.0",
+		"registry:5000/shop/web":               "registry:5000/shop/web:2.0",
+		"registry:5000/shop/web@sha256:abcdef": "registry:5000/shop/web:2.0",
+		"nginx:1.18":                           "nginx:1.19",
+		"registry:5000/shop/api:1.0":           "registry:5000/shop/api:1.0",
+	}
+	for image, expected := range tests {
+		if overridden := overrideImage(image, tags); overridden != expected {
+			t.Errorf("overrideImage(%s): expected %s, got %s", image, expected, overridden)
+		}
+	}
+}
+
+func TestPromotionRejectsTargetWithoutApprovedApprovers(t *testing.T) {
+	r := newTestReconciler(newPromotion("production", "approver1"))
+	target := &onboardingv1alpha1.Environment{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "production"}, target); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	// The approver of the live spec isn't approved yet
+	target.Status.ApprovedSpec.Approvers = nil
+	if err := r.client.Update(context.TODO(), target); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+
+	reconcilePromotion(t, r)
+	promotion := reconcilePromotion(t, r)
+	if promotion.Status.Phase != onboardingv1alpha1.PromotionRejected {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.PromotionRejected, promotion.Status.Phase)
+	}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: "settings", Namespace: "shop-prod"}, &corev1.ConfigMap{}); err == nil {
+		t.Error("objects shouldn't be promoted without approvers")
+	}
+}
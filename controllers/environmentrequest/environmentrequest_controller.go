@@ -0,0 +1,233 @@
+package environmentrequest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/sharding"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_environmentrequest")
+
+// Add creates a new EnvironmentRequest Controller and adds it to the Manager. The Manager will set fields on the
+// Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileEnvironmentRequest{
+		client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetEventRecorderFor("environmentrequest-controller"),
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("environmentrequest-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource EnvironmentRequest, only the requests of the Environments of the shard
+	// of the operator instance are reconciled
+	err = c.Watch(&source.Kind{Type: &onboardingv1alpha1.EnvironmentRequest{}}, &handler.EnqueueRequestForObject{},
+		sharding.Current.RelatedPredicate(mgr.GetClient(), requestedEnvironment))
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the materialised Environments and requeue their request, the cluster-scoped Environment
+	// can't be owned by the namespaced request
+	return c.Watch(&source.Kind{Type: &onboardingv1alpha1.Environment{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+			request := a.Meta.GetAnnotations()[onboardingv1alpha1.EnvironmentRequestAnnotation]
+			parts := strings.SplitN(request, "/", 2)
+			if len(parts) != 2 {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: parts[0], Name: parts[1]}}}
+		}),
+	}, sharding.Current.EnvironmentPredicate())
+}
+
+// requestedEnvironment returns the Environment of an EnvironmentRequest, for the shard predicate
+func requestedEnvironment(_ metav1.Object, obj runtime.Object) (string, error) {
+	if er, ok := obj.(*onboardingv1alpha1.EnvironmentRequest); ok {
+		return er.EnvironmentName(), nil
+	}
+	return "", nil
+}
+
+// blank assignment to verify that ReconcileEnvironmentRequest implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileEnvironmentRequest{}
+
+// ReconcileEnvironmentRequest reconciles an EnvironmentRequest object
+type ReconcileEnvironmentRequest struct {
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+// Reconcile creates the Environment of an EnvironmentRequest in a new namespace, once approved when the
+// EnvironmentPolicies of its tier list request approvers, and mirrors the status of the Environment into the request.
+// The EnvironmentRequest webhook checked the requested Environment against the policies for the requester, so the
+// requests are only reconciled when the webhooks are served. Deleting the request leaves the Environment.
+func (r *ReconcileEnvironmentRequest) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := log.WithValues("EnvironmentRequest.Namespace", request.Namespace, "EnvironmentRequest.Name", request.Name)
+	reqLogger.Info("Reconciling EnvironmentRequest")
+
+	// Fetch the EnvironmentRequest instance
+	instance := &onboardingv1alpha1.EnvironmentRequest{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	switch instance.Status.Phase {
+	case onboardingv1alpha1.EnvironmentRequestRejected, onboardingv1alpha1.EnvironmentRequestDeleted:
+		// Terminal phases, a new request must be created
+		return reconcile.Result{}, nil
+	}
+
+	envName := instance.EnvironmentName()
+	// The request is handled by the operator instance of the shard of its Environment
+	owned, err := sharding.Current.OwnsEnvironment(context.TODO(), r.client, envName)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !owned {
+		reqLogger.Info("EnvironmentRequest Environment belongs to another shard", "Environment", envName)
+		return reconcile.Result{}, nil
+	}
+
+	if instance.Status.Phase == "" {
+		instance.Status.Phase = onboardingv1alpha1.EnvironmentRequestPending
+		r.event(instance, corev1.EventTypeNormal, "Requested", fmt.Sprintf("%s requested Environment %s", instance.Spec.RequestedBy, envName))
+	}
+	instance.Status.Environment = envName
+	env := &onboardingv1alpha1.Environment{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: envName}, env)
+	switch {
+	case err == nil:
+		if env.Annotations[onboardingv1alpha1.EnvironmentRequestAnnotation] != instance.Namespace+"/"+instance.Name {
+			return reconcile.Result{}, r.reject(instance, fmt.Sprintf("Environment %s already exists", envName))
+		}
+		mirror(instance, env)
+		return reconcile.Result{}, r.client.Status().Update(context.TODO(), instance)
+	case !errors.IsNotFound(err):
+		return reconcile.Result{}, err
+	case instance.Status.CreatedAt != nil:
+		instance.Status.Phase = onboardingv1alpha1.EnvironmentRequestDeleted
+		instance.Status.Message = fmt.Sprintf("Environment %s was deleted", envName)
+		r.event(instance, corev1.EventTypeWarning, "Deleted", instance.Status.Message)
+		return reconcile.Result{}, r.client.Status().Update(context.TODO(), instance)
+	}
+
+	env = instance.RequestedEnvironment()
+	// The Environment doesn't take over an existing namespace, the namespace may have been created since the request
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: env.Spec.Name}, &corev1.Namespace{})
+	if err == nil {
+		return reconcile.Result{}, r.reject(instance, fmt.Sprintf("namespace %s already exists", env.Spec.Name))
+	} else if !errors.IsNotFound(err) {
+		return reconcile.Result{}, err
+	}
+	policies := &onboardingv1alpha1.EnvironmentPolicyList{}
+	if err := r.client.List(context.TODO(), policies); err != nil {
+		return reconcile.Result{}, err
+	}
+	if approvalRequired(policies.Items, env) {
+		if !instance.Spec.Approved {
+			instance.Status.Message = "Waiting for approval"
+			return reconcile.Result{}, r.client.Status().Update(context.TODO(), instance)
+		}
+		if instance.Spec.ApprovedBy == "" || instance.Spec.ApprovedBy == instance.Spec.RequestedBy {
+			return reconcile.Result{}, r.reject(instance, "a request can't be approved by its requester")
+		}
+	}
+
+	reqLogger.Info("Creating the requested Environment", "Environment", envName)
+	if err := r.client.Create(context.TODO(), env); err != nil {
+		if errors.IsForbidden(err) || errors.IsInvalid(err) {
+			// Denied by the Environment webhook, e.g. above the cluster capacity
+			return reconcile.Result{}, r.reject(instance, err.Error())
+		}
+		return reconcile.Result{}, err
+	}
+	now := metav1.Now()
+	instance.Status.CreatedAt = &now
+	mirror(instance, env)
+	approver := instance.Spec.ApprovedBy
+	if approver == "" {
+		approver = "no approval required"
+	}
+	r.event(instance, corev1.EventTypeNormal, "Created", fmt.Sprintf("Environment %s created (%s)", envName, approver))
+	return reconcile.Result{}, r.client.Status().Update(context.TODO(), instance)
+}
+
+// mirror copies the namespace and the status of the Environment into the request status
+func mirror(instance *onboardingv1alpha1.EnvironmentRequest, env *onboardingv1alpha1.Environment) {
+	instance.Status.Namespace = env.Spec.Name
+	instance.Status.EnvironmentStatus = env.Status.EnvironmentStatus
+	instance.Status.PendingChanges = env.Status.PendingChanges
+	if env.Status.EnvironmentStatus == onboardingv1alpha1.EnvironmentReady {
+		instance.Status.Phase = onboardingv1alpha1.EnvironmentRequestReady
+		instance.Status.Message = fmt.Sprintf("Environment %s is ready", env.Name)
+		return
+	}
+	instance.Status.Phase = onboardingv1alpha1.EnvironmentRequestProvisioning
+	instance.Status.Message = fmt.Sprintf("Environment %s is being provisioned", env.Name)
+	if len(env.Status.PendingChanges) > 0 {
+		instance.Status.Message = fmt.Sprintf("Environment %s is waiting for its production approval", env.Name)
+	}
+}
+
+// approvalRequired tells whether an EnvironmentPolicy rule of the Environment tier lists request approvers
+func approvalRequired(policies []onboardingv1alpha1.EnvironmentPolicy, env *onboardingv1alpha1.Environment) bool {
+	for _, policy := range policies {
+		for _, rule := range policy.Spec.Rules {
+			if (rule.Tier == "" || rule.Tier == env.Tier()) && len(rule.RequestApprovers) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reject moves the request to the Rejected phase with the given reason
+func (r *ReconcileEnvironmentRequest) reject(instance *onboardingv1alpha1.EnvironmentRequest, reason string) error {
+	instance.Status.Phase = onboardingv1alpha1.EnvironmentRequestRejected
+	instance.Status.Message = reason
+	r.event(instance, corev1.EventTypeWarning, "Rejected", reason)
+	return r.client.Status().Update(context.TODO(), instance)
+}
+
+// event records an event on the request and mirrors it as a log line
+func (r *ReconcileEnvironmentRequest) event(instance *onboardingv1alpha1.EnvironmentRequest, eventType, reason, message string) {
+	if r.recorder != nil {
+		r.recorder.Event(instance, eventType, reason, message)
+	}
+	log.Info("EnvironmentRequest "+reason, "EnvironmentRequest.Namespace", instance.Namespace, "EnvironmentRequest.Name", instance.Name,
+		"Environment", instance.Status.Environment, "User", instance.Spec.RequestedBy, "Message", message)
+}
@@ -0,0 +1,157 @@
+package environmentrequest
+
+import (
+	"context"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	name        = "payments"
+	namespace   = "team-payments"
+	envName     = namespace + "-" + name
+	projectname = "payments-dev"
+
+	policy = &onboardingv1alpha1.EnvironmentPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: onboardingv1alpha1.EnvironmentPolicySpec{
+			Rules: []onboardingv1alpha1.EnvironmentPolicyRule{
+				{
+					Tier:             onboardingv1alpha1.TierProd,
+					RequestApprovers: []string{"group:platform"},
+				},
+			},
+		},
+	}
+)
+
+func newEnvironmentRequest(isProd bool, approvedBy string) *onboardingv1alpha1.EnvironmentRequest {
+	return &onboardingv1alpha1.EnvironmentRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: onboardingv1alpha1.EnvironmentRequestSpec{
+			Environment: onboardingv1alpha1.EnvironmentSpec{
+				Name:    projectname,
+				IsProd:  isProd,
+				Storage: "10Gi",
+			},
+			RequestedBy: "user1",
+			Approved:    approvedBy != "",
+			ApprovedBy:  approvedBy,
+		},
+	}
+}
+
+func newTestReconciler(objs ...runtime.Object) *ReconcileEnvironmentRequest {
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, &onboardingv1alpha1.Environment{}, &onboardingv1alpha1.EnvironmentRequest{},
+		&onboardingv1alpha1.EnvironmentPolicy{}, &onboardingv1alpha1.EnvironmentPolicyList{})
+	objs = append(objs, policy.DeepCopy())
+	return &ReconcileEnvironmentRequest{client: fake.NewFakeClient(objs...), scheme: s, recorder: record.NewFakeRecorder(10)}
+}
+
+func reconcileEnvironmentRequest(t *testing.T, r *ReconcileEnvironmentRequest) *onboardingv1alpha1.EnvironmentRequest {
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	er := &onboardingv1alpha1.EnvironmentRequest{}
+	if err := r.client.Get(context.TODO(), req.NamespacedName, er); err != nil {
+		t.Fatalf("get environmentrequest: (%v)", err)
+	}
+	return er
+}
+
+func TestEnvironmentRequestMaterialisedAndMirrored(t *testing.T) {
+	r := newTestReconciler(newEnvironmentRequest(false, ""))
+
+	er := reconcileEnvironmentRequest(t, r)
+	if er.Status.Phase != onboardingv1alpha1.EnvironmentRequestProvisioning || er.Status.Environment != envName || er.Status.Namespace != projectname {
+		t.Fatalf("expected the %s Environment %s of namespace %s, got %v", onboardingv1alpha1.EnvironmentRequestProvisioning, envName, projectname, er.Status)
+	}
+	env := &onboardingv1alpha1.Environment{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: envName}, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	if env.Annotations[onboardingv1alpha1.EnvironmentRequestAnnotation] != namespace+"/"+name || env.Spec.Storage != "10Gi" ||
+		len(env.Spec.Users) != 1 || env.Spec.Users[0].Username != "user1" || env.Spec.Users[0].Role != "admin" {
+		t.Errorf("unexpected materialised Environment: %v", env)
+	}
+
+	// The readiness of the Environment is mirrored
+	env.Status.EnvironmentStatus = onboardingv1alpha1.EnvironmentReady
+	if err := r.client.Status().Update(context.TODO(), env); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+	er = reconcileEnvironmentRequest(t, r)
+	if er.Status.Phase != onboardingv1alpha1.EnvironmentRequestReady || er.Status.EnvironmentStatus != onboardingv1alpha1.EnvironmentReady {
+		t.Errorf("expected phase %s, got %v", onboardingv1alpha1.EnvironmentRequestReady, er.Status)
+	}
+
+	// A deleted Environment isn't created again
+	if err := r.client.Delete(context.TODO(), env); err != nil {
+		t.Fatalf("delete environment: (%v)", err)
+	}
+	er = reconcileEnvironmentRequest(t, r)
+	if er.Status.Phase != onboardingv1alpha1.EnvironmentRequestDeleted {
+		t.Errorf("expected phase %s, got %s", onboardingv1alpha1.EnvironmentRequestDeleted, er.Status.Phase)
+	}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: envName}, env); !errors.IsNotFound(err) {
+		t.Errorf("expected no Environment, got (%v)", err)
+	}
+}
+
+func TestEnvironmentRequestWaitsForApproval(t *testing.T) {
+	r := newTestReconciler(newEnvironmentRequest(true, ""))
+
+	er := reconcileEnvironmentRequest(t, r)
+	if er.Status.Phase != onboardingv1alpha1.EnvironmentRequestPending {
+		t.Fatalf("expected phase %s, got %s (%s)", onboardingv1alpha1.EnvironmentRequestPending, er.Status.Phase, er.Status.Message)
+	}
+	env := &onboardingv1alpha1.Environment{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: envName}, env); !errors.IsNotFound(err) {
+		t.Fatalf("expected no Environment before the approval, got (%v)", err)
+	}
+
+	er.Spec.Approved, er.Spec.ApprovedBy = true, "alice"
+	if err := r.client.Update(context.TODO(), er); err != nil {
+		t.Fatalf("update environmentrequest: (%v)", err)
+	}
+	er = reconcileEnvironmentRequest(t, r)
+	if er.Status.Phase != onboardingv1alpha1.EnvironmentRequestProvisioning || er.Status.CreatedAt == nil {
+		t.Errorf("expected phase %s, got %v", onboardingv1alpha1.EnvironmentRequestProvisioning, er.Status)
+	}
+}
+
+func TestEnvironmentRequestRejectsExistingEnvironment(t *testing.T) {
+	existing := &onboardingv1alpha1.Environment{ObjectMeta: metav1.ObjectMeta{Name: envName}}
+	r := newTestReconciler(newEnvironmentRequest(false, ""), existing)
+
+	er := reconcileEnvironmentRequest(t, r)
+	if er.Status.Phase != onboardingv1alpha1.EnvironmentRequestRejected {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.EnvironmentRequestRejected, er.Status.Phase)
+	}
+}
+
+func TestEnvironmentRequestRejectsExistingNamespace(t *testing.T) {
+	existing := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: projectname}}
+	r := newTestReconciler(newEnvironmentRequest(false, ""), existing)
+
+	er := reconcileEnvironmentRequest(t, r)
+	if er.Status.Phase != onboardingv1alpha1.EnvironmentRequestRejected {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.EnvironmentRequestRejected, er.Status.Phase)
+	}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: envName}, &onboardingv1alpha1.Environment{}); !errors.IsNotFound(err) {
+		t.Errorf("expected no Environment, got (%v)", err)
+	}
+}
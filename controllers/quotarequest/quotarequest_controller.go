@@ -0,0 +1,345 @@
+package quotarequest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/sharding"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_quotarequest")
+
+// environmentNotFoundRetry is the delay before checking again a QuotaRequest of a missing Environment
+const environmentNotFoundRetry = time.Minute
+
+// Add creates a new QuotaRequest Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileQuotaRequest{
+		client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetEventRecorderFor("quotarequest-controller"),
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("quotarequest-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Only the requests of the Environments of the shard of the operator instance are reconciled
+	requested := sharding.Current.RelatedPredicate(mgr.GetClient(), func(meta metav1.Object, _ runtime.Object) (string, error) {
+		return environmentOf(context.TODO(), mgr.GetClient(), meta.GetNamespace())
+	})
+
+	// Watch for changes to primary resource QuotaRequest
+	return c.Watch(&source.Kind{Type: &onboardingv1alpha1.QuotaRequest{}}, &handler.EnqueueRequestForObject{}, requested)
+}
+
+// environmentOf returns the name of the Environment of the namespace, from its Environment label, or an empty
+// string
+func environmentOf(ctx context.Context, c client.Reader, namespace string) (string, error) {
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	return ns.Labels[onboardingv1alpha1.EnvironmentLabel], nil
+}
+
+// blank assignment to verify that ReconcileQuotaRequest implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileQuotaRequest{}
+
+// ReconcileQuotaRequest reconciles a QuotaRequest object
+type ReconcileQuotaRequest struct {
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+// Reconcile applies the resources and storage of a QuotaRequest to the Environment of its namespace once it is
+// approved, or right away below the auto-approval thresholds of the EnvironmentPolicies. A temporary request
+// restores the previous values of the Environment once it expires.
+func (r *ReconcileQuotaRequest) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := log.WithValues("QuotaRequest.Namespace", request.Namespace, "QuotaRequest.Name", request.Name)
+	reqLogger.Info("Reconciling QuotaRequest")
+
+	// Fetch the QuotaRequest instance
+	instance := &onboardingv1alpha1.QuotaRequest{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	switch instance.Status.Phase {
+	case onboardingv1alpha1.QuotaRequestExpired, onboardingv1alpha1.QuotaRequestRejected:
+		// Terminal phases, a new request must be created to change the quota again
+		return reconcile.Result{}, nil
+	case onboardingv1alpha1.QuotaRequestApplied:
+		if instance.Status.ExpiresAt == nil {
+			return reconcile.Result{}, nil
+		}
+		return r.reconcileApplied(instance)
+	case onboardingv1alpha1.QuotaRequestApplying:
+		return r.reconcileApplying(instance)
+	}
+
+	envName, err := environmentOf(context.TODO(), r.client, instance.Namespace)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if envName == "" {
+		return reconcile.Result{}, r.reject(instance, fmt.Sprintf("namespace %s doesn't belong to an Environment", instance.Namespace))
+	}
+	// The request is handled by the operator instance of the shard of its Environment
+	owned, err := sharding.Current.OwnsEnvironment(context.TODO(), r.client, envName)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !owned {
+		reqLogger.Info("QuotaRequest Environment belongs to another shard", "Environment", envName)
+		return reconcile.Result{}, nil
+	}
+
+	if instance.Status.Phase == "" {
+		instance.Status.Phase = onboardingv1alpha1.QuotaRequestPending
+		r.event(instance, corev1.EventTypeNormal, "Requested", fmt.Sprintf("%s: %s", instance.Spec.RequestedBy, instance.Spec.Justification))
+	}
+	instance.Status.Environment = envName
+	env := &onboardingv1alpha1.Environment{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: envName}, env)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			instance.Status.Message = fmt.Sprintf("Environment %s not found", envName)
+			if err := r.client.Status().Update(context.TODO(), instance); err != nil {
+				return reconcile.Result{}, err
+			}
+			return reconcile.Result{RequeueAfter: environmentNotFoundRetry}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	changes, raised, reason := requestedChanges(instance, env)
+	if reason != "" {
+		return reconcile.Result{}, r.reject(instance, reason)
+	}
+	policies := &onboardingv1alpha1.EnvironmentPolicyList{}
+	if err := r.client.List(context.TODO(), policies); err != nil {
+		return reconcile.Result{}, err
+	}
+	autoApproved := autoApproval(policies.Items, env, raised)
+	if !autoApproved {
+		if !instance.Spec.Approved {
+			instance.Status.Message = "Waiting for approval"
+			return reconcile.Result{}, r.client.Status().Update(context.TODO(), instance)
+		}
+		if instance.Spec.ApprovedBy == "" || instance.Spec.ApprovedBy == instance.Spec.RequestedBy {
+			return reconcile.Result{}, r.reject(instance, "a request can't be approved by its requester")
+		}
+	}
+
+	// Approved: the previous values are recorded before the Environment is updated, so that the request is
+	// completed by the next reconcile if its status can't be updated once the Environment is
+	previous := env.Spec.Resources
+	instance.Status.Phase = onboardingv1alpha1.QuotaRequestApplying
+	instance.Status.PreviousResources = &previous
+	instance.Status.PreviousStorage = env.Spec.Storage
+	instance.Status.AutoApproved = autoApproved
+	instance.Status.Changes = changes
+	instance.Status.Message = fmt.Sprintf("Updating the quota of Environment %s", env.Name)
+	if err := r.client.Status().Update(context.TODO(), instance); err != nil {
+		return reconcile.Result{}, err
+	}
+	return r.apply(instance, env)
+}
+
+// reconcileApplying completes a request whose Environment update may have been interrupted
+func (r *ReconcileQuotaRequest) reconcileApplying(instance *onboardingv1alpha1.QuotaRequest) (reconcile.Result, error) {
+	env := &onboardingv1alpha1.Environment{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Status.Environment}, env)
+	if errors.IsNotFound(err) {
+		return reconcile.Result{}, r.reject(instance, fmt.Sprintf("Environment %s not found", instance.Status.Environment))
+	} else if err != nil {
+		return reconcile.Result{}, err
+	}
+	return r.apply(instance, env)
+}
+
+// apply updates the Environment with the requested resources and storage, unless it already holds them, and moves
+// the request to the Applied phase
+func (r *ReconcileQuotaRequest) apply(instance *onboardingv1alpha1.QuotaRequest, env *onboardingv1alpha1.Environment) (reconcile.Result, error) {
+	if env.Spec.Resources != instance.Spec.Resources || env.Spec.Storage != instance.Spec.Storage {
+		env.Spec.Resources = instance.Spec.Resources
+		env.Spec.Storage = instance.Spec.Storage
+		log.Info("Updating the Environment quota", "QuotaRequest.Namespace", instance.Namespace, "QuotaRequest.Name", instance.Name,
+			"Environment", env.Name, "Changes", instance.Status.Changes)
+		if err := r.client.Update(context.TODO(), env); err != nil {
+			if errors.IsForbidden(err) || errors.IsInvalid(err) {
+				// Denied by the Environment webhook
+				return reconcile.Result{}, r.reject(instance, err.Error())
+			}
+			return reconcile.Result{}, err
+		}
+	}
+
+	now := metav1.Now()
+	instance.Status.Phase = onboardingv1alpha1.QuotaRequestApplied
+	instance.Status.AppliedAt = &now
+	instance.Status.Message = fmt.Sprintf("Quota of Environment %s updated", env.Name)
+	if duration := instance.Spec.Duration; duration != nil {
+		expiresAt := metav1.NewTime(now.Add(duration.Duration))
+		instance.Status.ExpiresAt = &expiresAt
+		instance.Status.Message += " until " + expiresAt.UTC().Format(time.RFC3339)
+	}
+	if env.Spec.IsProd {
+		instance.Status.Message += ", waiting for the production approval of the Environment"
+	}
+	approver := instance.Spec.ApprovedBy
+	if instance.Status.AutoApproved {
+		approver = "auto-approval"
+	}
+	r.event(instance, corev1.EventTypeNormal, "Applied", fmt.Sprintf("%s: %s", approver, instance.Status.Message))
+	if err := r.client.Status().Update(context.TODO(), instance); err != nil {
+		return reconcile.Result{}, err
+	}
+	if instance.Spec.Duration != nil {
+		return reconcile.Result{RequeueAfter: instance.Spec.Duration.Duration}, nil
+	}
+	return reconcile.Result{}, nil
+}
+
+// reconcileApplied restores the previous resources and storage of the Environment once a temporary request
+// expires. An Environment changed since the request was applied is left as it is.
+func (r *ReconcileQuotaRequest) reconcileApplied(instance *onboardingv1alpha1.QuotaRequest) (reconcile.Result, error) {
+	if remaining := time.Until(instance.Status.ExpiresAt.Time); remaining > 0 {
+		return reconcile.Result{RequeueAfter: remaining}, nil
+	}
+
+	env := &onboardingv1alpha1.Environment{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Status.Environment}, env)
+	switch {
+	case errors.IsNotFound(err):
+		instance.Status.Message = fmt.Sprintf("Environment %s not found, nothing to restore", instance.Status.Environment)
+	case err != nil:
+		return reconcile.Result{}, err
+	case env.Spec.Resources != instance.Spec.Resources || env.Spec.Storage != instance.Spec.Storage:
+		instance.Status.Message = fmt.Sprintf("Quota of Environment %s changed since the request, left as it is", env.Name)
+	default:
+		log.Info("Restoring the Environment quota", "QuotaRequest.Namespace", instance.Namespace, "QuotaRequest.Name", instance.Name, "Environment", env.Name)
+		if instance.Status.PreviousResources != nil {
+			env.Spec.Resources = *instance.Status.PreviousResources
+		}
+		env.Spec.Storage = instance.Status.PreviousStorage
+		if err := r.client.Update(context.TODO(), env); err != nil {
+			return reconcile.Result{}, err
+		}
+		instance.Status.Message = fmt.Sprintf("Quota of Environment %s restored", env.Name)
+	}
+	instance.Status.Phase = onboardingv1alpha1.QuotaRequestExpired
+	r.event(instance, corev1.EventTypeNormal, "Expired", instance.Status.Message)
+	return reconcile.Result{}, r.client.Status().Update(context.TODO(), instance)
+}
+
+// reject moves the request to the Rejected phase with the given reason
+func (r *ReconcileQuotaRequest) reject(instance *onboardingv1alpha1.QuotaRequest, reason string) error {
+	instance.Status.Phase = onboardingv1alpha1.QuotaRequestRejected
+	instance.Status.Message = reason
+	r.event(instance, corev1.EventTypeWarning, "Rejected", reason)
+	return r.client.Status().Update(context.TODO(), instance)
+}
+
+// event records an event on the request and mirrors it as a log line
+func (r *ReconcileQuotaRequest) event(instance *onboardingv1alpha1.QuotaRequest, eventType, reason, message string) {
+	if r.recorder != nil {
+		r.recorder.Event(instance, eventType, reason, message)
+	}
+	log.Info("QuotaRequest "+reason, "QuotaRequest.Namespace", instance.Namespace, "QuotaRequest.Name", instance.Name,
+		"Environment", instance.Status.Environment, "User", instance.Spec.RequestedBy, "Message", message)
+}
+
+// requestedChanges returns the changes of the request to the Environment quota as "key old -> new", in order,
+// the requested values of the raised ResourceQuota keys, or the reason why the request is invalid
+func requestedChanges(qr *onboardingv1alpha1.QuotaRequest, env *onboardingv1alpha1.Environment) ([]string, map[corev1.ResourceName]resource.Quantity, string) {
+	if qr.Spec.Justification == "" {
+		return nil, nil, "a justification is required"
+	}
+	if qr.Spec.Duration != nil && qr.Spec.Duration.Duration <= 0 {
+		return nil, nil, "duration must be positive"
+	}
+	requested := env.Spec.DeepCopy()
+	requested.Resources = qr.Spec.Resources
+	requested.Storage = qr.Spec.Storage
+	current := env.Spec.Quota()
+
+	var changes []string
+	raised := map[corev1.ResourceName]resource.Quantity{}
+	for key, value := range requested.Quota() {
+		if value == current[key] {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, nil, fmt.Sprintf("invalid %s %q: %v", key, value, err)
+		}
+		if old, err := resource.ParseQuantity(current[key]); err != nil || quantity.Cmp(old) > 0 {
+			raised[key] = quantity
+		}
+		changes = append(changes, fmt.Sprintf("%s %s -> %s", key, current[key], value))
+	}
+	if len(changes) == 0 {
+		return nil, nil, "the request doesn't change the quota of the Environment"
+	}
+	sort.Strings(changes)
+	return changes, raised, ""
+}
+
+// autoApproval tells whether the raised keys are within the auto-approval thresholds of the EnvironmentPolicy rules
+// of the Environment tier. Every rule with thresholds must allow them, and a raise requires at least one; lowering
+// the quota is always approved.
+func autoApproval(policies []onboardingv1alpha1.EnvironmentPolicy, env *onboardingv1alpha1.Environment, raised map[corev1.ResourceName]resource.Quantity) bool {
+	if len(raised) == 0 {
+		return true
+	}
+	configured := false
+	for _, policy := range policies {
+		for _, rule := range policy.Spec.Rules {
+			if (rule.Tier != "" && rule.Tier != env.Tier()) || len(rule.QuotaAutoApproval) == 0 {
+				continue
+			}
+			configured = true
+			for key, value := range raised {
+				if threshold, found := rule.QuotaAutoApproval[key]; !found || value.Cmp(threshold) > 0 {
+					return false
+				}
+			}
+		}
+	}
+	return configured
+}
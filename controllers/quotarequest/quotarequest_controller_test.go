@@ -0,0 +1,197 @@
+package quotarequest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	name        = "load-test"
+	envName     = "environment"
+	projectname = "project1"
+
+	namespace = &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   projectname,
+			Labels: map[string]string{onboardingv1alpha1.EnvironmentLabel: envName},
+		},
+	}
+
+	policy = &onboardingv1alpha1.EnvironmentPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: onboardingv1alpha1.EnvironmentPolicySpec{
+			Rules: []onboardingv1alpha1.EnvironmentPolicyRule{
+				{
+					QuotaAutoApproval: corev1.ResourceList{
+						"requests.cpu":    resource.MustParse("4"),
+						"requests.memory": resource.MustParse("8Gi"),
+					},
+				},
+			},
+		},
+	}
+)
+
+func newEnvironment() *onboardingv1alpha1.Environment {
+	env := &onboardingv1alpha1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: envName},
+		Spec: onboardingv1alpha1.EnvironmentSpec{
+			Name:    projectname,
+			Storage: "10Gi",
+		},
+	}
+	env.Spec.ResourceRequests = onboardingv1alpha1.ResourceDescription{CPU: "1", Memory: "2Gi", EphemeralStorage: "1Gi"}
+	env.Spec.ResourceLimits = onboardingv1alpha1.ResourceDescription{CPU: "2", Memory: "4Gi", EphemeralStorage: "2Gi"}
+	return env
+}
+
+func newQuotaRequest(cpu string, duration time.Duration, approvedBy string) *onboardingv1alpha1.QuotaRequest {
+	qr := &onboardingv1alpha1.QuotaRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: projectname},
+		Spec: onboardingv1alpha1.QuotaRequestSpec{
+			Resources:     newEnvironment().Spec.Resources,
+			Storage:       "10Gi",
+			Justification: "LOAD-42",
+			RequestedBy:   "user1",
+			Approved:      approvedBy != "",
+			ApprovedBy:    approvedBy,
+		},
+	}
+	qr.Spec.ResourceRequests.CPU = cpu
+	if duration != 0 {
+		qr.Spec.Duration = &metav1.Duration{Duration: duration}
+	}
+	return qr
+}
+
+func newTestReconciler(objs ...runtime.Object) *ReconcileQuotaRequest {
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, &onboardingv1alpha1.Environment{}, &onboardingv1alpha1.QuotaRequest{},
+		&onboardingv1alpha1.EnvironmentPolicy{}, &onboardingv1alpha1.EnvironmentPolicyList{})
+	objs = append(objs, namespace.DeepCopy(), policy.DeepCopy(), newEnvironment())
+	return &ReconcileQuotaRequest{client: fake.NewFakeClient(objs...), scheme: s, recorder: record.NewFakeRecorder(10)}
+}
+
+func reconcileQuotaRequest(t *testing.T, r *ReconcileQuotaRequest) (*onboardingv1alpha1.QuotaRequest, *onboardingv1alpha1.Environment) {
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: projectname}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	qr := &onboardingv1alpha1.QuotaRequest{}
+	if err := r.client.Get(context.TODO(), req.NamespacedName, qr); err != nil {
+		t.Fatalf("get quotarequest: (%v)", err)
+	}
+	env := &onboardingv1alpha1.Environment{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: envName}, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	return qr, env
+}
+
+func TestQuotaRequestAutoApprovedAndExpiry(t *testing.T) {
+	r := newTestReconciler(newQuotaRequest("3", time.Hour, ""))
+
+	qr, env := reconcileQuotaRequest(t, r)
+	if qr.Status.Phase != onboardingv1alpha1.QuotaRequestApplied || !qr.Status.AutoApproved {
+		t.Fatalf("expected an auto-approved %s request, got %s (%s)", onboardingv1alpha1.QuotaRequestApplied, qr.Status.Phase, qr.Status.Message)
+	}
+	if env.Spec.ResourceRequests.CPU != "3" {
+		t.Errorf("expected the Environment requests.cpu to be raised to 3, got %s", env.Spec.ResourceRequests.CPU)
+	}
+	if len(qr.Status.Changes) != 1 || qr.Status.Changes[0] != "requests.cpu 1 -> 3" || qr.Status.ExpiresAt == nil {
+		t.Errorf("unexpected status: %v", qr.Status)
+	}
+
+	// Move the expiry in the past
+	expired := metav1.NewTime(time.Now().Add(-time.Minute))
+	qr.Status.ExpiresAt = &expired
+	if err := r.client.Status().Update(context.TODO(), qr); err != nil {
+		t.Fatalf("update quotarequest: (%v)", err)
+	}
+	qr, env = reconcileQuotaRequest(t, r)
+	if qr.Status.Phase != onboardingv1alpha1.QuotaRequestExpired {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.QuotaRequestExpired, qr.Status.Phase)
+	}
+	if env.Spec.ResourceRequests.CPU != "1" {
+		t.Errorf("expected the Environment requests.cpu to be restored to 1, got %s", env.Spec.ResourceRequests.CPU)
+	}
+}
+
+func TestQuotaRequestWaitsForApproval(t *testing.T) {
+	r := newTestReconciler(newQuotaRequest("8", 0, ""))
+
+	qr, env := reconcileQuotaRequest(t, r)
+	if qr.Status.Phase != onboardingv1alpha1.QuotaRequestPending {
+		t.Fatalf("expected phase %s, got %s (%s)", onboardingv1alpha1.QuotaRequestPending, qr.Status.Phase, qr.Status.Message)
+	}
+	if env.Spec.ResourceRequests.CPU != "1" {
+		t.Errorf("Environment shouldn't be changed before the approval, got requests.cpu %s", env.Spec.ResourceRequests.CPU)
+	}
+
+	qr.Spec.Approved, qr.Spec.ApprovedBy = true, "approver1"
+	if err := r.client.Update(context.TODO(), qr); err != nil {
+		t.Fatalf("update quotarequest: (%v)", err)
+	}
+	qr, env = reconcileQuotaRequest(t, r)
+	if qr.Status.Phase != onboardingv1alpha1.QuotaRequestApplied || qr.Status.AutoApproved || qr.Status.ExpiresAt != nil {
+		t.Fatalf("expected an approved permanent %s request, got %v", onboardingv1alpha1.QuotaRequestApplied, qr.Status)
+	}
+	if env.Spec.ResourceRequests.CPU != "8" {
+		t.Errorf("expected the Environment requests.cpu to be raised to 8, got %s", env.Spec.ResourceRequests.CPU)
+	}
+}
+
+func TestQuotaRequestRejectsSelfApproval(t *testing.T) {
+	r := newTestReconciler(newQuotaRequest("8", 0, "user1"))
+
+	qr, env := reconcileQuotaRequest(t, r)
+	if qr.Status.Phase != onboardingv1alpha1.QuotaRequestRejected {
+		t.Fatalf("expected phase %s, got %s", onboardingv1alpha1.QuotaRequestRejected, qr.Status.Phase)
+	}
+	if env.Spec.ResourceRequests.CPU != "1" {
+		t.Errorf("Environment shouldn't be changed, got requests.cpu %s", env.Spec.ResourceRequests.CPU)
+	}
+}
+
+func TestQuotaRequestCompletesInterruptedApply(t *testing.T) {
+	// The Environment was updated, not the status of the request
+	qr := newQuotaRequest("3", time.Hour, "")
+	previous := newEnvironment().Spec.Resources
+	qr.Status = onboardingv1alpha1.QuotaRequestStatus{
+		Phase:             onboardingv1alpha1.QuotaRequestApplying,
+		Environment:       envName,
+		AutoApproved:      true,
+		PreviousResources: &previous,
+		PreviousStorage:   "10Gi",
+	}
+	r := newTestReconciler(qr)
+	env := &onboardingv1alpha1.Environment{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: envName}, env); err != nil {
+		t.Fatalf("get environment: (%v)", err)
+	}
+	env.Spec.ResourceRequests.CPU = "3"
+	if err := r.client.Update(context.TODO(), env); err != nil {
+		t.Fatalf("update environment: (%v)", err)
+	}
+
+	qr, env = reconcileQuotaRequest(t, r)
+	if qr.Status.Phase != onboardingv1alpha1.QuotaRequestApplied || qr.Status.ExpiresAt == nil {
+		t.Fatalf("expected a temporary %s request, got %v", onboardingv1alpha1.QuotaRequestApplied, qr.Status)
+	}
+	if env.Spec.ResourceRequests.CPU != "3" || qr.Status.PreviousResources == nil || qr.Status.PreviousResources.ResourceRequests.CPU != "1" {
+		t.Errorf("expected requests.cpu 3 and the previous 1 kept, got %s and %v", env.Spec.ResourceRequests.CPU, qr.Status.PreviousResources)
+	}
+}
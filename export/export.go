@@ -0,0 +1,172 @@
+package export
+
+import (
+	"bytes"
+	"context"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/objectmeta"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+)
+
+// ChildLists are the lists of the kinds of the objects an Environment controls in its Namespace, exported after
+// the Namespace in this order. The new child kinds of the Environment must be added here.
+var ChildLists = []func() runtime.Object{
+	func() runtime.Object { return &corev1.ResourceQuotaList{} },
+	func() runtime.Object { return &corev1.LimitRangeList{} },
+	func() runtime.Object { return &rbacv1.RoleBindingList{} },
+}
+
+// runtimeFields are the metadata fields set by the API server, left out of the bundle. The owner references are
+// left out too: they hold the UID of the owner, which differs in another cluster.
+var runtimeFields = []string{
+	"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp", "deletionGracePeriodSeconds",
+	"selfLink", "managedFields", "ownerReferences",
+}
+
+// strippedAnnotations are the annotations left out of the bundle: the kubectl one, and the approval of a
+// production Environment, whose generation differs in another cluster and which must be approved again there
+var strippedAnnotations = []string{
+	objectmeta.LastAppliedAnnotation,
+	onboardingv1alpha1.ApprovedGenerationAnnotation,
+	onboardingv1alpha1.ApprovedByAnnotation,
+}
+
+// Bundle returns the Environment of the name, its Namespace, the objects it controls in the Namespace and the
+// bootstrapped objects listed in its status as a multi-document YAML bundle that can be applied to another cluster.
+// The runtime fields and the status of the objects are stripped.
+func Bundle(ctx context.Context, c client.Reader, scheme *runtime.Scheme, name string) ([]byte, error) {
+	env := &onboardingv1alpha1.Environment{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, env); err != nil {
+		return nil, err
+	}
+	objects := []runtime.Object{env}
+
+	namespace := &corev1.Namespace{}
+	err := c.Get(ctx, types.NamespacedName{Name: env.Spec.Name}, namespace)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	} else if err == nil {
+		objects = append(objects, namespace)
+	}
+
+	exported := map[string]bool{}
+	for _, newList := range ChildLists {
+		list := newList()
+		if err := c.List(ctx, list, client.InNamespace(env.Spec.Name)); err != nil {
+			return nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				return nil, err
+			}
+			if owner := metav1.GetControllerOf(accessor); owner != nil && owner.UID == env.UID {
+				objects = append(objects, item)
+				key, err := exportKey(item, scheme)
+				if err != nil {
+					return nil, err
+				}
+				exported[key] = true
+			}
+		}
+	}
+
+	// The bootstrapped objects are of any kind, they are found from the bootstrap status
+	for _, status := range env.Status.Bootstrap {
+		if status.Kind == "" || status.State != onboardingv1alpha1.BootstrapApplied {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(status.APIVersion)
+		obj.SetKind(status.Kind)
+		err := c.Get(ctx, types.NamespacedName{Name: status.Name, Namespace: env.Spec.Name}, obj)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		} else if err != nil {
+			continue
+		}
+		key, err := exportKey(obj, scheme)
+		if err != nil {
+			return nil, err
+		}
+		if owner := metav1.GetControllerOf(obj); owner == nil || owner.UID != env.UID || exported[key] {
+			continue
+		}
+		objects = append(objects, obj)
+		exported[key] = true
+	}
+
+	var bundle bytes.Buffer
+	for _, obj := range objects {
+		document, err := Document(obj, scheme)
+		if err != nil {
+			return nil, err
+		}
+		bundle.WriteString("---\n")
+		bundle.Write(document)
+	}
+	return bundle.Bytes(), nil
+}
+
+// exportKey identifies an exported object of the Namespace by its group, kind and name, a bootstrapped object also
+// controlled as a child object being exported once
+func exportKey(obj runtime.Object, scheme *runtime.Scheme) (string, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return "", err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", err
+	}
+	return gvk.GroupKind().String() + "/" + accessor.GetName(), nil
+}
+
+// Document returns the object as a YAML document without its runtime fields nor its status
+func Document(obj runtime.Object, scheme *runtime.Scheme) ([]byte, error) {
+	cleaned, err := clean(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(cleaned)
+}
+
+// clean returns the object with its apiVersion and kind, without its runtime fields, stripped annotations nor its
+// status
+func clean(obj runtime.Object, scheme *runtime.Scheme) (map[string]interface{}, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	cleaned := &unstructured.Unstructured{Object: content}
+	cleaned.SetGroupVersionKind(gvk)
+	delete(cleaned.Object, "status")
+	for _, field := range runtimeFields {
+		unstructured.RemoveNestedField(cleaned.Object, "metadata", field)
+	}
+	for _, annotation := range strippedAnnotations {
+		unstructured.RemoveNestedField(cleaned.Object, "metadata", "annotations", annotation)
+	}
+	if len(cleaned.GetAnnotations()) == 0 {
+		unstructured.RemoveNestedField(cleaned.Object, "metadata", "annotations")
+	}
+	return cleaned.Object, nil
+}
@@ -0,0 +1,83 @@
+package export
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/objectmeta"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func TestBundle(t *testing.T) {
+	env := &onboardingv1alpha1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "payments", UID: "1234", Generation: 3,
+			Annotations: map[string]string{
+				objectmeta.LastAppliedAnnotation:                "{}",
+				onboardingv1alpha1.ApprovedGenerationAnnotation: "3",
+				onboardingv1alpha1.ApprovedByAnnotation:         "approver1",
+			}},
+		Spec: onboardingv1alpha1.EnvironmentSpec{Name: "payments", Storage: "10Gi"},
+		Status: onboardingv1alpha1.EnvironmentStatus{EnvironmentStatus: "Ready",
+			Bootstrap: []onboardingv1alpha1.BootstrapObjectStatus{
+				{Template: "defaults/config.yaml", APIVersion: "v1", Kind: "ConfigMap", Name: "defaults", State: onboardingv1alpha1.BootstrapApplied},
+				// Also a child object, exported once
+				{Template: "defaults/rbac.yaml", APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding", Name: "cno-admin", State: onboardingv1alpha1.BootstrapApplied},
+				// Not controlled by the Environment
+				{Template: "defaults/settings.yaml", APIVersion: "v1", Kind: "ConfigMap", Name: "settings", State: onboardingv1alpha1.BootstrapSkipped},
+				{Template: "defaults/missing.yaml", APIVersion: "v1", Kind: "ConfigMap", Name: "missing", State: onboardingv1alpha1.BootstrapApplied},
+			}},
+	}
+	owner := []metav1.OwnerReference{*metav1.NewControllerRef(env, onboardingv1alpha1.SchemeGroupVersion.WithKind("Environment"))}
+	objects := []runtime.Object{
+		env,
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "payments", OwnerReferences: owner, ResourceVersion: "42"},
+			Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+		},
+		&corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "cno-quota", Namespace: "payments", OwnerReferences: owner}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "cno-admin", Namespace: "payments", OwnerReferences: owner}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "payments", OwnerReferences: owner}},
+		// Not controlled by the Environment
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "cno-access-incident", Namespace: "payments"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "payments"}},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, env)
+	cl := fake.NewFakeClient(objects...)
+
+	bundle, err := Bundle(context.TODO(), cl, s, "payments")
+	if err != nil {
+		t.Fatalf("bundle: (%v)", err)
+	}
+	documents := strings.Split(strings.TrimPrefix(string(bundle), "---\n"), "---\n")
+	expected := []string{"Environment/payments", "Namespace/payments", "ResourceQuota/cno-quota", "RoleBinding/cno-admin", "ConfigMap/defaults"}
+	if len(documents) != len(expected) {
+		t.Fatalf("expected %v in the bundle, got:\n%s", expected, bundle)
+	}
+	for i, document := range documents {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(document), &obj.Object); err != nil {
+			t.Fatalf("unmarshal: (%v)", err)
+		}
+		if key := obj.GetKind() + "/" + obj.GetName(); key != expected[i] || obj.GetAPIVersion() == "" {
+			t.Errorf("expected %s, got %s %s", expected[i], obj.GetAPIVersion(), key)
+		}
+		if obj.GetUID() != "" || obj.GetResourceVersion() != "" || obj.GetGeneration() != 0 ||
+			len(obj.GetOwnerReferences()) != 0 || len(obj.GetAnnotations()) != 0 {
+			t.Errorf("%s runtime fields should be stripped, got:\n%s", expected[i], document)
+		}
+		if _, found := obj.Object["status"]; found {
+			t.Errorf("%s status should be stripped, got:\n%s", expected[i], document)
+		}
+	}
+}
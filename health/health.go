@@ -0,0 +1,115 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// LeaderCheck is the name of the readiness check passing once the Manager is elected leader, served on
+// /readyz/leader and excluded from the pod readiness probe with /readyz?exclude=leader
+const LeaderCheck = "leader"
+
+// AddToManager adds the liveness and readiness checks to the Manager. The Manager is live as long as it serves
+// the probes, and ready once its caches are synced and the API server is reachable. When server is not nil,
+// readiness also requires the webhook serving certificate. The leader check passes once the Manager is elected, it
+// is excluded from the pod readiness probe: the standby replicas serve the webhooks and must not block the rolling
+// updates.
+func AddToManager(mgr manager.Manager, cfg *rest.Config, server *webhook.Server) error {
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		return err
+	}
+
+	// The runnables are started by the Manager after the caches are synced, and after it is elected for the
+	// leader election one
+	synced := &startedCheck{}
+	if err := mgr.Add(synced); err != nil {
+		return err
+	}
+	elected := &startedCheck{needLeaderElection: true}
+	if err := mgr.Add(elected); err != nil {
+		return err
+	}
+	checks := map[string]healthz.Checker{
+		"cache-sync": synced.check("caches are not synced"),
+		LeaderCheck:  elected.check("not elected leader"),
+	}
+
+	apiServer, err := APIServerCheck(cfg)
+	if err != nil {
+		return err
+	}
+	checks["apiserver"] = apiServer
+	if server != nil {
+		checks["webhook-cert"] = WebhookCertCheck(server)
+	}
+
+	for name, check := range checks {
+		if err := mgr.AddReadyzCheck(name, check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// APIServerCheck returns a checker passing when the API server answers its version
+func APIServerCheck(cfg *rest.Config) (healthz.Checker, error) {
+	client, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func(_ *http.Request) error {
+		_, err := client.ServerVersion()
+		return err
+	}, nil
+}
+
+// WebhookCertCheck returns a checker passing when the serving certificate and key of the webhook server are present
+func WebhookCertCheck(server *webhook.Server) healthz.Checker {
+	return func(_ *http.Request) error {
+		for _, name := range []string{server.CertName, server.KeyName} {
+			path := filepath.Join(server.CertDir, name)
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("webhook certificate: %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// startedCheck is a Runnable recording that the Manager started it
+type startedCheck struct {
+	needLeaderElection bool
+	started            int32
+}
+
+// Start marks the runnable as started and blocks until the Manager stops
+func (s *startedCheck) Start(stop <-chan struct{}) error {
+	atomic.StoreInt32(&s.started, 1)
+	<-stop
+	return nil
+}
+
+// NeedLeaderElection tells whether the Manager only starts the runnable once elected
+func (s *startedCheck) NeedLeaderElection() bool {
+	return s.needLeaderElection
+}
+
+// check returns a checker failing with message until the runnable is started
+func (s *startedCheck) check(message string) healthz.Checker {
+	return func(_ *http.Request) error {
+		if atomic.LoadInt32(&s.started) == 0 {
+			return errors.New(message)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+package health
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func TestWebhookCertCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serving-certs")
+	if err != nil {
+		t.Fatalf("temp dir: (%v)", err)
+	}
+	defer os.RemoveAll(dir)
+	check := WebhookCertCheck(&webhook.Server{CertDir: dir, CertName: "tls.crt", KeyName: "tls.key"})
+
+	if err := check(nil); err == nil {
+		t.Errorf("check passed without certificate")
+	}
+	for _, name := range []string{"tls.crt", "tls.key"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("pem"), 0600); err != nil {
+			t.Fatalf("write %s: (%v)", name, err)
+		}
+	}
+	if err := check(nil); err != nil {
+		t.Errorf("check: (%v)", err)
+	}
+}
+
+func TestStartedCheck(t *testing.T) {
+	s := &startedCheck{needLeaderElection: true}
+	check := s.check("not elected leader")
+	if err := check(nil); err == nil {
+		t.Errorf("check passed before start")
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- s.Start(stop) }()
+	for i := 0; i < 100 && check(nil) != nil; i++ {
+		// Wait for the runnable to be started
+		<-time.After(10 * time.Millisecond)
+	}
+	if err := check(nil); err != nil {
+		t.Errorf("check after start: (%v)", err)
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("start: (%v)", err)
+	}
+}
@@ -8,37 +8,52 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/adoption"
 	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis"
+	configv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/config/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/capacity"
 	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/controller"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/controller/environment"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/controller/environmentpromotion"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/export"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/health"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/operatorconfig"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/sharding"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/tracing"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/webhook"
+	environmentwebhook "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/webhook/environment"
 	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/version"
 
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
 	kubemetrics "github.com/operator-framework/operator-sdk/pkg/kube-metrics"
-	"github.com/operator-framework/operator-sdk/pkg/leader"
 	"github.com/operator-framework/operator-sdk/pkg/log/zap"
 	"github.com/operator-framework/operator-sdk/pkg/metrics"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
 	"github.com/spf13/pflag"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	ctrlwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
-// Change below variables to serve metrics on different host or port.
-var (
-	metricsHost               = "0.0.0.0"
-	metricsPort         int32 = 8383
-	operatorMetricsPort int32 = 8686
-)
+// configReloadInterval is the interval between two reads of the operator configuration file
+const configReloadInterval = 30 * time.Second
+
+// capacityReportInterval is the interval between two cluster capacity reports
+const capacityReportInterval = 5 * time.Minute
+
 var log = logf.Log.WithName("cmd")
 
 func printVersion() {
@@ -57,6 +72,32 @@ func main() {
 	// controller-runtime)
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 
+	enableWebhooks := pflag.Bool("enable-webhooks", false, "Serve the admission webhooks, a serving certificate must be present in the webhook cert dir")
+	webhookCertDir := pflag.String("webhook-cert-dir", "", "Directory holding the tls.crt and tls.key of the webhook server")
+	pflag.StringSliceVar(&environmentwebhook.Approvers, "environment-approvers", nil, "Users, or groups prefixed with group:, allowed to approve production Environments")
+	auditFile := pflag.String("audit-file", "", "File the JSON audit stream of the Environment changes is appended to, the operator log when empty")
+	pflag.StringVar(&environment.QuotaAlertHook, "quota-alert-hook", "", "URL the Environment quota pressure changes and expiry warnings are posted to as JSON")
+	pflag.BoolVar(&environment.DryRun, "dry-run", false, "Plan the changes to the Environments in their status and events instead of applying them")
+	configFile := pflag.String("config", "", "OperatorConfig file, e.g. a mounted ConfigMap, reloaded when it changes")
+	metricsHost := pflag.String("metrics-host", "", "Host the metrics are served on, overrides the configuration file")
+	metricsPort := pflag.Int32("metrics-port", 0, "Port the operator metrics are served on, overrides the configuration file")
+	operatorMetricsPort := pflag.Int32("operator-metrics-port", 0, "Port the custom resource metrics are served on, overrides the configuration file")
+	healthProbePort := pflag.Int32("health-probe-port", 0, "Port the health probes are served on, overrides the configuration file")
+	webhookPort := pflag.Int32("webhook-port", 0, "Port the admission webhooks are served on, overrides the configuration file")
+	tracingEndpoint := pflag.String("tracing-endpoint", "", "host:port of the OTLP gRPC collector the traces are exported to, overrides the configuration file")
+	tracingInsecure := pflag.Bool("tracing-insecure", false, "Disable TLS on the connection to the OTLP collector, overrides the configuration file")
+	environmentSelector := pflag.String("environment-selector", "", "Label selector of the Environments reconciled by this operator instance")
+	shardCount := pflag.Uint32("shard-count", 0, "Number of operator instances the Environments are spread over by the hash of their name")
+	shardIndex := pflag.Uint32("shard-index", 0, "Index of this operator instance among the --shard-count ones, starting at 0")
+	leaderElect := pflag.Bool("leader-elect", true, "Run the controllers in the elected replica only, overrides the configuration file")
+	leaderElectionNamespace := pflag.String("leader-election-namespace", "", "Namespace of the leader election lock, required out of a cluster, overrides the configuration file")
+	leaseDuration := pflag.Duration("leader-election-lease-duration", 0, "Time the other replicas wait before taking over a lease that isn't renewed, overrides the configuration file")
+	renewDeadline := pflag.Duration("leader-election-renew-deadline", 0, "Time the leader retries renewing its lease before giving up, overrides the configuration file")
+	retryPeriod := pflag.Duration("leader-election-retry-period", 0, "Interval between the attempts to acquire or renew the lease, overrides the configuration file")
+	bootstrapNamespace := pflag.String("bootstrap-namespace", "", "Namespace of the bootstrap template ConfigMaps, overrides the configuration file")
+	exportEnvironment := pflag.String("export-environment", "", "Print the Environment of the name and its child objects as a YAML bundle, then exit")
+	importNamespace := pflag.String("import-namespace", "", "Print the Environment adopting the existing namespace of the name, built from its objects, then exit")
+
 	pflag.Parse()
 
 	// Use a zap logr.Logger implementation. If none of the zap
@@ -71,6 +112,96 @@ func main() {
 
 	printVersion()
 
+	if *auditFile != "" {
+		f, err := os.OpenFile(*auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Error(err, "Failed to open the audit file")
+			os.Exit(1)
+		}
+		defer f.Close()
+		environment.AuditWriter = f
+	}
+
+	// The flags given on the command line override the configuration file
+	override := func(c *configv1alpha1.OperatorConfig) {
+		if pflag.CommandLine.Changed("metrics-host") {
+			c.Server.MetricsHost = *metricsHost
+		}
+		if pflag.CommandLine.Changed("metrics-port") {
+			c.Server.MetricsPort = *metricsPort
+		}
+		if pflag.CommandLine.Changed("operator-metrics-port") {
+			c.Server.OperatorMetricsPort = *operatorMetricsPort
+		}
+		if pflag.CommandLine.Changed("health-probe-port") {
+			c.Server.HealthProbePort = *healthProbePort
+		}
+		if pflag.CommandLine.Changed("webhook-port") {
+			c.Server.WebhookPort = *webhookPort
+		}
+		if pflag.CommandLine.Changed("tracing-endpoint") {
+			c.Tracing.Endpoint = *tracingEndpoint
+		}
+		if pflag.CommandLine.Changed("tracing-insecure") {
+			c.Tracing.Insecure = *tracingInsecure
+		}
+		if pflag.CommandLine.Changed("leader-elect") {
+			c.LeaderElection.Enabled = leaderElect
+		}
+		if pflag.CommandLine.Changed("leader-election-namespace") {
+			c.LeaderElection.Namespace = *leaderElectionNamespace
+		}
+		if pflag.CommandLine.Changed("leader-election-lease-duration") {
+			c.LeaderElection.LeaseDuration.Duration = *leaseDuration
+		}
+		if pflag.CommandLine.Changed("leader-election-renew-deadline") {
+			c.LeaderElection.RenewDeadline.Duration = *renewDeadline
+		}
+		if pflag.CommandLine.Changed("leader-election-retry-period") {
+			c.LeaderElection.RetryPeriod.Duration = *retryPeriod
+		}
+		if pflag.CommandLine.Changed("bootstrap-namespace") {
+			c.Bootstrap.Namespace = *bootstrapNamespace
+		}
+		// The bootstrap templates and the capacity report are in the operator namespace by default, out of a
+		// cluster there is none
+		if operatorNs, err := k8sutil.GetOperatorNamespace(); err == nil {
+			if c.Bootstrap.Namespace == "" {
+				c.Bootstrap.Namespace = operatorNs
+			}
+			if c.Capacity.Namespace == "" {
+				c.Capacity.Namespace = operatorNs
+			}
+		}
+	}
+	operatorConfig := configv1alpha1.NewOperatorConfig()
+	var configWatcher *operatorconfig.Watcher
+	if *configFile != "" {
+		configWatcher = &operatorconfig.Watcher{Path: *configFile, Interval: configReloadInterval, Override: override}
+		loaded, err := configWatcher.Load()
+		if err != nil {
+			log.Error(err, "Failed to load the operator configuration")
+			os.Exit(1)
+		}
+		operatorConfig = loaded
+	} else {
+		override(operatorConfig)
+	}
+	if err := operatorConfig.Validate(); err != nil {
+		log.Error(err, "Invalid operator configuration")
+		os.Exit(1)
+	}
+	operatorconfig.Set(operatorConfig)
+
+	// Reconcile the Environments of the shard of this operator instance only
+	shard, err := sharding.New(*environmentSelector, *shardCount, *shardIndex)
+	if err != nil {
+		log.Error(err, "Invalid sharding")
+		os.Exit(1)
+	}
+	sharding.Current = shard
+	server := operatorConfig.Server
+
 	namespace, err := k8sutil.GetWatchNamespace()
 	if err != nil {
 		log.Error(err, "Failed to get watch namespace")
@@ -84,18 +215,57 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Export an Environment instead of running the operator
+	if *exportEnvironment != "" {
+		if err := exportBundle(cfg, *exportEnvironment); err != nil {
+			log.Error(err, "Failed to export the Environment", "Environment", *exportEnvironment)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Import a namespace instead of running the operator
+	if *importNamespace != "" {
+		if err := importEnvironment(cfg, *importNamespace); err != nil {
+			log.Error(err, "Failed to import the namespace", "Namespace", *importNamespace)
+			os.Exit(1)
+		}
+		return
+	}
+
 	ctx := context.TODO()
-	// Become the leader before proceeding
-	err = leader.Become(ctx, "onboarding-operator-kubernetes-lock")
+	// Export the traces when a collector is configured
+	shutdownTracing, err := tracing.Setup(ctx, "onboarding-operator-kubernetes", operatorConfig.Tracing.Endpoint, operatorConfig.Tracing.Insecure)
 	if err != nil {
-		log.Error(err, "")
+		log.Error(err, "Failed to set up the tracing")
 		os.Exit(1)
 	}
-
-	// Set default manager options
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error(err, "Failed to flush the traces")
+		}
+	}()
+
+	// Set default manager options. The controllers run in the replica holding the leader election lease, the
+	// others serve the webhooks and take over within a lease duration when the leader is gone.
+	election := operatorConfig.LeaderElection
+	if shard.Enabled() {
+		// Each shard elects its own leader
+		election.ID += "-" + shard.ID()
+		log.Info("Sharding the Environments", "Shard", shard.String())
+	}
 	options := manager.Options{
-		Namespace:          "",
-		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
+		Namespace:               "",
+		MetricsBindAddress:      fmt.Sprintf("%s:%d", server.MetricsHost, server.MetricsPort),
+		HealthProbeBindAddress:  fmt.Sprintf("%s:%d", server.MetricsHost, server.HealthProbePort),
+		Port:                    int(server.WebhookPort),
+		CertDir:                 *webhookCertDir,
+		LeaderElection:          *election.Enabled,
+		LeaderElectionID:        election.ID,
+		LeaderElectionNamespace: election.Namespace,
+		LeaseDuration:           &election.LeaseDuration.Duration,
+		RenewDeadline:           &election.RenewDeadline.Duration,
+		RetryPeriod:             &election.RetryPeriod.Duration,
 	}
 
 	// Add support for MultiNamespace set in WATCH_NAMESPACE (e.g ns1,ns2)
@@ -122,12 +292,56 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Setup all Controllers
-	if err := controller.AddToManager(mgr); err != nil {
+	// Setup all Controllers, the AccessRequests, QuotaRequests, EnvironmentRequests, production changes and
+	// production promotions are only checked by the webhooks
+	environment.ApprovalWebhook = *enableWebhooks
+	environmentpromotion.ApprovalWebhook = *enableWebhooks
+	environmentpromotion.Approvers = environmentwebhook.Approvers
+	if !*enableWebhooks {
+		log.Info("Webhooks disabled, the AccessRequests, QuotaRequests and EnvironmentRequests aren't reconciled and the production changes stay pending")
+	}
+	if err := controller.AddToManager(mgr, *enableWebhooks); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
+	// Setup all Webhooks
+	var webhookServer *ctrlwebhook.Server
+	if *enableWebhooks {
+		// The operator applies the approved QuotaRequests and EnvironmentRequests, the EnvironmentPolicies don't
+		// restrict it
+		if serviceAccount := os.Getenv("SERVICE_ACCOUNT"); serviceAccount != "" {
+			if operatorNs, err := k8sutil.GetOperatorNamespace(); err == nil {
+				environmentwebhook.OperatorUser = fmt.Sprintf("system:serviceaccount:%s:%s", operatorNs, serviceAccount)
+			}
+		}
+		if err := webhook.AddToManager(mgr); err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
+		webhookServer = mgr.GetWebhookServer()
+	}
+
+	// Setup the liveness and readiness probes
+	if err := health.AddToManager(mgr, cfg, webhookServer); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
+	// Publish the cluster capacity report
+	if err := mgr.Add(&capacity.Reporter{Client: mgr.GetClient(), Interval: capacityReportInterval}); err != nil {
 		log.Error(err, "")
 		os.Exit(1)
 	}
 
+	// Reload the configuration file when it changes
+	if configWatcher != nil {
+		if err := mgr.Add(configWatcher); err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
+	}
+
 	// Add the Metrics Service
 	addMetrics(ctx, cfg)
 
@@ -140,6 +354,50 @@ func main() {
 	}
 }
 
+// newClient returns a client of the Kubernetes and operator resources, for the commands run instead of the operator
+func newClient(cfg *rest.Config) (client.Client, error) {
+	if err := apis.AddToScheme(clientgoscheme.Scheme); err != nil {
+		return nil, err
+	}
+	return client.New(cfg, client.Options{Scheme: clientgoscheme.Scheme})
+}
+
+// exportBundle writes the YAML bundle of the Environment of the name and its child objects to the standard output
+func exportBundle(cfg *rest.Config, name string) error {
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	bundle, err := export.Bundle(context.TODO(), c, clientgoscheme.Scheme, name)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(bundle)
+	return err
+}
+
+// importEnvironment writes the Environment adopting the namespace of the name to the standard output, and logs
+// what isn't imported
+func importEnvironment(cfg *rest.Config, namespace string) error {
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	env, notes, err := adoption.Environment(context.TODO(), c, namespace)
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		log.Info(note, "Namespace", namespace)
+	}
+	document, err := export.Document(env, clientgoscheme.Scheme)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(document)
+	return err
+}
+
 // addMetrics will create the Services and Service Monitors to allow the operator export the metrics by using
 // the Prometheus operator
 func addMetrics(ctx context.Context, cfg *rest.Config) {
@@ -157,6 +415,7 @@ func addMetrics(ctx context.Context, cfg *rest.Config) {
 	}
 
 	// Add to the below struct any other metrics ports you want to expose.
+	metricsPort, operatorMetricsPort := operatorconfig.Get().Server.MetricsPort, operatorconfig.Get().Server.OperatorMetricsPort
 	servicePorts := []v1.ServicePort{
 		{Port: metricsPort, Name: metrics.OperatorPortName, Protocol: v1.ProtocolTCP, TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: metricsPort}},
 		{Port: operatorMetricsPort, Name: metrics.CRPortName, Protocol: v1.ProtocolTCP, TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: operatorMetricsPort}},
@@ -185,7 +444,7 @@ func addMetrics(ctx context.Context, cfg *rest.Config) {
 }
 
 // serveCRMetrics gets the Operator/CustomResource GVKs and generates metrics based on those types.
-// It serves those metrics on "http://metricsHost:operatorMetricsPort".
+// It serves those metrics on "http://metricsHost:operatorMetricsPort" of the operator configuration.
 func serveCRMetrics(cfg *rest.Config, operatorNs string) error {
 	// The function below returns a list of filtered operator/CR specific GVKs. For more control, override the GVK list below
 	// with your own custom logic. Note that if you are adding third party API schemas, probably you will need to
@@ -203,7 +462,8 @@ func serveCRMetrics(cfg *rest.Config, operatorNs string) error {
 	}
 
 	// Generate and serve custom resource specific metrics.
-	err = kubemetrics.GenerateAndServeCRMetrics(cfg, ns, filteredGVK, metricsHost, operatorMetricsPort)
+	server := operatorconfig.Get().Server
+	err = kubemetrics.GenerateAndServeCRMetrics(cfg, ns, filteredGVK, server.MetricsHost, server.OperatorMetricsPort)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,26 @@
+package objectmeta
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LastAppliedAnnotation is the kubectl annotation holding the last applied configuration of an object, left out of
+// the copies of the objects
+const LastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Copy returns the metadata of the copy of an object in the namespace: its name, labels and annotations, without
+// the runtime fields and the LastAppliedAnnotation
+func Copy(source metav1.ObjectMeta, namespace string) metav1.ObjectMeta {
+	annotations := map[string]string{}
+	for key, value := range source.Annotations {
+		if key != LastAppliedAnnotation {
+			annotations[key] = value
+		}
+	}
+	return metav1.ObjectMeta{
+		Name:        source.Name,
+		Namespace:   namespace,
+		Labels:      source.Labels,
+		Annotations: annotations,
+	}
+}
@@ -0,0 +1,28 @@
+package objectmeta
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCopy(t *testing.T) {
+	source := metav1.ObjectMeta{
+		Name:            "settings",
+		Namespace:       "project1",
+		UID:             "uid",
+		ResourceVersion: "42",
+		Labels:          map[string]string{"app": "api"},
+		Annotations:     map[string]string{LastAppliedAnnotation: "{}", "team": "a"},
+	}
+	expected := metav1.ObjectMeta{
+		Name:        "settings",
+		Namespace:   "project2",
+		Labels:      map[string]string{"app": "api"},
+		Annotations: map[string]string{"team": "a"},
+	}
+	if copied := Copy(source, "project2"); !reflect.DeepEqual(copied, expected) {
+		t.Errorf("Copy: (%+v) expected (%+v)", copied, expected)
+	}
+}
@@ -0,0 +1,147 @@
+package operatorconfig
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	configv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/config/v1alpha1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+var log = logf.Log.WithName("operatorconfig")
+
+// current holds the *configv1alpha1.OperatorConfig in use
+var current atomic.Value
+
+var (
+	reloadMu sync.Mutex
+	// reloadFuncs are called after a configuration reload
+	reloadFuncs []func()
+)
+
+func init() {
+	current.Store(configv1alpha1.NewOperatorConfig())
+}
+
+// Get returns the configuration in use, the defaults until a file is loaded. It must not be modified.
+func Get() *configv1alpha1.OperatorConfig {
+	return current.Load().(*configv1alpha1.OperatorConfig)
+}
+
+// Set replaces the configuration in use
+func Set(cfg *configv1alpha1.OperatorConfig) {
+	current.Store(cfg)
+}
+
+// OnReload registers a function called after the Watcher applies a new configuration
+func OnReload(f func()) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadFuncs = append(reloadFuncs, f)
+}
+
+// parse decodes and validates the configuration, unknown fields are rejected
+func parse(data []byte) (*configv1alpha1.OperatorConfig, error) {
+	cfg := &configv1alpha1.OperatorConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+	cfg.Default()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Watcher reloads the configuration file when its content changes. It polls the file rather than watching it, a
+// mounted ConfigMap being updated through a symlink swap.
+type Watcher struct {
+	// Path of the configuration file
+	Path string
+	// Interval between two reads of the file
+	Interval time.Duration
+	// Override is applied to every loaded configuration, e.g. to set the values given by flags
+	Override func(*configv1alpha1.OperatorConfig)
+
+	last []byte
+}
+
+// Start polls the configuration file until stop is closed
+func (w *Watcher) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			w.reload()
+		}
+	}
+}
+
+// Load reads the configuration file, sets the defaults of its empty fields and applies Override. The content is
+// recorded to detect its next changes.
+func (w *Watcher) Load() (*configv1alpha1.OperatorConfig, error) {
+	data, err := ioutil.ReadFile(w.Path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if w.Override != nil {
+		w.Override(cfg)
+	}
+	w.last = data
+	return cfg, nil
+}
+
+// NeedLeaderElection returns false, every replica keeps its configuration up to date
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// reload applies the configuration file when it changed. The changes requiring a restart are logged and left out.
+func (w *Watcher) reload() {
+	data, err := ioutil.ReadFile(w.Path)
+	if err != nil {
+		log.Error(err, "Failed to read the configuration", "Path", w.Path)
+		return
+	}
+	if bytes.Equal(data, w.last) {
+		return
+	}
+	w.last = data
+
+	cfg, err := parse(data)
+	if err != nil {
+		log.Error(err, "Invalid configuration, the previous one is kept", "Path", w.Path)
+		return
+	}
+	if w.Override != nil {
+		w.Override(cfg)
+	}
+	old := Get()
+	if fields := old.RestartRequired(cfg); len(fields) > 0 {
+		log.Info("Configuration changes require a restart", "Fields", fields)
+		cfg.Server = old.Server
+		cfg.ClusterRoles = old.ClusterRoles
+		cfg.ObjectNames = old.ObjectNames
+		cfg.Tracing = old.Tracing
+		cfg.LeaderElection = old.LeaderElection
+	}
+	Set(cfg)
+	log.Info("Configuration reloaded", "Path", w.Path)
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	for _, f := range reloadFuncs {
+		f()
+	}
+}
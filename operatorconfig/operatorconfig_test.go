@@ -0,0 +1,117 @@
+package operatorconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	configv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/config/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const config = `apiVersion: config.onboarding.beopenit.com/v1alpha1
+kind: OperatorConfig
+server:
+  metricsPort: 9383
+clusterRoles:
+  admin: team-admin
+limitRange:
+  default:
+    cpu: "1"
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := parse([]byte(config))
+	if err != nil {
+		t.Fatalf("parse: (%v)", err)
+	}
+	if cfg.Server.MetricsPort != 9383 || cfg.Server.WebhookPort != 9443 {
+		t.Errorf("server: (%v)", cfg.Server)
+	}
+	if cfg.ClusterRoles.Admin != "team-admin" || cfg.ClusterRoles.Viewer != "cno-viewer-cluster-role" {
+		t.Errorf("clusterRoles: (%v)", cfg.ClusterRoles)
+	}
+	if cpu := cfg.LimitRange.Default["cpu"]; cpu.Cmp(resource.MustParse("1")) != 0 {
+		t.Errorf("limitRange default cpu: (%v)", cpu.String())
+	}
+	if election := cfg.LeaderElection; !*election.Enabled || election.LeaseDuration.Duration != 15*time.Second {
+		t.Errorf("leaderElection: (%v)", election)
+	}
+
+	for _, invalid := range []string{
+		"apiVersion: config.onboarding.beopenit.com/v2\nkind: OperatorConfig\n",
+		config + "unknown: field\n",
+		config + "  defaultRequest:\n    cpu: \"2\"\n",
+		config + "leaderElection:\n  leaseDuration: 5s\n",
+		config + "capacity:\n  overcommitRatio:\n    cpu: \"0\"\n",
+	} {
+		if _, err := parse([]byte(invalid)); err == nil {
+			t.Errorf("parse accepted %q", invalid)
+		}
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	defer Set(configv1alpha1.NewOperatorConfig())
+	dir, err := ioutil.TempDir("", "operatorconfig")
+	if err != nil {
+		t.Fatalf("temp dir: (%v)", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("write config: (%v)", err)
+	}
+
+	w := &Watcher{Path: path, Override: func(c *configv1alpha1.OperatorConfig) { c.Server.HealthProbePort = 9081 }}
+	cfg, err := w.Load()
+	if err != nil {
+		t.Fatalf("load: (%v)", err)
+	}
+	Set(cfg)
+	reloaded := 0
+	OnReload(func() { reloaded++ })
+
+	// The unchanged file isn't reloaded
+	w.reload()
+	if reloaded != 0 {
+		t.Errorf("reloaded unchanged file")
+	}
+
+	// The LimitRange defaults are applied, the cluster roles and the flag overrides are kept
+	changed := `apiVersion: config.onboarding.beopenit.com/v1alpha1
+kind: OperatorConfig
+clusterRoles:
+  admin: other-admin
+limitRange:
+  default:
+    cpu: "1"
+  defaultRequest:
+    cpu: 200m
+`
+	if err := ioutil.WriteFile(path, []byte(changed), 0600); err != nil {
+		t.Fatalf("write config: (%v)", err)
+	}
+	w.reload()
+	if reloaded != 1 {
+		t.Fatalf("reloads: (%d)", reloaded)
+	}
+	if cpu := Get().LimitRange.DefaultRequest["cpu"]; cpu.Cmp(resource.MustParse("200m")) != 0 {
+		t.Errorf("limitRange default request cpu: (%v)", cpu.String())
+	}
+	if Get().ClusterRoles.Admin != "team-admin" || Get().Server.MetricsPort != 9383 || Get().Server.HealthProbePort != 9081 {
+		t.Errorf("restart-required fields changed: (%v) (%v)", Get().ClusterRoles, Get().Server)
+	}
+
+	// An invalid file keeps the configuration
+	if err := ioutil.WriteFile(path, []byte("kind: Unknown\n"), 0600); err != nil {
+		t.Fatalf("write config: (%v)", err)
+	}
+	w.reload()
+	if reloaded != 1 || Get().ClusterRoles.Admin != "team-admin" {
+		t.Errorf("invalid configuration applied")
+	}
+}
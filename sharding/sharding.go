@@ -0,0 +1,163 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+var log = logf.Log.WithName("sharding")
+
+// Current is the shard of this operator instance, every Environment by default.
+// It is set from the manager flags before the controllers are added.
+var Current Shard
+
+// Shard selects the Environments reconciled by an operator instance: the Environments matching its label selector
+// and, when the Environments are spread over Count shards by the hash of their name, falling in shard Index
+type Shard struct {
+	// Selector of the Environment labels, nil selects every Environment
+	Selector labels.Selector
+	// Count of the hash shards and Index of this one, starting at 0. Hash sharding is off when Count is below 2.
+	Count uint32
+	Index uint32
+}
+
+// New returns the shard of the selector, in the label selector syntax, and of the hash shard index of count
+func New(selector string, count, index uint32) (Shard, error) {
+	s := Shard{Count: count, Index: index}
+	if selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return s, fmt.Errorf("invalid environment selector %q: %v", selector, err)
+		}
+		s.Selector = parsed
+	}
+	if count > 1 && index >= count {
+		return s, fmt.Errorf("shard index %d is not below the shard count %d", index, count)
+	}
+	return s, nil
+}
+
+// Enabled tells whether the shard doesn't select every Environment
+func (s Shard) Enabled() bool {
+	return (s.Selector != nil && !s.Selector.Empty()) || s.Count > 1
+}
+
+// String describes the shard for the Environment status, e.g. "tier=prod, 1/4", empty when sharding is off
+func (s Shard) String() string {
+	var parts []string
+	if s.Selector != nil && !s.Selector.Empty() {
+		parts = append(parts, s.Selector.String())
+	}
+	if s.Count > 1 {
+		parts = append(parts, fmt.Sprintf("%d/%d", s.Index, s.Count))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ID returns a short identifier of the shard, usable in object names, empty when sharding is off
+func (s Shard) ID() string {
+	if !s.Enabled() {
+		return ""
+	}
+	return fmt.Sprintf("shard-%08x", hash(s.String()))
+}
+
+// Owns tells whether the Environment of the name and labels belongs to the shard
+func (s Shard) Owns(env metav1.Object) bool {
+	if s.Selector != nil && !s.Selector.Matches(labels.Set(env.GetLabels())) {
+		return false
+	}
+	return s.Count < 2 || hash(env.GetName())%s.Count == s.Index
+}
+
+// OwnsEnvironment tells whether the Environment of the name belongs to the shard. A missing Environment has no
+// label, so that it belongs to a single shard of complementary selectors.
+func (s Shard) OwnsEnvironment(ctx context.Context, c client.Reader, name string) (bool, error) {
+	if !s.Enabled() {
+		return true, nil
+	}
+	env := &onboardingv1alpha1.Environment{}
+	err := c.Get(ctx, types.NamespacedName{Name: name}, env)
+	if errors.IsNotFound(err) {
+		env.Name = name
+	} else if err != nil {
+		return false, err
+	}
+	return s.Owns(env), nil
+}
+
+// EnvironmentPredicate filters the events of the Environments belonging to the shard
+func (s Shard) EnvironmentPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return s.Owns(e.Meta) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return s.Owns(e.Meta) },
+		UpdateFunc:  func(e event.UpdateEvent) bool { return s.Owns(e.MetaNew) },
+		GenericFunc: func(e event.GenericEvent) bool { return s.Owns(e.Meta) },
+	}
+}
+
+// EnteringPredicate filters the updates of the Environments relabelled into the shard
+func (s Shard) EnteringPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		UpdateFunc:  func(e event.UpdateEvent) bool { return !s.Owns(e.MetaOld) && s.Owns(e.MetaNew) },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// RelatedPredicate filters the events of the objects related to an Environment belonging to the shard.
+// environmentOf returns the name of the Environment of an object, the objects without one pass.
+func (s Shard) RelatedPredicate(c client.Reader, environmentOf func(metav1.Object, runtime.Object) (string, error)) predicate.Predicate {
+	owns := func(meta metav1.Object, obj runtime.Object) bool {
+		if !s.Enabled() {
+			return true
+		}
+		name, err := environmentOf(meta, obj)
+		if err == nil && name != "" {
+			var owned bool
+			if owned, err = s.OwnsEnvironment(context.TODO(), c, name); err == nil {
+				return owned
+			}
+		}
+		if err != nil {
+			// The reconciler checks the shard again
+			log.Error(err, "Failed to find the Environment of an object", "Name", meta.GetName(), "Namespace", meta.GetNamespace())
+		}
+		return true
+	}
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return owns(e.Meta, e.Object) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return owns(e.Meta, e.Object) },
+		UpdateFunc:  func(e event.UpdateEvent) bool { return owns(e.MetaNew, e.ObjectNew) },
+		GenericFunc: func(e event.GenericEvent) bool { return owns(e.Meta, e.Object) },
+	}
+}
+
+// ControllerEnvironment returns the name of the Environment controlling the object, for RelatedPredicate
+func ControllerEnvironment(meta metav1.Object, _ runtime.Object) (string, error) {
+	if owner := metav1.GetControllerOf(meta); owner != nil && owner.Kind == "Environment" {
+		return owner.Name, nil
+	}
+	return "", nil
+}
+
+// hash returns the FNV-1a hash of the value
+func hash(value string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return h.Sum32()
+}
@@ -0,0 +1,77 @@
+package sharding
+
+import (
+	"context"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestShardOwns(t *testing.T) {
+	prod := &onboardingv1alpha1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "payments", Labels: map[string]string{"tier": "prod"}}}
+	dev := &onboardingv1alpha1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "sandbox"}}
+
+	prodShard, err := New("tier=prod", 0, 0)
+	if err != nil {
+		t.Fatalf("new shard: (%v)", err)
+	}
+	otherShard, err := New("tier!=prod", 0, 0)
+	if err != nil {
+		t.Fatalf("new shard: (%v)", err)
+	}
+	if !prodShard.Owns(prod) || prodShard.Owns(dev) || otherShard.Owns(prod) || !otherShard.Owns(dev) {
+		t.Errorf("selector shards don't split the Environments")
+	}
+
+	// Every Environment belongs to exactly one hash shard
+	for _, env := range []*onboardingv1alpha1.Environment{prod, dev} {
+		owners := 0
+		for index := uint32(0); index < 3; index++ {
+			if (Shard{Count: 3, Index: index}).Owns(env) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Errorf("hash shards owning %s: (%d)", env.Name, owners)
+		}
+	}
+
+	if (Shard{}).Enabled() || !(Shard{}).Owns(prod) {
+		t.Errorf("the default shard doesn't own every Environment")
+	}
+	if s := (Shard{Selector: prodShard.Selector, Count: 4, Index: 1}); s.String() != "tier=prod, 1/4" {
+		t.Errorf("shard description: (%v)", s.String())
+	}
+	for _, invalid := range []struct {
+		selector     string
+		count, index uint32
+	}{{"tier in (", 0, 0}, {"", 2, 2}} {
+		if _, err := New(invalid.selector, invalid.count, invalid.index); err == nil {
+			t.Errorf("New accepted %v", invalid)
+		}
+	}
+}
+
+func TestOwnsEnvironment(t *testing.T) {
+	prod := &onboardingv1alpha1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "payments", Labels: map[string]string{"tier": "prod"}}}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, prod)
+	cl := fake.NewFakeClient(prod)
+	prodShard, _ := New("tier=prod", 0, 0)
+	otherShard, _ := New("tier!=prod", 0, 0)
+
+	if owned, err := prodShard.OwnsEnvironment(context.TODO(), cl, "payments"); err != nil || !owned {
+		t.Errorf("prod shard owns payments: (%v, %v)", owned, err)
+	}
+	// A missing Environment has no label
+	if owned, err := prodShard.OwnsEnvironment(context.TODO(), cl, "missing"); err != nil || owned {
+		t.Errorf("prod shard owns missing: (%v, %v)", owned, err)
+	}
+	if owned, err := otherShard.OwnsEnvironment(context.TODO(), cl, "missing"); err != nil || !owned {
+		t.Errorf("other shard owns missing: (%v, %v)", owned, err)
+	}
+}
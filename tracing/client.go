@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// WrapClient returns a client recording a span for each API call, child of the span of the call context
+func WrapClient(c client.Client, scheme *runtime.Scheme) client.Client {
+	return &tracingClient{Client: c, scheme: scheme}
+}
+
+type tracingClient struct {
+	client.Client
+	scheme *runtime.Scheme
+}
+
+// start starts the span of the verb call on obj
+func (c *tracingClient) start(ctx context.Context, verb string, obj runtime.Object, name string) (context.Context, func(error)) {
+	kind := "Unknown"
+	if gvk, err := apiutil.GVKForObject(obj, c.scheme); err == nil {
+		kind = gvk.Kind
+	}
+	ctx, span := Start(ctx, verb+" "+kind, KindKey.String(kind), NameKey.String(name))
+	return ctx, func(err error) {
+		if errors.IsNotFound(err) {
+			// Not finding the object is an expected result, e.g. before creating it
+			span.SetAttributes(ResultKey.String("notfound"))
+			span.End()
+			return
+		}
+		End(span, err)
+	}
+}
+
+// nameOf returns the name of obj, empty for a list
+func nameOf(obj runtime.Object) string {
+	if accessor, ok := obj.(interface{ GetName() string }); ok {
+		return accessor.GetName()
+	}
+	return ""
+}
+
+func (c *tracingClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	ctx, end := c.start(ctx, "Get", obj, key.Name)
+	err := c.Client.Get(ctx, key, obj)
+	end(err)
+	return err
+}
+
+func (c *tracingClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	ctx, end := c.start(ctx, "List", list, "")
+	err := c.Client.List(ctx, list, opts...)
+	end(err)
+	return err
+}
+
+func (c *tracingClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	ctx, end := c.start(ctx, "Create", obj, nameOf(obj))
+	err := c.Client.Create(ctx, obj, opts...)
+	end(err)
+	return err
+}
+
+func (c *tracingClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	ctx, end := c.start(ctx, "Update", obj, nameOf(obj))
+	err := c.Client.Update(ctx, obj, opts...)
+	end(err)
+	return err
+}
+
+func (c *tracingClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	ctx, end := c.start(ctx, "Patch", obj, nameOf(obj))
+	err := c.Client.Patch(ctx, obj, patch, opts...)
+	end(err)
+	return err
+}
+
+func (c *tracingClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	ctx, end := c.start(ctx, "Delete", obj, nameOf(obj))
+	err := c.Client.Delete(ctx, obj, opts...)
+	end(err)
+	return err
+}
+
+func (c *tracingClient) DeleteAllOf(ctx context.Context, obj runtime.Object, opts ...client.DeleteAllOfOption) error {
+	ctx, end := c.start(ctx, "DeleteAllOf", obj, "")
+	err := c.Client.DeleteAllOf(ctx, obj, opts...)
+	end(err)
+	return err
+}
+
+func (c *tracingClient) Status() client.StatusWriter {
+	return &tracingStatusWriter{StatusWriter: c.Client.Status(), client: c}
+}
+
+type tracingStatusWriter struct {
+	client.StatusWriter
+	client *tracingClient
+}
+
+func (w *tracingStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	ctx, end := w.client.start(ctx, "UpdateStatus", obj, nameOf(obj))
+	err := w.StatusWriter.Update(ctx, obj, opts...)
+	end(err)
+	return err
+}
+
+func (w *tracingStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	ctx, end := w.client.start(ctx, "PatchStatus", obj, nameOf(obj))
+	err := w.StatusWriter.Patch(ctx, obj, patch, opts...)
+	end(err)
+	return err
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the operator
+const instrumentationName = "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes"
+
+// Attributes of the operator spans
+const (
+	EnvironmentKey = attribute.Key("onboarding.environment")
+	NamespaceKey   = attribute.Key("onboarding.namespace")
+	ResultKey      = attribute.Key("onboarding.result")
+	KindKey        = attribute.Key("k8s.kind")
+	NameKey        = attribute.Key("k8s.name")
+)
+
+// Setup exports the spans to the OTLP gRPC collector at endpoint and returns the function flushing and stopping
+// the export. Tracing stays off, with no-op spans, when endpoint is empty.
+func Setup(ctx context.Context, serviceName, endpoint string, insecure bool) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	options := []otlpgrpc.Option{otlpgrpc.WithEndpoint(endpoint)}
+	if insecure {
+		options = append(options, otlpgrpc.WithInsecure())
+	}
+	exporter, err := otlp.NewExporter(ctx, otlpgrpc.NewDriver(options...))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewWithAttributes(semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span of the operator tracer, child of the span of ctx
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// SetAttributes sets attributes on the span of ctx
+func SetAttributes(ctx context.Context, attributes ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attributes...)
+}
+
+// End sets the result of the span from err and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(ResultKey.String("error"))
+	} else {
+		span.SetAttributes(ResultKey.String("success"))
+	}
+	span.End()
+}
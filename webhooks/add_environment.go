@@ -0,0 +1,10 @@
+package webhook
+
+import (
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/webhook/environment"
+)
+
+func init() {
+	// AddToManagerFuncs is a list of functions to create webhooks and add them to a manager.
+	AddToManagerFuncs = append(AddToManagerFuncs, environment.Add)
+}
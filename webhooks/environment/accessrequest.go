@@ -0,0 +1,97 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// AccessRequestValidatePath is the path the AccessRequest validating webhook is served on
+const AccessRequestValidatePath = "/validate-onboarding-beopenit-com-v1alpha1-accessrequest"
+
+// accessRequestValidator checks that the approval of an AccessRequest is recorded by an approver of its Environment
+type accessRequestValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+// blank assignment to verify that accessRequestValidator implements admission.DecoderInjector
+var _ admission.DecoderInjector = &accessRequestValidator{}
+
+// InjectDecoder injects the decoder
+func (v *accessRequestValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle admits the AccessRequest created without approval, and the approval of an existing request by an approver
+// of its Environment
+func (v *accessRequestValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ar := &onboardingv1alpha1.AccessRequest{}
+	if err := v.decoder.Decode(req, ar); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *onboardingv1alpha1.AccessRequest
+	var approvers []string
+	if req.Operation == admissionv1beta1.Update {
+		old = &onboardingv1alpha1.AccessRequest{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		env := &onboardingv1alpha1.Environment{}
+		err := v.client.Get(ctx, types.NamespacedName{Name: ar.Spec.Environment}, env)
+		if err != nil && client.IgnoreNotFound(err) != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		approvers = env.Spec.Approvers
+	}
+	if reason := validateAccessRequest(old, ar, approvers, req.UserInfo); reason != "" {
+		log.Info("Denied AccessRequest change", "AccessRequest Name", ar.Name, "User", req.UserInfo.Username, "Reason", reason)
+		return admission.Denied(reason)
+	}
+	return admission.Allowed("")
+}
+
+// validateAccessRequest returns the reason why the user can't create the request, or update old into ar, or an
+// empty string. old is nil on creation. Only the approval of a request can be changed, by an approver of its
+// Environment who isn't the requested user.
+func validateAccessRequest(old, ar *onboardingv1alpha1.AccessRequest, approvers []string, userInfo authenticationv1.UserInfo) string {
+	if old == nil {
+		if ar.Spec.Approved || ar.Spec.ApprovedBy != "" {
+			return "an AccessRequest can't be approved at its creation"
+		}
+		return ""
+	}
+
+	oldSpec, spec := old.Spec, ar.Spec
+	oldSpec.Approved, oldSpec.ApprovedBy = false, ""
+	spec.Approved, spec.ApprovedBy = false, ""
+	if !equality.Semantic.DeepEqual(oldSpec, spec) {
+		return "only the approval of an AccessRequest can be changed"
+	}
+	if old.Spec.Approved == ar.Spec.Approved && old.Spec.ApprovedBy == ar.Spec.ApprovedBy {
+		return ""
+	}
+	if !ar.Spec.Approved && ar.Spec.ApprovedBy == "" {
+		// Withdrawing an approval is always allowed
+		return ""
+	}
+	if ar.Spec.ApprovedBy != userInfo.Username {
+		return fmt.Sprintf("spec.approvedBy must be set to the approving user %s", userInfo.Username)
+	}
+	if userInfo.Username == ar.Spec.Username {
+		return "an AccessRequest can't be approved by its requester"
+	}
+	if !matchesUser(userInfo, approvers) {
+		return fmt.Sprintf("%s is not allowed to approve AccessRequest %s", userInfo.Username, ar.Name)
+	}
+	return ""
+}
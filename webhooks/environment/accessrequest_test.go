@@ -0,0 +1,57 @@
+package environment
+
+import (
+	"testing"
+	"time"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newAccessRequest(role, approvedBy string) *onboardingv1alpha1.AccessRequest {
+	return &onboardingv1alpha1.AccessRequest{
+		Spec: onboardingv1alpha1.AccessRequestSpec{
+			Environment:   "environment",
+			Username:      "user1",
+			Role:          role,
+			Duration:      metav1.Duration{Duration: time.Hour},
+			Justification: "incident INC-42",
+			Approved:      approvedBy != "",
+			ApprovedBy:    approvedBy,
+		},
+	}
+}
+
+func TestValidateAccessRequest(t *testing.T) {
+	approvers := []string{"approver1"}
+	pending := newAccessRequest("dev", "")
+	user1 := authenticationv1.UserInfo{Username: "user1"}
+	approver1 := authenticationv1.UserInfo{Username: "approver1"}
+
+	tests := []struct {
+		name      string
+		old       *onboardingv1alpha1.AccessRequest
+		ar        *onboardingv1alpha1.AccessRequest
+		userInfo  authenticationv1.UserInfo
+		approvers []string
+		allowed   bool
+	}{
+		{"requester creates", nil, newAccessRequest("dev", ""), user1, nil, true},
+		{"created approved", nil, newAccessRequest("dev", "approver1"), user1, nil, false},
+		{"environment approver approves", pending, newAccessRequest("dev", "approver1"), approver1, approvers, true},
+		{"approved on behalf of an approver", pending, newAccessRequest("dev", "approver1"), authenticationv1.UserInfo{Username: "bob"}, approvers, false},
+		{"not an approver", pending, newAccessRequest("dev", "bob"), authenticationv1.UserInfo{Username: "bob"}, approvers, false},
+		{"environment without approvers", pending, newAccessRequest("dev", "bob"), authenticationv1.UserInfo{Username: "bob"}, nil, false},
+		{"requester approves", pending, newAccessRequest("dev", "user1"), user1, []string{"user1"}, false},
+		{"requested role changed", pending, newAccessRequest("admin", ""), user1, approvers, false},
+		{"approval withdrawn", newAccessRequest("dev", "approver1"), pending, user1, approvers, true},
+	}
+	for _, test := range tests {
+		reason := validateAccessRequest(test.old, test.ar, test.approvers, test.userInfo)
+		if allowed := reason == ""; allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", test.name, test.allowed, reason)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package environment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// DefaultPath is the path the Environment mutating webhook is served on
+const DefaultPath = "/mutate-onboarding-beopenit-com-v1alpha1-environment"
+
+// cloneDefaulter copies the spec defaults of the source Environment into a new Environment cloned from it
+type cloneDefaulter struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+// blank assignment to verify that cloneDefaulter implements admission.DecoderInjector
+var _ admission.DecoderInjector = &cloneDefaulter{}
+
+// InjectDecoder injects the decoder
+func (d *cloneDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// Handle fills the empty spec fields of a new Environment from the Environment it is cloned from, and denies it
+// when the source Environment doesn't exist
+func (d *cloneDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	env := &onboardingv1alpha1.Environment{}
+	if err := d.decoder.Decode(req, env); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if env.Spec.CloneFrom == nil {
+		return admission.Allowed("")
+	}
+	if env.Spec.CloneFrom.Environment == env.Name {
+		return admission.Denied(fmt.Sprintf("Environment %s can't be cloned from itself", env.Name))
+	}
+
+	source := &onboardingv1alpha1.Environment{}
+	err := d.client.Get(ctx, types.NamespacedName{Name: env.Spec.CloneFrom.Environment}, source)
+	if errors.IsNotFound(err) {
+		return admission.Denied(fmt.Sprintf("Environment %s to clone from not found", env.Spec.CloneFrom.Environment))
+	} else if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	cloneSpec(&env.Spec, &source.Spec)
+
+	marshaled, err := json.Marshal(env)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	log.Info("Cloned Environment spec", "Environment Name", env.Name, "Source", source.Name)
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// cloneSpec copies the fields of the source spec into the empty fields of the spec. The users are only copied
+// when asked for, and neither the Namespace name, the production flag nor the approvers are ever copied.
+func cloneSpec(spec, source *onboardingv1alpha1.EnvironmentSpec) {
+	if spec.Resources == (onboardingv1alpha1.Resources{}) {
+		spec.Resources = source.Resources
+	}
+	if spec.Storage == "" {
+		spec.Storage = source.Storage
+	}
+	if spec.Tier == "" && !spec.IsProd {
+		spec.Tier = source.Tier
+	}
+	if len(spec.AllowedRegistries) == 0 {
+		spec.AllowedRegistries = append([]string(nil), source.AllowedRegistries...)
+	}
+	if spec.QuotaThresholds == nil && source.QuotaThresholds != nil {
+		spec.QuotaThresholds = source.QuotaThresholds.DeepCopy()
+	}
+	if spec.Hibernation == nil && source.Hibernation != nil {
+		spec.Hibernation = source.Hibernation.DeepCopy()
+	}
+	if len(spec.Users) == 0 && spec.CloneFrom.Users {
+		spec.Users = append([]onboardingv1alpha1.User(nil), source.Users...)
+	}
+}
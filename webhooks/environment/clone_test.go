@@ -0,0 +1,49 @@
+package environment
+
+import (
+	"reflect"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+)
+
+func TestCloneSpec(t *testing.T) {
+	resources := onboardingv1alpha1.Resources{
+		ResourceRequests: onboardingv1alpha1.ResourceDescription{CPU: "1", Memory: "1Gi"},
+	}
+	users := []onboardingv1alpha1.User{{Username: "alice", Role: "edit"}}
+	source := onboardingv1alpha1.EnvironmentSpec{
+		Name:              "source",
+		IsProd:            true,
+		Resources:         resources,
+		Storage:           "10Gi",
+		Users:             users,
+		Approvers:         []string{"bob"},
+		AllowedRegistries: []string{"registry.example.com"},
+	}
+
+	spec := onboardingv1alpha1.EnvironmentSpec{
+		Name:      "clone",
+		Storage:   "5Gi",
+		CloneFrom: &onboardingv1alpha1.CloneFrom{Environment: "source"},
+	}
+	cloneSpec(&spec, &source)
+	if spec.Name != "clone" || spec.IsProd || spec.Approvers != nil {
+		t.Errorf("name, production flag and approvers shouldn't be cloned: %v", spec)
+	}
+	if spec.Storage != "5Gi" {
+		t.Errorf("storage of the clone shouldn't be overridden, got %s", spec.Storage)
+	}
+	if spec.Resources != resources || !reflect.DeepEqual(spec.AllowedRegistries, source.AllowedRegistries) {
+		t.Errorf("resources and registries should be cloned: %v", spec)
+	}
+	if spec.Users != nil {
+		t.Errorf("users shouldn't be cloned unless asked for: %v", spec.Users)
+	}
+
+	spec.CloneFrom.Users = true
+	cloneSpec(&spec, &source)
+	if !reflect.DeepEqual(spec.Users, users) {
+		t.Errorf("users should be cloned: %v", spec.Users)
+	}
+}
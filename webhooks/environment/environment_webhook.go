@@ -0,0 +1,231 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/capacity"
+	"gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/operatorconfig"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var log = logf.Log.WithName("webhook_environment")
+
+// ValidatePath is the path the Environment validating webhook is served on
+const ValidatePath = "/validate-onboarding-beopenit-com-v1alpha1-environment"
+
+// Approvers lists the users, or groups prefixed with "group:", allowed to approve production Environments.
+// It is set from the manager flags before the webhook is added.
+var Approvers []string
+
+// OperatorUser is the username of the operator service account, its Environment changes applying the approved
+// QuotaRequests and EnvironmentRequests aren't restricted by the EnvironmentPolicies. It is set before the webhook
+// is added, empty out of a cluster.
+var OperatorUser string
+
+// Add creates the Environment validating and mutating webhooks, and the validating webhooks of the requests on the
+// Environments, and registers them on the Manager webhook server
+func Add(mgr manager.Manager) error {
+	mgr.GetWebhookServer().Register(ValidatePath, &webhook.Admission{Handler: &environmentValidator{client: mgr.GetClient()}})
+	mgr.GetWebhookServer().Register(DefaultPath, &webhook.Admission{Handler: &cloneDefaulter{client: mgr.GetClient()}})
+	mgr.GetWebhookServer().Register(QuotaRequestValidatePath, &webhook.Admission{Handler: &quotaRequestValidator{client: mgr.GetClient()}})
+	mgr.GetWebhookServer().Register(AccessRequestValidatePath, &webhook.Admission{Handler: &accessRequestValidator{client: mgr.GetClient()}})
+	mgr.GetWebhookServer().Register(EnvironmentPromotionValidatePath, &webhook.Admission{Handler: &environmentPromotionValidator{client: mgr.GetClient()}})
+	mgr.GetWebhookServer().Register(EnvironmentRequestValidatePath, &webhook.Admission{Handler: &environmentRequestValidator{client: mgr.GetClient()}})
+	return nil
+}
+
+// environmentValidator checks that the approval of an Environment generation is recorded by an approver and
+// that the EnvironmentPolicies allow the requester to make the change
+type environmentValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+// blank assignment to verify that environmentValidator implements admission.DecoderInjector
+var _ admission.DecoderInjector = &environmentValidator{}
+
+// InjectDecoder injects the decoder
+func (v *environmentValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle admits the Environment unless its approval annotations were changed by someone who isn't an approver,
+// an EnvironmentPolicy forbids the change to the requester or, when enforced, it doesn't fit in the cluster capacity
+func (v *environmentValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	env := &onboardingv1alpha1.Environment{}
+	if err := v.decoder.Decode(req, env); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *onboardingv1alpha1.Environment
+	if req.Operation == admissionv1beta1.Update {
+		old = &onboardingv1alpha1.Environment{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	if req.SubResource == "status" {
+		if reason := validateStatus(old, env, req.UserInfo); reason != "" {
+			log.Info("Denied Environment status change", "Environment Name", env.Name, "User", req.UserInfo.Username, "Reason", reason)
+			return admission.Denied(reason)
+		}
+		return admission.Allowed("")
+	}
+
+	previous := old
+	if previous == nil {
+		previous = &onboardingv1alpha1.Environment{}
+	}
+	if reason := validateApproval(previous, env, req.UserInfo); reason != "" {
+		log.Info("Denied Environment approval", "Environment Name", env.Name, "User", req.UserInfo.Username, "Reason", reason)
+		return admission.Denied(reason)
+	}
+	// The quota is only optional for the Environments cloned from another one, which are defaulted before
+	if reason := validateQuota("spec.", &env.Spec, false); reason != "" {
+		return admission.Denied(reason)
+	}
+	if reason := validateHibernation(env.Spec.Hibernation); reason != "" {
+		return admission.Denied(reason)
+	}
+
+	policies := &onboardingv1alpha1.EnvironmentPolicyList{}
+	if err := v.client.List(ctx, policies); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if reason := validatePolicies(policies.Items, old, env, req.UserInfo); reason != "" {
+		log.Info("Denied Environment change", "Environment Name", env.Name, "User", req.UserInfo.Username, "Reason", reason)
+		return admission.Denied(reason)
+	}
+
+	if cfg := operatorconfig.Get().Capacity; cfg.Enforce {
+		report, err := capacity.Collect(ctx, v.client, cfg.OvercommitRatio)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if reason := report.Check(old, env); reason != "" {
+			log.Info("Denied Environment above the cluster capacity", "Environment Name", env.Name, "User", req.UserInfo.Username, "Reason", reason)
+			return admission.Denied(reason)
+		}
+	}
+	return admission.Allowed("")
+}
+
+// validateApproval returns the reason why the approval annotations of the Environment can't be changed by the
+// user, or an empty string
+func validateApproval(old, env *onboardingv1alpha1.Environment, userInfo authenticationv1.UserInfo) string {
+	generation := onboardingv1alpha1.ApprovedGenerationAnnotation
+	approvedBy := onboardingv1alpha1.ApprovedByAnnotation
+	if old.Annotations[generation] == env.Annotations[generation] && old.Annotations[approvedBy] == env.Annotations[approvedBy] {
+		return ""
+	}
+	if env.Annotations[generation] == "" && env.Annotations[approvedBy] == "" {
+		// Withdrawing an approval is always allowed
+		return ""
+	}
+	if !matchesUser(userInfo, approversOf(old)) {
+		return fmt.Sprintf("%s is not allowed to approve Environment %s", userInfo.Username, env.Name)
+	}
+	if env.Annotations[approvedBy] != userInfo.Username {
+		return fmt.Sprintf("annotation %s must be set to the approving user %s", approvedBy, userInfo.Username)
+	}
+	return ""
+}
+
+// validateStatus returns the reason why the user can't update the status of old into env, or an empty string. The
+// approved spec, whose approvers approve the next changes, is only recorded by the operator.
+func validateStatus(old, env *onboardingv1alpha1.Environment, userInfo authenticationv1.UserInfo) string {
+	if old == nil || equality.Semantic.DeepEqual(old.Status.ApprovedSpec, env.Status.ApprovedSpec) || isOperator(userInfo) {
+		return ""
+	}
+	return "status.approvedSpec can only be changed by the operator"
+}
+
+// validateQuota returns the reason why a quantity of the quota of the spec, its resources and storage, is empty or
+// invalid, or an empty string. The empty quantities are allowed when cloned, they are copied from the source
+// Environment. prefix is the path of the spec in the reasons.
+func validateQuota(prefix string, spec *onboardingv1alpha1.EnvironmentSpec, cloned bool) string {
+	quantities := []struct{ field, quantity string }{
+		{"resources.requests.cpu", spec.ResourceRequests.CPU},
+		{"resources.requests.memory", spec.ResourceRequests.Memory},
+		{"resources.requests.ephemeral-storage", spec.ResourceRequests.EphemeralStorage},
+		{"resources.limits.cpu", spec.ResourceLimits.CPU},
+		{"resources.limits.memory", spec.ResourceLimits.Memory},
+		{"resources.limits.ephemeral-storage", spec.ResourceLimits.EphemeralStorage},
+		{"storage", spec.Storage},
+	}
+	for _, q := range quantities {
+		if q.quantity == "" {
+			if cloned {
+				continue
+			}
+			return fmt.Sprintf("%s%s is required", prefix, q.field)
+		}
+		if _, err := resource.ParseQuantity(q.quantity); err != nil {
+			return fmt.Sprintf("invalid %s%s %q: %v", prefix, q.field, q.quantity, err)
+		}
+	}
+	return ""
+}
+
+// validateHibernation returns the reason why the hibernation schedules are invalid, or an empty string. A schedule
+// requires a wake-up schedule, and the other way round.
+func validateHibernation(hibernation *onboardingv1alpha1.Hibernation) string {
+	if hibernation == nil || (hibernation.Schedule == "" && hibernation.WakeUpSchedule == "") {
+		return ""
+	}
+	schedules := []struct{ name, schedule string }{
+		{"schedule", hibernation.Schedule},
+		{"wakeUpSchedule", hibernation.WakeUpSchedule},
+	}
+	for _, s := range schedules {
+		name, schedule := s.name, s.schedule
+		if schedule == "" {
+			return fmt.Sprintf("hibernation.%s is required with a hibernation schedule", name)
+		}
+		if _, err := cron.ParseStandard(schedule); err != nil {
+			return fmt.Sprintf("invalid hibernation.%s %q: %v", name, schedule, err)
+		}
+	}
+	return ""
+}
+
+// approversOf returns the approvers of an Environment change: the operator approvers and, for an existing
+// Environment, the approvers of its last approved spec. The approved spec is only trusted when the operator user is
+// known, the status changes of the other users being denied.
+func approversOf(old *onboardingv1alpha1.Environment) []string {
+	approvers := append([]string{}, Approvers...)
+	if OperatorUser != "" && old.Status.ApprovedSpec != nil {
+		approvers = append(approvers, old.Status.ApprovedSpec.Approvers...)
+	}
+	return approvers
+}
+
+// matchesUser tells whether the user, or one of its groups, is listed in subjects
+func matchesUser(userInfo authenticationv1.UserInfo, subjects []string) bool {
+	for _, subject := range subjects {
+		if group := strings.TrimPrefix(subject, "group:"); group != subject {
+			for _, g := range userInfo.Groups {
+				if g == group {
+					return true
+				}
+			}
+		} else if subject == userInfo.Username {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package environment
+
+import (
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func approvedEnvironment(approvedBy string) *onboardingv1alpha1.Environment {
+	return &onboardingv1alpha1.Environment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "environment",
+			Annotations: map[string]string{
+				onboardingv1alpha1.ApprovedGenerationAnnotation: "2",
+				onboardingv1alpha1.ApprovedByAnnotation:         approvedBy,
+			},
+		},
+	}
+}
+
+// withQuota completes the quota of the Environment, keeping its requests.cpu
+func withQuota(env *onboardingv1alpha1.Environment) *onboardingv1alpha1.Environment {
+	env.Spec.ResourceRequests.Memory, env.Spec.ResourceRequests.EphemeralStorage = "1Gi", "1Gi"
+	env.Spec.ResourceLimits = onboardingv1alpha1.ResourceDescription{CPU: "2", Memory: "2Gi", EphemeralStorage: "2Gi"}
+	env.Spec.Storage = "10Gi"
+	return env
+}
+
+func TestValidateApproval(t *testing.T) {
+	Approvers = []string{"platform-admin", "group:platform"}
+	OperatorUser = "system:serviceaccount:onboarding:onboarding-operator-kubernetes"
+	defer func() { OperatorUser = "" }()
+	old := &onboardingv1alpha1.Environment{
+		Status: onboardingv1alpha1.EnvironmentStatus{
+			ApprovedSpec: &onboardingv1alpha1.EnvironmentSpec{Approvers: []string{"owner"}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		env      *onboardingv1alpha1.Environment
+		userInfo authenticationv1.UserInfo
+		allowed  bool
+	}{
+		{"operator approver", approvedEnvironment("platform-admin"), authenticationv1.UserInfo{Username: "platform-admin"}, true},
+		{"group approver", approvedEnvironment("alice"), authenticationv1.UserInfo{Username: "alice", Groups: []string{"platform"}}, true},
+		{"environment approver", approvedEnvironment("owner"), authenticationv1.UserInfo{Username: "owner"}, true},
+		{"not an approver", approvedEnvironment("dev"), authenticationv1.UserInfo{Username: "dev"}, false},
+		{"approved on behalf of someone else", approvedEnvironment("owner"), authenticationv1.UserInfo{Username: "platform-admin"}, false},
+		{"no approval change", &onboardingv1alpha1.Environment{}, authenticationv1.UserInfo{Username: "dev"}, true},
+	}
+	for _, test := range tests {
+		reason := validateApproval(old, test.env, test.userInfo)
+		if allowed := reason == ""; allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", test.name, test.allowed, reason)
+		}
+	}
+}
+
+func TestValidateStatus(t *testing.T) {
+	OperatorUser = "system:serviceaccount:onboarding:onboarding-operator-kubernetes"
+	defer func() { OperatorUser = "" }()
+	old := &onboardingv1alpha1.Environment{
+		Status: onboardingv1alpha1.EnvironmentStatus{
+			ApprovedSpec: &onboardingv1alpha1.EnvironmentSpec{Approvers: []string{"owner"}},
+		},
+	}
+	approved := old.DeepCopy()
+	approved.Status.ApprovedSpec.Approvers = []string{"dev"}
+	ready := old.DeepCopy()
+	ready.Status.EnvironmentStatus = onboardingv1alpha1.EnvironmentReady
+
+	tests := []struct {
+		name     string
+		env      *onboardingv1alpha1.Environment
+		userInfo authenticationv1.UserInfo
+		allowed  bool
+	}{
+		{"operator records the approved spec", approved, authenticationv1.UserInfo{Username: OperatorUser}, true},
+		{"user records the approved spec", approved, authenticationv1.UserInfo{Username: "dev"}, false},
+		{"user updates the status", ready, authenticationv1.UserInfo{Username: "dev"}, true},
+	}
+	for _, test := range tests {
+		reason := validateStatus(old, test.env, test.userInfo)
+		if allowed := reason == ""; allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", test.name, test.allowed, reason)
+		}
+	}
+
+	// Without operator user, the approved spec isn't trusted
+	OperatorUser = ""
+	if approvers := approversOf(old); matchesUser(authenticationv1.UserInfo{Username: "owner"}, approvers) {
+		t.Errorf("expected the approvers of the approved spec to be ignored, got %v", approvers)
+	}
+}
+
+func TestValidateQuota(t *testing.T) {
+	quota := func(cpu, storage string) *onboardingv1alpha1.EnvironmentSpec {
+		spec := withQuota(newEnvironment(false, cpu)).Spec.DeepCopy()
+		spec.Storage = storage
+		return spec
+	}
+	tests := []struct {
+		name    string
+		spec    *onboardingv1alpha1.EnvironmentSpec
+		cloned  bool
+		allowed bool
+	}{
+		{"complete quota", quota("1000m", "10Gi"), false, true},
+		{"missing storage", quota("1000m", ""), false, false},
+		{"missing resources", &onboardingv1alpha1.EnvironmentSpec{Storage: "10Gi"}, false, false},
+		{"invalid quantity", quota("a lot", "10Gi"), false, false},
+		{"cloned without quota", &onboardingv1alpha1.EnvironmentSpec{}, true, true},
+		{"cloned with an invalid quantity", &onboardingv1alpha1.EnvironmentSpec{Storage: "big"}, true, false},
+	}
+	for _, test := range tests {
+		reason := validateQuota("spec.", test.spec, test.cloned)
+		if allowed := reason == ""; allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", test.name, test.allowed, reason)
+		}
+	}
+}
+
+func TestValidateHibernation(t *testing.T) {
+	tests := []struct {
+		name        string
+		hibernation *onboardingv1alpha1.Hibernation
+		allowed     bool
+	}{
+		{"no hibernation", nil, true},
+		{"manual hibernation", &onboardingv1alpha1.Hibernation{Hibernate: true}, true},
+		{"schedules", &onboardingv1alpha1.Hibernation{Schedule: "0 20 * * 1-5", WakeUpSchedule: "CRON_TZ=Europe/Paris 0 7 * * 1-5"}, true},
+		{"missing wake-up schedule", &onboardingv1alpha1.Hibernation{Schedule: "0 20 * * 1-5"}, false},
+		{"invalid schedule", &onboardingv1alpha1.Hibernation{Schedule: "every night", WakeUpSchedule: "0 7 * * *"}, false},
+	}
+	for _, test := range tests {
+		reason := validateHibernation(test.hibernation)
+		if allowed := reason == ""; allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", test.name, test.allowed, reason)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// EnvironmentPromotionValidatePath is the path the EnvironmentPromotion validating webhook is served on
+const EnvironmentPromotionValidatePath = "/validate-onboarding-beopenit-com-v1alpha1-environmentpromotion"
+
+// environmentPromotionValidator checks that the approval of an EnvironmentPromotion is recorded by an approver of
+// its target Environment
+type environmentPromotionValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+// blank assignment to verify that environmentPromotionValidator implements admission.DecoderInjector
+var _ admission.DecoderInjector = &environmentPromotionValidator{}
+
+// InjectDecoder injects the decoder
+func (v *environmentPromotionValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle admits the EnvironmentPromotion created without approval, and the approval of an existing promotion by an
+// approver of its target Environment
+func (v *environmentPromotionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	promotion := &onboardingv1alpha1.EnvironmentPromotion{}
+	if err := v.decoder.Decode(req, promotion); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *onboardingv1alpha1.EnvironmentPromotion
+	target := &onboardingv1alpha1.Environment{}
+	if req.Operation == admissionv1beta1.Update {
+		old = &onboardingv1alpha1.EnvironmentPromotion{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		err := v.client.Get(ctx, types.NamespacedName{Name: promotion.Spec.Target}, target)
+		if err != nil && client.IgnoreNotFound(err) != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+	if reason := validateEnvironmentPromotion(old, promotion, target, req.UserInfo); reason != "" {
+		log.Info("Denied EnvironmentPromotion change", "EnvironmentPromotion Name", promotion.Name, "User", req.UserInfo.Username, "Reason", reason)
+		return admission.Denied(reason)
+	}
+	return admission.Allowed("")
+}
+
+// validateEnvironmentPromotion returns the reason why the user can't create the promotion, or update old into
+// promotion, or an empty string. old is nil on creation. Only the approval of a promotion can be changed, by an
+// approver of the approved spec of its target Environment or an operator approver.
+func validateEnvironmentPromotion(old, promotion *onboardingv1alpha1.EnvironmentPromotion, target *onboardingv1alpha1.Environment, userInfo authenticationv1.UserInfo) string {
+	if old == nil {
+		if promotion.Spec.Approved || promotion.Spec.ApprovedBy != "" {
+			return "an EnvironmentPromotion can't be approved at its creation"
+		}
+		return ""
+	}
+
+	oldSpec, spec := old.Spec, promotion.Spec
+	oldSpec.Approved, oldSpec.ApprovedBy = false, ""
+	spec.Approved, spec.ApprovedBy = false, ""
+	if !equality.Semantic.DeepEqual(oldSpec, spec) {
+		return "only the approval of an EnvironmentPromotion can be changed"
+	}
+	if old.Spec.Approved == promotion.Spec.Approved && old.Spec.ApprovedBy == promotion.Spec.ApprovedBy {
+		return ""
+	}
+	if !promotion.Spec.Approved && promotion.Spec.ApprovedBy == "" {
+		// Withdrawing an approval is always allowed
+		return ""
+	}
+	if promotion.Spec.ApprovedBy != userInfo.Username {
+		return fmt.Sprintf("spec.approvedBy must be set to the approving user %s", userInfo.Username)
+	}
+	if !matchesUser(userInfo, approversOf(target)) {
+		return fmt.Sprintf("%s is not allowed to approve EnvironmentPromotion %s", userInfo.Username, promotion.Name)
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package environment
+
+import (
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+func newEnvironmentPromotion(kinds []string, approvedBy string) *onboardingv1alpha1.EnvironmentPromotion {
+	return &onboardingv1alpha1.EnvironmentPromotion{
+		Spec: onboardingv1alpha1.EnvironmentPromotionSpec{
+			Source:     "staging",
+			Target:     "production",
+			Kinds:      kinds,
+			Approved:   approvedBy != "",
+			ApprovedBy: approvedBy,
+		},
+	}
+}
+
+func TestValidateEnvironmentPromotion(t *testing.T) {
+	Approvers = []string{"group:platform"}
+	OperatorUser = "system:serviceaccount:onboarding:onboarding-operator-kubernetes"
+	defer func() { Approvers, OperatorUser = nil, "" }()
+	target := &onboardingv1alpha1.Environment{
+		Spec: onboardingv1alpha1.EnvironmentSpec{Approvers: []string{"approver1", "dev"}},
+		Status: onboardingv1alpha1.EnvironmentStatus{
+			ApprovedSpec: &onboardingv1alpha1.EnvironmentSpec{Approvers: []string{"approver1"}},
+		},
+	}
+	pending := newEnvironmentPromotion(nil, "")
+	approver1 := authenticationv1.UserInfo{Username: "approver1"}
+	alice := authenticationv1.UserInfo{Username: "alice", Groups: []string{"platform"}}
+	dev := authenticationv1.UserInfo{Username: "dev"}
+
+	tests := []struct {
+		name      string
+		old       *onboardingv1alpha1.EnvironmentPromotion
+		promotion *onboardingv1alpha1.EnvironmentPromotion
+		userInfo  authenticationv1.UserInfo
+		target    *onboardingv1alpha1.Environment
+		allowed   bool
+	}{
+		{"created", nil, newEnvironmentPromotion(nil, ""), dev, target, true},
+		{"created approved", nil, newEnvironmentPromotion(nil, "approver1"), approver1, target, false},
+		{"target approver approves", pending, newEnvironmentPromotion(nil, "approver1"), approver1, target, true},
+		{"operator approver approves", pending, newEnvironmentPromotion(nil, "alice"), alice, target, true},
+		{"approved on behalf of an approver", pending, newEnvironmentPromotion(nil, "approver1"), dev, target, false},
+		{"approver of the unapproved target spec", pending, newEnvironmentPromotion(nil, "dev"), dev, target, false},
+		{"target without approvers", pending, newEnvironmentPromotion(nil, "approver1"), approver1, &onboardingv1alpha1.Environment{}, false},
+		{"promoted kinds changed", pending, newEnvironmentPromotion([]string{"Secret"}, ""), dev, target, false},
+		{"approval withdrawn", newEnvironmentPromotion(nil, "approver1"), pending, dev, target, true},
+	}
+	for _, test := range tests {
+		reason := validateEnvironmentPromotion(test.old, test.promotion, test.target, test.userInfo)
+		if allowed := reason == ""; allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", test.name, test.allowed, reason)
+		}
+	}
+}
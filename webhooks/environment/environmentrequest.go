@@ -0,0 +1,179 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// EnvironmentRequestValidatePath is the path the EnvironmentRequest validating webhook is served on
+const EnvironmentRequestValidatePath = "/validate-onboarding-beopenit-com-v1alpha1-environmentrequest"
+
+// environmentRequestValidator checks the Environment requested by an EnvironmentRequest against the
+// EnvironmentPolicies for its requester, the operator creating the Environment, that its namespace doesn't exist,
+// and that its approval is recorded by a request approver
+type environmentRequestValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+// blank assignment to verify that environmentRequestValidator implements admission.DecoderInjector
+var _ admission.DecoderInjector = &environmentRequestValidator{}
+
+// InjectDecoder injects the decoder
+func (v *environmentRequestValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle admits the EnvironmentRequest created by the user it names when the policies allow the user to create its
+// Environment in a new namespace, and the approval of an existing request by a request approver
+func (v *environmentRequestValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	er := &onboardingv1alpha1.EnvironmentRequest{}
+	if err := v.decoder.Decode(req, er); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *onboardingv1alpha1.EnvironmentRequest
+	var source *onboardingv1alpha1.Environment
+	var reason string
+	if req.Operation == admissionv1beta1.Update {
+		old = &onboardingv1alpha1.EnvironmentRequest{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	} else {
+		// The namespace of the requested Environment must be new, existing namespaces are adopted by their admins
+		err := v.client.Get(ctx, types.NamespacedName{Name: er.Spec.Environment.Name}, &corev1.Namespace{})
+		if err == nil {
+			reason = fmt.Sprintf("namespace %s already exists", er.Spec.Environment.Name)
+		} else if !errors.IsNotFound(err) {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if cloneFrom := er.Spec.Environment.CloneFrom; cloneFrom != nil {
+			source = &onboardingv1alpha1.Environment{}
+			err := v.client.Get(ctx, types.NamespacedName{Name: cloneFrom.Environment}, source)
+			if errors.IsNotFound(err) {
+				source = nil
+			} else if err != nil {
+				return admission.Errored(http.StatusInternalServerError, err)
+			}
+		}
+	}
+	policies := &onboardingv1alpha1.EnvironmentPolicyList{}
+	if err := v.client.List(ctx, policies); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if reason == "" {
+		reason = validateEnvironmentRequest(policies.Items, source, old, er, req.UserInfo)
+	}
+	if reason != "" {
+		log.Info("Denied EnvironmentRequest change", "EnvironmentRequest.Namespace", er.Namespace, "EnvironmentRequest.Name", er.Name, "User", req.UserInfo.Username, "Reason", reason)
+		return admission.Denied(reason)
+	}
+	return admission.Allowed("")
+}
+
+// requestApprovers returns the approvers of the EnvironmentRequests of the Environment tier: the request approvers
+// of the EnvironmentPolicy rules of the tier, and the operator approvers when there is any
+func requestApprovers(policies []onboardingv1alpha1.EnvironmentPolicy, env *onboardingv1alpha1.Environment) []string {
+	var approvers []string
+	for _, policy := range policies {
+		for _, rule := range policy.Spec.Rules {
+			if rule.Tier == "" || rule.Tier == env.Tier() {
+				approvers = append(approvers, rule.RequestApprovers...)
+			}
+		}
+	}
+	if len(approvers) == 0 {
+		return nil
+	}
+	return append(approvers, Approvers...)
+}
+
+// validateRequestedSpec returns the reason why the Environment spec can't be requested by the user, or an empty
+// string. The fields giving rights on other namespaces or objects are kept to the Environment admins: adopting a
+// namespace, the approvers, the bootstrap templates and the users, derived from the requester. An Environment is
+// only cloned from a source Environment the requester administers.
+func validateRequestedSpec(spec *onboardingv1alpha1.EnvironmentSpec, source *onboardingv1alpha1.Environment, userInfo authenticationv1.UserInfo) string {
+	switch {
+	case spec.Adopt:
+		return "spec.environment.adopt can't be requested"
+	case len(spec.Approvers) > 0:
+		return "spec.environment.approvers can't be requested"
+	case spec.Bootstrap != nil:
+		return "spec.environment.bootstrap can't be requested"
+	case len(spec.Users) > 0:
+		return "spec.environment.users can't be requested, the requester is the admin of the Environment"
+	}
+	if spec.CloneFrom == nil {
+		return ""
+	}
+	if source != nil {
+		for _, user := range source.Spec.Users {
+			if user.Username == userInfo.Username && user.Role == "admin" {
+				return ""
+			}
+		}
+	}
+	return fmt.Sprintf("%s is not an admin of Environment %s to clone", userInfo.Username, spec.CloneFrom.Environment)
+}
+
+// validateEnvironmentRequest returns the reason why the user can't create the request, or update old into er, or
+// an empty string. old is nil on creation, and source is the Environment the requested one is cloned from, nil when
+// it isn't found. The requested Environment is checked against the policies at creation, then only the approval of
+// the request can be changed, by a request approver who isn't the requester.
+func validateEnvironmentRequest(policies []onboardingv1alpha1.EnvironmentPolicy, source *onboardingv1alpha1.Environment, old, er *onboardingv1alpha1.EnvironmentRequest, userInfo authenticationv1.UserInfo) string {
+	env := er.RequestedEnvironment()
+	if old == nil {
+		if er.Spec.RequestedBy != userInfo.Username {
+			return fmt.Sprintf("spec.requestedBy must be set to the requesting user %s", userInfo.Username)
+		}
+		if er.Spec.Approved || er.Spec.ApprovedBy != "" {
+			return "an EnvironmentRequest can't be approved at its creation"
+		}
+		if reason := validateRequestedSpec(&er.Spec.Environment, source, userInfo); reason != "" {
+			return reason
+		}
+		if reason := validateQuota("spec.environment.", &env.Spec, env.Spec.CloneFrom != nil); reason != "" {
+			return reason
+		}
+		if reason := validateHibernation(env.Spec.Hibernation); reason != "" {
+			return reason
+		}
+		return validatePolicies(policies, nil, env, userInfo)
+	}
+
+	oldSpec, spec := old.Spec, er.Spec
+	oldSpec.Approved, oldSpec.ApprovedBy = false, ""
+	spec.Approved, spec.ApprovedBy = false, ""
+	if !equality.Semantic.DeepEqual(oldSpec, spec) {
+		return "only the approval of an EnvironmentRequest can be changed"
+	}
+	if old.Spec.Approved == er.Spec.Approved && old.Spec.ApprovedBy == er.Spec.ApprovedBy {
+		return ""
+	}
+	if !er.Spec.Approved && er.Spec.ApprovedBy == "" {
+		// Withdrawing an approval is always allowed
+		return ""
+	}
+	if er.Spec.ApprovedBy != userInfo.Username {
+		return fmt.Sprintf("spec.approvedBy must be set to the approving user %s", userInfo.Username)
+	}
+	if userInfo.Username == er.Spec.RequestedBy {
+		return "an EnvironmentRequest can't be approved by its requester"
+	}
+	if !matchesUser(userInfo, requestApprovers(policies, env)) {
+		return fmt.Sprintf("%s is not allowed to approve EnvironmentRequest %s", userInfo.Username, er.Name)
+	}
+	return ""
+}
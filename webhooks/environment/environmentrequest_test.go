@@ -0,0 +1,87 @@
+package environment
+
+import (
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+func newEnvironmentRequest(isProd bool, requestedBy, approvedBy string) *onboardingv1alpha1.EnvironmentRequest {
+	return &onboardingv1alpha1.EnvironmentRequest{
+		Spec: onboardingv1alpha1.EnvironmentRequestSpec{
+			Environment: *withQuota(newEnvironment(isProd, "1")).Spec.DeepCopy(),
+			RequestedBy: requestedBy,
+			Approved:    approvedBy != "",
+			ApprovedBy:  approvedBy,
+		},
+	}
+}
+
+func TestValidateEnvironmentRequest(t *testing.T) {
+	Approvers = nil
+	policies := []onboardingv1alpha1.EnvironmentPolicy{
+		{
+			Spec: onboardingv1alpha1.EnvironmentPolicySpec{
+				Rules: []onboardingv1alpha1.EnvironmentPolicyRule{
+					{
+						Tier:             onboardingv1alpha1.TierProd,
+						Creators:         []string{"group:payments"},
+						RequestApprovers: []string{"group:platform"},
+					},
+				},
+			},
+		},
+	}
+	user1 := authenticationv1.UserInfo{Username: "user1", Groups: []string{"payments"}}
+	alice := authenticationv1.UserInfo{Username: "alice", Groups: []string{"platform"}}
+	pending := newEnvironmentRequest(true, "user1", "")
+	noQuota := newEnvironmentRequest(false, "user1", "")
+	noQuota.Spec.Environment.Resources = onboardingv1alpha1.Resources{}
+	adopt := newEnvironmentRequest(false, "user1", "")
+	adopt.Spec.Environment.Adopt = true
+	approvers := newEnvironmentRequest(false, "user1", "")
+	approvers.Spec.Environment.Approvers = []string{"user1"}
+	bootstrap := newEnvironmentRequest(false, "user1", "")
+	bootstrap.Spec.Environment.Bootstrap = &onboardingv1alpha1.Bootstrap{Templates: []string{"defaults"}}
+	users := newEnvironmentRequest(false, "user1", "")
+	users.Spec.Environment.Users = []onboardingv1alpha1.User{{Username: "user2", Role: "admin"}}
+	clone := newEnvironmentRequest(false, "user1", "")
+	clone.Spec.Environment.CloneFrom = &onboardingv1alpha1.CloneFrom{Environment: "source"}
+	administered := newEnvironment(false, "1", onboardingv1alpha1.User{Username: "user1", Role: "admin"})
+	developed := newEnvironment(false, "1", onboardingv1alpha1.User{Username: "user1", Role: "dev"})
+
+	tests := []struct {
+		name     string
+		source   *onboardingv1alpha1.Environment
+		old      *onboardingv1alpha1.EnvironmentRequest
+		er       *onboardingv1alpha1.EnvironmentRequest
+		userInfo authenticationv1.UserInfo
+		allowed  bool
+	}{
+		{"creator requests prod", nil, nil, newEnvironmentRequest(true, "user1", ""), user1, true},
+		{"anyone requests dev", nil, nil, newEnvironmentRequest(false, "bob", ""), authenticationv1.UserInfo{Username: "bob"}, true},
+		{"not a creator requests prod", nil, nil, newEnvironmentRequest(true, "bob", ""), authenticationv1.UserInfo{Username: "bob"}, false},
+		{"requested on behalf of someone else", nil, nil, newEnvironmentRequest(false, "user2", ""), user1, false},
+		{"requested without quota", nil, nil, noQuota, user1, false},
+		{"requested approved", nil, nil, newEnvironmentRequest(false, "user1", "user1"), user1, false},
+		{"requested adoption", nil, nil, adopt, user1, false},
+		{"requested approvers", nil, nil, approvers, user1, false},
+		{"requested bootstrap", nil, nil, bootstrap, user1, false},
+		{"requested users", nil, nil, users, user1, false},
+		{"cloned from an administered Environment", administered, nil, clone, user1, true},
+		{"cloned from a developed Environment", developed, nil, clone, user1, false},
+		{"cloned from a missing Environment", nil, nil, clone, user1, false},
+		{"request approver approves", nil, pending, newEnvironmentRequest(true, "user1", "alice"), alice, true},
+		{"requester approves", nil, pending, newEnvironmentRequest(true, "user1", "user1"), user1, false},
+		{"not a request approver", nil, pending, newEnvironmentRequest(true, "user1", "bob"), authenticationv1.UserInfo{Username: "bob"}, false},
+		{"requested Environment changed", nil, pending, newEnvironmentRequest(false, "user1", ""), user1, false},
+	}
+	for _, test := range tests {
+		reason := validateEnvironmentRequest(policies, test.source, test.old, test.er, test.userInfo)
+		if allowed := reason == ""; allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", test.name, test.allowed, reason)
+		}
+	}
+}
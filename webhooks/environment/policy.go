@@ -0,0 +1,93 @@
+package environment
+
+import (
+	"fmt"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// validatePolicies returns the reason why the EnvironmentPolicies don't allow the user to create the Environment,
+// or to update old into env, or an empty string. old is nil on creation. The QuotaRequest and EnvironmentRequest
+// webhooks check the policies against the requester at the creation of the requests, the operator applying them
+// once approved isn't checked again.
+func validatePolicies(policies []onboardingv1alpha1.EnvironmentPolicy, old, env *onboardingv1alpha1.Environment, userInfo authenticationv1.UserInfo) string {
+	if env.Spec.Tier == onboardingv1alpha1.TierProd && !env.Spec.IsProd {
+		return fmt.Sprintf("tier %s requires isprod", onboardingv1alpha1.TierProd)
+	}
+	if isOperator(userInfo) {
+		return ""
+	}
+	for _, policy := range policies {
+		for _, rule := range policy.Spec.Rules {
+			if rule.Tier != "" && rule.Tier != env.Tier() {
+				continue
+			}
+			if reason := validateRule(rule, old, env, userInfo); reason != "" {
+				return fmt.Sprintf("EnvironmentPolicy %s: %s", policy.Name, reason)
+			}
+		}
+	}
+	return ""
+}
+
+// validateRule returns the reason why the rule doesn't allow the change, or an empty string
+func validateRule(rule onboardingv1alpha1.EnvironmentPolicyRule, old, env *onboardingv1alpha1.Environment, userInfo authenticationv1.UserInfo) string {
+	if old == nil || old.Tier() != env.Tier() {
+		if len(rule.Creators) > 0 && !matchesUser(userInfo, rule.Creators) {
+			return fmt.Sprintf("%s may not create %s environments", userInfo.Username, env.Tier())
+		}
+	}
+
+	if len(rule.QuotaManagers) > 0 && !matchesUser(userInfo, rule.QuotaManagers) {
+		quota := env.Spec.Quota()
+		oldQuota := map[corev1.ResourceName]string{}
+		if old != nil {
+			oldQuota = old.Spec.Quota()
+		}
+		for key, threshold := range rule.QuotaThreshold {
+			value, err := resource.ParseQuantity(quota[key])
+			if err != nil || value.Cmp(threshold) <= 0 {
+				continue
+			}
+			if oldValue, err := resource.ParseQuantity(oldQuota[key]); err == nil && value.Cmp(oldValue) <= 0 {
+				// Not a raise
+				continue
+			}
+			return fmt.Sprintf("%s may not raise %s above %s", userInfo.Username, key, threshold.String())
+		}
+	}
+
+	if len(rule.AdminGranters) > 0 && !matchesUser(userInfo, rule.AdminGranters) {
+		previous := map[string]bool{}
+		if old != nil {
+			for _, admin := range admins(old) {
+				previous[admin] = true
+			}
+		}
+		for _, admin := range admins(env) {
+			if !previous[admin] {
+				return fmt.Sprintf("%s may not give the admin role to %s", userInfo.Username, admin)
+			}
+		}
+	}
+	return ""
+}
+
+// admins returns the users bound to the admin ClusterRole by the Environment: admins and, out of production, devs
+func admins(env *onboardingv1alpha1.Environment) []string {
+	var result []string
+	for _, user := range env.Spec.Users {
+		if user.Role == "admin" || (user.Role == "dev" && !env.Spec.IsProd) {
+			result = append(result, user.Username)
+		}
+	}
+	return result
+}
+
+// isOperator tells whether the user is the operator service account
+func isOperator(userInfo authenticationv1.UserInfo) bool {
+	return OperatorUser != "" && userInfo.Username == OperatorUser
+}
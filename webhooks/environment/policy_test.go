@@ -0,0 +1,99 @@
+package environment
+
+import (
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newEnvironment(isProd bool, cpu string, users ...onboardingv1alpha1.User) *onboardingv1alpha1.Environment {
+	env := &onboardingv1alpha1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "environment"},
+		Spec: onboardingv1alpha1.EnvironmentSpec{
+			Name:   "project1",
+			IsProd: isProd,
+			Users:  users,
+		},
+	}
+	env.Spec.ResourceRequests.CPU = cpu
+	return env
+}
+
+func TestValidatePolicies(t *testing.T) {
+	policies := []onboardingv1alpha1.EnvironmentPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "default"},
+			Spec: onboardingv1alpha1.EnvironmentPolicySpec{
+				Rules: []onboardingv1alpha1.EnvironmentPolicyRule{
+					{
+						Tier:           onboardingv1alpha1.TierProd,
+						Creators:       []string{"group:platform"},
+						QuotaThreshold: corev1.ResourceList{"requests.cpu": resource.MustParse("4")},
+						QuotaManagers:  []string{"group:platform"},
+					},
+					{
+						AdminGranters: []string{"group:platform", "onboarding-portal"},
+					},
+				},
+			},
+		},
+	}
+	platform := authenticationv1.UserInfo{Username: "alice", Groups: []string{"platform"}}
+	portal := authenticationv1.UserInfo{Username: "onboarding-portal"}
+	admin := onboardingv1alpha1.User{Username: "user1", Role: "admin"}
+	dev := onboardingv1alpha1.User{Username: "user2", Role: "dev"}
+
+	tests := []struct {
+		name     string
+		old      *onboardingv1alpha1.Environment
+		env      *onboardingv1alpha1.Environment
+		userInfo authenticationv1.UserInfo
+		allowed  bool
+	}{
+		{"platform creates prod", nil, newEnvironment(true, "8", admin), platform, true},
+		{"portal creates prod", nil, newEnvironment(true, "1"), portal, false},
+		{"portal creates dev with admins", nil, newEnvironment(false, "8", admin, dev), portal, true},
+		{"portal moves dev to prod", newEnvironment(false, "1"), newEnvironment(true, "1"), portal, false},
+		{"portal raises prod quota below threshold", newEnvironment(true, "1"), newEnvironment(true, "2"), portal, true},
+		{"portal raises prod quota above threshold", newEnvironment(true, "1"), newEnvironment(true, "8"), portal, false},
+		{"portal lowers prod quota above threshold", newEnvironment(true, "16"), newEnvironment(true, "8"), portal, true},
+		{"platform raises prod quota above threshold", newEnvironment(true, "1"), newEnvironment(true, "8"), platform, true},
+		{"unknown user adds an admin", newEnvironment(false, "1"), newEnvironment(false, "1", admin), authenticationv1.UserInfo{Username: "bob"}, false},
+		{"unknown user adds a dev out of production", newEnvironment(false, "1"), newEnvironment(false, "1", dev), authenticationv1.UserInfo{Username: "bob"}, false},
+		{"unknown user keeps the admins", newEnvironment(false, "1", admin), newEnvironment(false, "2", admin), authenticationv1.UserInfo{Username: "bob"}, true},
+	}
+	for _, test := range tests {
+		reason := validatePolicies(policies, test.old, test.env, test.userInfo)
+		if allowed := reason == ""; allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", test.name, test.allowed, reason)
+		}
+	}
+}
+
+func TestValidatePoliciesOperator(t *testing.T) {
+	OperatorUser = "system:serviceaccount:onboarding:onboarding-operator-kubernetes"
+	defer func() { OperatorUser = "" }()
+	policies := []onboardingv1alpha1.EnvironmentPolicy{
+		{
+			Spec: onboardingv1alpha1.EnvironmentPolicySpec{
+				Rules: []onboardingv1alpha1.EnvironmentPolicyRule{
+					{
+						QuotaThreshold: corev1.ResourceList{"requests.cpu": resource.MustParse("4")},
+						QuotaManagers:  []string{"group:platform"},
+					},
+				},
+			},
+		},
+	}
+
+	// The operator applies the approved QuotaRequests
+	operator := authenticationv1.UserInfo{Username: OperatorUser}
+	if reason := validatePolicies(policies, newEnvironment(false, "1"), newEnvironment(false, "8"), operator); reason != "" {
+		t.Errorf("operator should raise the quota above the threshold, got %q", reason)
+	}
+}
@@ -0,0 +1,149 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// QuotaRequestValidatePath is the path the QuotaRequest validating webhook is served on
+const QuotaRequestValidatePath = "/validate-onboarding-beopenit-com-v1alpha1-quotarequest"
+
+// quotaRequestValidator checks that a QuotaRequest records its requester, that the EnvironmentPolicies allow the
+// requester to set the requested quota, and that its approval is recorded by an approver of its Environment or a
+// quota manager, the namespace admins creating the requests
+type quotaRequestValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+// blank assignment to verify that quotaRequestValidator implements admission.DecoderInjector
+var _ admission.DecoderInjector = &quotaRequestValidator{}
+
+// InjectDecoder injects the decoder
+func (v *quotaRequestValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle admits the QuotaRequest created by the user it names when the policies allow the user to set the requested
+// quota of the Environment of the namespace, and the approval of an existing request by an approver
+func (v *quotaRequestValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	qr := &onboardingv1alpha1.QuotaRequest{}
+	if err := v.decoder.Decode(req, qr); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *onboardingv1alpha1.QuotaRequest
+	if req.Operation == admissionv1beta1.Update {
+		old = &onboardingv1alpha1.QuotaRequest{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+	env, err := v.environmentOf(ctx, qr.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	policies := &onboardingv1alpha1.EnvironmentPolicyList{}
+	if err := v.client.List(ctx, policies); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if reason := validateQuotaRequest(policies.Items, env, old, qr, req.UserInfo); reason != "" {
+		log.Info("Denied QuotaRequest change", "QuotaRequest.Namespace", qr.Namespace, "QuotaRequest.Name", qr.Name, "User", req.UserInfo.Username, "Reason", reason)
+		return admission.Denied(reason)
+	}
+	return admission.Allowed("")
+}
+
+// environmentOf returns the Environment of the namespace, or nil when the namespace doesn't belong to an Environment
+func (v *quotaRequestValidator) environmentOf(ctx context.Context, namespace string) (*onboardingv1alpha1.Environment, error) {
+	ns := &corev1.Namespace{}
+	if err := v.client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	name := ns.Labels[onboardingv1alpha1.EnvironmentLabel]
+	if name == "" {
+		return nil, nil
+	}
+	env := &onboardingv1alpha1.Environment{}
+	if err := v.client.Get(ctx, types.NamespacedName{Name: name}, env); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return env, nil
+}
+
+// quotaApprovers returns the approvers of the QuotaRequests of the Environment: the operator approvers, the
+// approvers of the approved spec of the Environment and the quota managers of the EnvironmentPolicy rules of the
+// Environment tier
+func quotaApprovers(policies []onboardingv1alpha1.EnvironmentPolicy, env *onboardingv1alpha1.Environment) []string {
+	if env == nil {
+		return append([]string{}, Approvers...)
+	}
+	approvers := approversOf(env)
+	for _, policy := range policies {
+		for _, rule := range policy.Spec.Rules {
+			if rule.Tier == "" || rule.Tier == env.Tier() {
+				approvers = append(approvers, rule.QuotaManagers...)
+			}
+		}
+	}
+	return approvers
+}
+
+// validateQuotaRequest returns the reason why the user can't create the request, or update old into qr, or an
+// empty string. env is the Environment of the namespace of the request, nil when there is none, and old is nil on
+// creation. The Environment with the requested quota is checked against the policies at creation, then only the
+// approval of a request can be changed, by an approver who isn't the requester.
+func validateQuotaRequest(policies []onboardingv1alpha1.EnvironmentPolicy, env *onboardingv1alpha1.Environment, old, qr *onboardingv1alpha1.QuotaRequest, userInfo authenticationv1.UserInfo) string {
+	if old == nil {
+		if qr.Spec.RequestedBy != userInfo.Username {
+			return fmt.Sprintf("spec.requestedBy must be set to the requesting user %s", userInfo.Username)
+		}
+		if qr.Spec.Approved || qr.Spec.ApprovedBy != "" {
+			return "a QuotaRequest can't be approved at its creation"
+		}
+		if env == nil {
+			return fmt.Sprintf("namespace %s doesn't belong to an Environment", qr.Namespace)
+		}
+		requested := env.DeepCopy()
+		requested.Spec.Resources = qr.Spec.Resources
+		requested.Spec.Storage = qr.Spec.Storage
+		if reason := validateQuota("spec.", &requested.Spec, false); reason != "" {
+			return reason
+		}
+		return validatePolicies(policies, env, requested, userInfo)
+	}
+
+	oldSpec, spec := old.Spec, qr.Spec
+	oldSpec.Approved, oldSpec.ApprovedBy = false, ""
+	spec.Approved, spec.ApprovedBy = false, ""
+	if !equality.Semantic.DeepEqual(oldSpec, spec) {
+		return "only the approval of a QuotaRequest can be changed"
+	}
+	if old.Spec.Approved == qr.Spec.Approved && old.Spec.ApprovedBy == qr.Spec.ApprovedBy {
+		return ""
+	}
+	if !qr.Spec.Approved && qr.Spec.ApprovedBy == "" {
+		// Withdrawing an approval is always allowed
+		return ""
+	}
+	if qr.Spec.ApprovedBy != userInfo.Username {
+		return fmt.Sprintf("spec.approvedBy must be set to the approving user %s", userInfo.Username)
+	}
+	if userInfo.Username == qr.Spec.RequestedBy {
+		return "a QuotaRequest can't be approved by its requester"
+	}
+	if !matchesUser(userInfo, quotaApprovers(policies, env)) {
+		return fmt.Sprintf("%s is not allowed to approve QuotaRequest %s", userInfo.Username, qr.Name)
+	}
+	return ""
+}
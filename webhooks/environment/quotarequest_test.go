@@ -0,0 +1,84 @@
+package environment
+
+import (
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newQuotaRequest(requestedBy, approvedBy, cpu string) *onboardingv1alpha1.QuotaRequest {
+	return &onboardingv1alpha1.QuotaRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "raise", Namespace: "project1"},
+		Spec: onboardingv1alpha1.QuotaRequestSpec{
+			Resources:     withQuota(newEnvironment(false, cpu)).Spec.Resources,
+			Storage:       "20Gi",
+			Justification: "LOAD-42",
+			RequestedBy:   requestedBy,
+			Approved:      approvedBy != "",
+			ApprovedBy:    approvedBy,
+		},
+	}
+}
+
+func TestValidateQuotaRequest(t *testing.T) {
+	Approvers = nil
+	OperatorUser = "system:serviceaccount:onboarding:onboarding-operator-kubernetes"
+	defer func() { OperatorUser = "" }()
+	policies := []onboardingv1alpha1.EnvironmentPolicy{
+		{
+			Spec: onboardingv1alpha1.EnvironmentPolicySpec{
+				Rules: []onboardingv1alpha1.EnvironmentPolicyRule{
+					{
+						QuotaThreshold: corev1.ResourceList{"requests.cpu": resource.MustParse("4")},
+						QuotaManagers:  []string{"group:platform"},
+					},
+				},
+			},
+		},
+	}
+	env := withQuota(newEnvironment(false, "1"))
+	env.Spec.Approvers = []string{"owner", "bob"}
+	env.Status.ApprovedSpec = &onboardingv1alpha1.EnvironmentSpec{Approvers: []string{"owner"}}
+	pending := newQuotaRequest("user1", "", "2")
+	noQuota := newQuotaRequest("user1", "", "2")
+	noQuota.Spec.Storage = ""
+	user1 := authenticationv1.UserInfo{Username: "user1"}
+	owner := authenticationv1.UserInfo{Username: "owner"}
+	alice := authenticationv1.UserInfo{Username: "alice", Groups: []string{"platform"}}
+
+	tests := []struct {
+		name     string
+		env      *onboardingv1alpha1.Environment
+		old      *onboardingv1alpha1.QuotaRequest
+		qr       *onboardingv1alpha1.QuotaRequest
+		userInfo authenticationv1.UserInfo
+		allowed  bool
+	}{
+		{"requester creates", env, nil, newQuotaRequest("user1", "", "2"), user1, true},
+		{"created on behalf of someone else", env, nil, newQuotaRequest("user2", "", "2"), user1, false},
+		{"created approved", env, nil, newQuotaRequest("user1", "owner", "2"), user1, false},
+		{"created without Environment", nil, nil, newQuotaRequest("user1", "", "2"), user1, false},
+		{"created without quota", env, nil, noQuota, user1, false},
+		{"raised above the policy threshold", env, nil, newQuotaRequest("user1", "", "8"), user1, false},
+		{"quota manager raises above the policy threshold", env, nil, newQuotaRequest("alice", "", "8"), alice, true},
+		{"environment approver approves", env, pending, newQuotaRequest("user1", "owner", "2"), owner, true},
+		{"quota manager approves", env, pending, newQuotaRequest("user1", "alice", "2"), alice, true},
+		{"requester approves", env, pending, newQuotaRequest("user1", "user1", "2"), user1, false},
+		{"approver of the unapproved spec", env, pending, newQuotaRequest("user1", "bob", "2"), authenticationv1.UserInfo{Username: "bob"}, false},
+		{"not an approver", env, pending, newQuotaRequest("user1", "carol", "2"), authenticationv1.UserInfo{Username: "carol"}, false},
+		{"approved on behalf of someone else", env, pending, newQuotaRequest("user1", "owner", "2"), alice, false},
+		{"requested quota changed", env, pending, newQuotaRequest("user1", "", "3"), user1, false},
+		{"approval withdrawn", env, newQuotaRequest("user1", "owner", "2"), pending, user1, true},
+	}
+	for _, test := range tests {
+		reason := validateQuotaRequest(policies, test.env, test.old, test.qr, test.userInfo)
+		if allowed := reason == ""; allowed != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", test.name, test.allowed, reason)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var log = logf.Log.WithName("webhook_workload")
+
+// ValidatePath is the path the workload validating webhook is served on
+const ValidatePath = "/validate-workload-images"
+
+// defaultRegistry is the registry of the images whose name doesn't start with a registry host
+const defaultRegistry = "docker.io"
+
+// Add creates the workload validating webhook and registers it on the Manager webhook server
+func Add(mgr manager.Manager) error {
+	mgr.GetWebhookServer().Register(ValidatePath, &webhook.Admission{Handler: &imageValidator{client: mgr.GetClient()}})
+	return nil
+}
+
+// imageValidator rejects the Pods and pod-templated workloads of an Environment namespace pulling images from
+// registries the Environment doesn't allow
+type imageValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+// blank assignment to verify that imageValidator implements admission.DecoderInjector
+var _ admission.DecoderInjector = &imageValidator{}
+
+// InjectDecoder injects the decoder
+func (v *imageValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle admits the workload when all its images come from the registries allowed in its namespace
+func (v *imageValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	podSpec, err := v.podSpecOf(req)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if podSpec == nil {
+		return admission.Allowed("")
+	}
+
+	allowed, err := v.allowedRegistries(ctx, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	for _, image := range images(podSpec) {
+		if !imageAllowed(image, allowed) {
+			log.Info("Denied image", "Namespace", req.Namespace, "Kind", req.Kind.Kind, "Name", req.Name, "Image", image)
+			return admission.Denied(fmt.Sprintf("image %s is not pulled from a registry allowed in namespace %s", image, req.Namespace))
+		}
+	}
+	return admission.Allowed("")
+}
+
+// podSpecOf returns the pod spec of the admitted object, or nil for a kind holding no pod spec
+func (v *imageValidator) podSpecOf(req admission.Request) (*corev1.PodSpec, error) {
+	switch req.Kind.Kind {
+	case "Pod":
+		obj := &corev1.Pod{}
+		if err := v.decoder.Decode(req, obj); err != nil {
+			return nil, err
+		}
+		return &obj.Spec, nil
+	case "Deployment":
+		obj := &appsv1.Deployment{}
+		if err := v.decoder.Decode(req, obj); err != nil {
+			return nil, err
+		}
+		return &obj.Spec.Template.Spec, nil
+	case "StatefulSet":
+		obj := &appsv1.StatefulSet{}
+		if err := v.decoder.Decode(req, obj); err != nil {
+			return nil, err
+		}
+		return &obj.Spec.Template.Spec, nil
+	case "DaemonSet":
+		obj := &appsv1.DaemonSet{}
+		if err := v.decoder.Decode(req, obj); err != nil {
+			return nil, err
+		}
+		return &obj.Spec.Template.Spec, nil
+	case "ReplicaSet":
+		obj := &appsv1.ReplicaSet{}
+		if err := v.decoder.Decode(req, obj); err != nil {
+			return nil, err
+		}
+		return &obj.Spec.Template.Spec, nil
+	case "Job":
+		obj := &batchv1.Job{}
+		if err := v.decoder.Decode(req, obj); err != nil {
+			return nil, err
+		}
+		return &obj.Spec.Template.Spec, nil
+	case "CronJob":
+		obj := &batchv1beta1.CronJob{}
+		if err := v.decoder.Decode(req, obj); err != nil {
+			return nil, err
+		}
+		return &obj.Spec.JobTemplate.Spec.Template.Spec, nil
+	}
+	return nil, nil
+}
+
+// allowedRegistries resolves the registry lists an image of the namespace must match: the Environment owning
+// the namespace list, and the list of every EnvironmentPolicy rule of its tier. Empty lists are left out.
+func (v *imageValidator) allowedRegistries(ctx context.Context, namespace string) ([][]string, error) {
+	ns := &corev1.Namespace{}
+	if err := v.client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return nil, err
+	}
+	envName := ns.Labels[onboardingv1alpha1.EnvironmentLabel]
+	if envName == "" {
+		return nil, nil
+	}
+	env := &onboardingv1alpha1.Environment{}
+	if err := v.client.Get(ctx, types.NamespacedName{Name: envName}, env); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if env.Spec.Name != namespace {
+		// The label doesn't designate the Environment owning the namespace
+		return nil, nil
+	}
+
+	var allowed [][]string
+	if len(env.Spec.AllowedRegistries) > 0 {
+		allowed = append(allowed, env.Spec.AllowedRegistries)
+	}
+	policies := &onboardingv1alpha1.EnvironmentPolicyList{}
+	if err := v.client.List(ctx, policies); err != nil {
+		return nil, err
+	}
+	for _, policy := range policies.Items {
+		for _, rule := range policy.Spec.Rules {
+			if (rule.Tier == "" || rule.Tier == env.Tier()) && len(rule.AllowedRegistries) > 0 {
+				allowed = append(allowed, rule.AllowedRegistries)
+			}
+		}
+	}
+	return allowed, nil
+}
+
+// images returns the images of all the containers of the pod spec
+func images(spec *corev1.PodSpec) []string {
+	var result []string
+	for _, c := range spec.InitContainers {
+		result = append(result, c.Image)
+	}
+	for _, c := range spec.Containers {
+		result = append(result, c.Image)
+	}
+	for _, c := range spec.EphemeralContainers {
+		result = append(result, c.Image)
+	}
+	return result
+}
+
+// imageAllowed tells whether the image matches a registry, or registry path, of each allowed list
+func imageAllowed(image string, allowed [][]string) bool {
+	name := normalizeImage(image)
+	for _, registries := range allowed {
+		matched := false
+		for _, registry := range registries {
+			registry = strings.TrimSuffix(registry, "/")
+			if name == registry || strings.HasPrefix(name, registry+"/") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeImage returns the image name prefixed with its registry host, without tag nor digest
+func normalizeImage(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return defaultRegistry + "/library/" + image
+	}
+	if !strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost" {
+		return defaultRegistry + "/" + image
+	}
+	return image
+}
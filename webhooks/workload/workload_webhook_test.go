@@ -0,0 +1,77 @@
+package workload
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	onboardingv1alpha1 "gitlab.beopenit.com/cloud/onboarding-operator-kubernetes/pkg/apis/onboarding/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestImageAllowed(t *testing.T) {
+	allowed := [][]string{{"registry.internal", "docker.io/library"}}
+	tests := []struct {
+		image   string
+		allowed bool
+	}{
+		{"registry.internal/team/app:1.0", true},
+		{"registry.internal:5000/team/app", false},
+		{"registry.internal.evil.com/app", false},
+		{"nginx:1.19", true},
+		{"docker.io/library/nginx@sha256:abcd", true},
+		{"bitnami/redis", false},
+		{"quay.io/team/app", false},
+	}
+	for _, test := range tests {
+		if got := imageAllowed(test.image, allowed); got != test.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", test.image, test.allowed, got)
+		}
+	}
+	if !imageAllowed("quay.io/team/app", nil) {
+		t.Errorf("expected every image to be allowed without registry lists")
+	}
+}
+
+func TestAllowedRegistries(t *testing.T) {
+	env := &onboardingv1alpha1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "environment"},
+		Spec: onboardingv1alpha1.EnvironmentSpec{
+			Name:              "project1",
+			IsProd:            true,
+			AllowedRegistries: []string{"registry.internal/project1"},
+		},
+	}
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "project1",
+			Labels: map[string]string{onboardingv1alpha1.EnvironmentLabel: "environment"},
+		},
+	}
+	policy := &onboardingv1alpha1.EnvironmentPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: onboardingv1alpha1.EnvironmentPolicySpec{
+			Rules: []onboardingv1alpha1.EnvironmentPolicyRule{
+				{Tier: onboardingv1alpha1.TierProd, AllowedRegistries: []string{"registry.internal"}},
+				{Tier: onboardingv1alpha1.TierDev, AllowedRegistries: []string{"docker.io"}},
+			},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(onboardingv1alpha1.SchemeGroupVersion, &onboardingv1alpha1.Environment{},
+		&onboardingv1alpha1.EnvironmentPolicy{}, &onboardingv1alpha1.EnvironmentPolicyList{})
+	v := &imageValidator{client: fake.NewFakeClientWithScheme(s, env, ns, policy)}
+
+	allowed, err := v.allowedRegistries(context.TODO(), "project1")
+	if err != nil {
+		t.Fatalf("allowedRegistries: (%v)", err)
+	}
+	expected := [][]string{{"registry.internal/project1"}, {"registry.internal"}}
+	if !reflect.DeepEqual(expected, allowed) {
+		t.Errorf("expected %v, got %v", expected, allowed)
+	}
+}